@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// annotationsFile is the name of the file in the home directory holding the
+// annotations of extension versions. Manifests have no field for arbitrary
+// metadata, so annotations are only kept locally.
+const annotationsFile = ".azure-extensions-cli-annotations.json"
+
+// annotationsPath returns the path of the annotations file.
+func annotationsPath() (string, error) {
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, annotationsFile), nil
+}
+
+// annotationsKey returns the key of the annotations of an extension version.
+func annotationsKey(namespace, name, version string) string {
+	return fmt.Sprintf("%s/%s/%s", namespace, name, version)
+}
+
+// parseAnnotations parses key=value pairs.
+func parseAnnotations(pairs []string) (map[string]string, error) {
+	annotations := map[string]string{}
+	for _, p := range pairs {
+		kv := strings.SplitN(p, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, fmt.Errorf("Invalid metadata %q, expected key=value", p)
+		}
+		annotations[strings.TrimSpace(kv[0])] = kv[1]
+	}
+	return annotations, nil
+}
+
+// readAnnotations returns the annotations of all extension versions recorded
+// in the file at path. A missing file has no annotations.
+func readAnnotations(path string) (map[string]map[string]string, error) {
+	all := map[string]map[string]string{}
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return all, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &all); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+	return all, nil
+}
+
+// addAnnotations merges annotations into the ones of the extension version
+// with the given key in the file at path.
+func addAnnotations(path, key string, annotations map[string]string) error {
+	all, err := readAnnotations(path)
+	if err != nil {
+		return err
+	}
+	if all[key] == nil {
+		all[key] = map[string]string{}
+	}
+	for k, v := range annotations {
+		all[key][k] = v
+	}
+	b, err := json.MarshalIndent(all, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+// versionAnnotations returns the annotations of an extension version, if any.
+func versionAnnotations(namespace, name, version string) (map[string]string, error) {
+	path, err := annotationsPath()
+	if err != nil {
+		return nil, err
+	}
+	all, err := readAnnotations(path)
+	if err != nil {
+		return nil, err
+	}
+	return all[annotationsKey(namespace, name, version)], nil
+}
+
+// annotationRows returns the annotations as rows of a table, sorted by key.
+func annotationRows(annotations map[string]string) [][]string {
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	rows := [][]string{}
+	for _, k := range keys {
+		rows = append(rows, []string{"Metadata: " + k, annotations[k]})
+	}
+	return rows
+}
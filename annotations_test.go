@@ -0,0 +1,51 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseAnnotations(t *testing.T) {
+	a, err := parseAnnotations([]string{"build=1234", "commit = abc=def"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"build": "1234", "commit": " abc=def"}; !reflect.DeepEqual(a, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, a)
+	}
+	if _, err := parseAnnotations([]string{"build"}); err == nil {
+		t.Fatal("Expected an error for metadata without a value")
+	}
+}
+
+func TestAddAnnotations(t *testing.T) {
+	dir, err := ioutil.TempDir("", "annotations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, annotationsFile)
+
+	key := annotationsKey("Microsoft.Azure.Extensions", "CustomScript", "2.0.1")
+	if err := addAnnotations(path, key, map[string]string{"build": "1", "commit": "abc"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := addAnnotations(path, key, map[string]string{"build": "2"}); err != nil {
+		t.Fatal(err)
+	}
+
+	all, err := readAnnotations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := map[string]string{"build": "2", "commit": "abc"}; !reflect.DeepEqual(all[key], expected) {
+		t.Fatalf("Expected %v, but got %v", expected, all[key])
+	}
+	rows := annotationRows(all[key])
+	if expected := [][]string{{"Metadata: build", "2"}, {"Metadata: commit", "abc"}}; !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Expected rows %q, but got %q", expected, rows)
+	}
+}
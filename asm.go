@@ -0,0 +1,233 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/management"
+	"github.com/Azure/go-autorest/autorest/adal"
+	log "github.com/Sirupsen/logrus"
+)
+
+const (
+	msVersionHeader = "x-ms-version"
+	requestIDHeader = "x-ms-request-id"
+)
+
+// asmClient sends requests to the Azure Service Management API. The
+// management.Client of the SDK creates a new http.Transport for every request,
+// which cannot be configured, e.g. to send requests through --proxy, and its
+// requests cannot be cancelled. asmClient only replaces how requests are sent;
+// requests and responses are still the types of the SDK.
+type asmClient struct {
+	httpClient     *http.Client
+	config         management.ClientConfig
+	subscriptionID string
+
+	// token authenticates requests with an Azure AD bearer token. If nil,
+	// the management certificate of the transport is used.
+	token *adal.ServicePrincipalToken
+
+	// certThumbprint is the SHA-1 thumbprint of the management certificate,
+	// shown when the subscription rejects it.
+	certThumbprint string
+
+	// certNotAfter is when the management certificate expires.
+	certNotAfter time.Time
+}
+
+func newASMClient(subscriptionID string, cert []byte, config management.ClientConfig, proxyURL *url.URL) (asmClient, error) {
+	if subscriptionID == "" {
+		return asmClient{}, fmt.Errorf("subscription ID required")
+	}
+
+	keyPair, err := tls.X509KeyPair(cert, cert)
+	if err != nil {
+		return asmClient{}, err
+	}
+
+	x509Cert, err := x509.ParseCertificate(keyPair.Certificate[0])
+	if err != nil {
+		return asmClient{}, err
+	}
+
+	return asmClient{
+		httpClient:     newHTTPClient(proxyURL, []tls.Certificate{keyPair}),
+		config:         config,
+		subscriptionID: subscriptionID,
+		certThumbprint: fmt.Sprintf("%X", sha1.Sum(keyPair.Certificate[0])),
+		certNotAfter:   x509Cert.NotAfter,
+	}, nil
+}
+
+// newASMClientWithToken constructs an asmClient authenticating with an Azure
+// AD token instead of a management certificate. The token is sent to the
+// Service Management API, as extensions cannot be published with Azure
+// Resource Manager.
+func newASMClientWithToken(subscriptionID string, token *adal.ServicePrincipalToken, config management.ClientConfig, proxyURL *url.URL) (asmClient, error) {
+	if subscriptionID == "" {
+		return asmClient{}, fmt.Errorf("subscription ID required")
+	}
+
+	httpClient := newHTTPClient(proxyURL, nil)
+	// The token is requested with the same client as ASM requests, so that
+	// it goes through --proxy and is traced and recorded, without secrets.
+	token.SetSender(httpClient)
+	return asmClient{
+		httpClient:     httpClient,
+		config:         config,
+		subscriptionID: subscriptionID,
+		token:          token,
+	}, nil
+}
+
+func newHTTPClient(proxyURL *url.URL, certs []tls.Certificate) *http.Client {
+	proxy := http.ProxyFromEnvironment
+	if proxyURL != nil {
+		proxy = http.ProxyURL(proxyURL)
+	}
+
+	return &http.Client{
+		Transport: decompressingTransport{&http.Transport{
+			Proxy: proxy,
+			TLSClientConfig: &tls.Config{
+				Renegotiation: tls.RenegotiateOnceAsClient,
+				Certificates:  certs,
+			},
+		}},
+	}
+}
+
+func (c asmClient) SendAzureGetRequest(ctx context.Context, url string) ([]byte, error) {
+	resp, err := c.sendRequest(ctx, "GET", url, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	return readResponseBody(resp)
+}
+
+func (c asmClient) SendAzurePostRequest(ctx context.Context, url string, data []byte) (management.OperationID, error) {
+	return c.submitAsync(ctx, "POST", url, "", data)
+}
+
+func (c asmClient) SendAzurePutRequest(ctx context.Context, url, contentType string, data []byte) (management.OperationID, error) {
+	return c.submitAsync(ctx, "PUT", url, contentType, data)
+}
+
+func (c asmClient) SendAzureDeleteRequest(ctx context.Context, url string) (management.OperationID, error) {
+	return c.submitAsync(ctx, "DELETE", url, "", nil)
+}
+
+func (c asmClient) GetOperationStatus(ctx context.Context, operationID management.OperationID) (management.GetOperationStatusResponse, error) {
+	var op management.GetOperationStatusResponse
+	b, err := c.SendAzureGetRequest(ctx, fmt.Sprintf("operations/%s", operationID))
+	if err != nil {
+		return op, err
+	}
+	err = xml.Unmarshal(b, &op)
+	return op, err
+}
+
+// submitAsync sends a mutating request, which Azure accepts with 202 Accepted
+// and runs as an asynchronous operation, and returns the ID of the operation
+// from the request ID header. All mutating requests go through it so that
+// their operations can be polled the same way with WaitForOperation.
+func (c asmClient) submitAsync(ctx context.Context, method, url, contentType string, data []byte) (management.OperationID, error) {
+	resp, err := c.sendRequest(ctx, method, url, contentType, data)
+	if err != nil {
+		return "", err
+	}
+	resp.Body.Close()
+	return operationID(resp)
+}
+
+// operationID returns the ID of the operation started by a request. A request
+// which completed synchronously still has an operation, which has already
+// succeeded.
+func operationID(resp *http.Response) (management.OperationID, error) {
+	id := resp.Header.Get(requestIDHeader)
+	if id == "" {
+		return "", fmt.Errorf("Could not retrieve operation id from %q header of %s response", requestIDHeader, resp.Status)
+	}
+	if resp.StatusCode != http.StatusAccepted {
+		log.WithField("x-ms-operation-id", id).Debugf("Request completed synchronously with %s.", resp.Status)
+	}
+	return management.OperationID(id), nil
+}
+
+// sendRequest sends a request to the subscription resource at the given
+// path. Error responses are returned as APIError.
+func (c asmClient) sendRequest(ctx context.Context, method, path, contentType string, data []byte) (*http.Response, error) {
+	if contentType == "" {
+		contentType = "application/xml"
+	}
+
+	// Redirects are followed by the http.Client, for any method as the body
+	// can be sent again, up to its limit of 10.
+	req, err := http.NewRequest(method, c.requestURL(path), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set(msVersionHeader, c.config.APIVersion)
+	req.Header.Set("User-Agent", c.config.UserAgent)
+	req.Header.Set("Content-Type", contentType)
+	if c.token != nil {
+		if err := c.token.EnsureFresh(); err != nil {
+			return nil, fmt.Errorf("Cannot acquire Azure AD token: %v", err)
+		}
+		req.Header.Set("Authorization", "Bearer "+c.token.OAuthToken())
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		b, err := readResponseBody(resp)
+		if err != nil {
+			return nil, err
+		}
+		e := newAPIError(resp, b)
+		if e.StatusCode == http.StatusForbidden && c.token == nil {
+			e.Hint = fmt.Sprintf("The management certificate (thumbprint %s) may not be uploaded to subscription %s. "+
+				"Check that it is listed in the management certificates of the subscription in the Azure portal, "+
+				"and that --%s is the subscription it was uploaded to.", c.certThumbprint, c.subscriptionID, flSubsID.Name)
+		}
+		return nil, e
+	}
+	return resp, nil
+}
+
+// requestURL returns the absolute URL of the subscription resource at the
+// given path.
+func (c asmClient) requestURL(path string) string {
+	return fmt.Sprintf("%s/%s/%s", c.config.ManagementURL, c.subscriptionID, path)
+}
+
+// newAPIError builds the APIError of an error response with the given body.
+func newAPIError(resp *http.Response, body []byte) APIError {
+	e := APIError{StatusCode: resp.StatusCode, RequestID: resp.Header.Get(requestIDHeader)}
+	var azErr management.AzureError
+	if err := xml.Unmarshal(body, &azErr); err != nil || azErr.Code == "" {
+		e.Message = fmt.Sprintf("Azure returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+		return e
+	}
+	e.Code, e.Message = azErr.Code, azErr.Message
+	return e
+}
+
+func readResponseBody(resp *http.Response) ([]byte, error) {
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
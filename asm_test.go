@@ -0,0 +1,681 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/management"
+	"github.com/Azure/go-autorest/autorest/adal"
+)
+
+// testCert returns a self-signed certificate and its private key in PEM.
+func testCert(t *testing.T) []byte {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "azure-extensions-cli"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &tpl, &tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return append(b, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer})...)
+}
+
+// testClient returns a client sending requests to the handler.
+func testClient(t *testing.T, h http.HandlerFunc) (ExtensionsClient, func()) {
+	srv := httptest.NewServer(h)
+	cl, err := NewClient("subscription-id", testCert(t), ClientConfig{ManagementURL: srv.URL})
+	if err != nil {
+		srv.Close()
+		t.Fatal(err)
+	}
+	return cl, srv.Close
+}
+
+func TestSendRequestHeaders(t *testing.T) {
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/subscription-id/services/publisherextensions" {
+			t.Errorf("Unexpected request path %q", r.URL.Path)
+		}
+		if v := r.Header.Get(msVersionHeader); v != apiVersion {
+			t.Errorf("Expected %s header %q, but got %q", msVersionHeader, apiVersion, v)
+		}
+		if v := r.Header.Get("User-Agent"); v != "azure-extensions-cli/unknown" {
+			t.Errorf("Expected User-Agent %q, but got %q", "azure-extensions-cli/unknown", v)
+		}
+		w.Write([]byte(`<ExtensionImages><ExtensionImage><Type>CustomScript</Type></ExtensionImage></ExtensionImages>`))
+	})
+	defer done()
+
+	l, err := cl.ListVersions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Extensions) != 1 || l.Extensions[0].Name != "CustomScript" {
+		t.Fatalf("Unexpected extensions %+v", l.Extensions)
+	}
+}
+
+func TestSubmitAsyncReturnsOperationID(t *testing.T) {
+	manifest := []byte(`<ExtensionImage><ProviderNameSpace>Microsoft.Azure.Extensions</ProviderNameSpace></ExtensionImage>`)
+	for _, tc := range []struct {
+		method string
+		submit func(ExtensionsClient) (management.OperationID, error)
+	}{
+		{"POST", func(cl ExtensionsClient) (management.OperationID, error) {
+			return cl.CreateExtension(context.Background(), manifest)
+		}},
+		{"PUT", func(cl ExtensionsClient) (management.OperationID, error) {
+			return cl.UpdateExtension(context.Background(), manifest)
+		}},
+		{"DELETE", func(cl ExtensionsClient) (management.OperationID, error) {
+			return cl.DeleteExtension(context.Background(), "Microsoft.Azure.Extensions", "CustomScript", "2.0.1")
+		}},
+	} {
+		for _, status := range []int{http.StatusAccepted, http.StatusOK} {
+			cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != tc.method {
+					t.Errorf("Expected a %s request, but got %s", tc.method, r.Method)
+				}
+				w.Header().Set(requestIDHeader, "operation-id")
+				w.WriteHeader(status)
+			})
+			op, err := tc.submit(cl)
+			done()
+			if err != nil {
+				t.Fatalf("%s %d: %v", tc.method, status, err)
+			}
+			if op != "operation-id" {
+				t.Fatalf("%s %d: expected operation ID \"operation-id\", but got %q", tc.method, status, op)
+			}
+		}
+
+		cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		})
+		_, err := tc.submit(cl)
+		done()
+		if err == nil || !strings.Contains(err.Error(), requestIDHeader) {
+			t.Fatalf("%s: expected an error about the missing %s header, but got: %v", tc.method, requestIDHeader, err)
+		}
+	}
+}
+
+func TestSendRequestFollowsRedirects(t *testing.T) {
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/moved" {
+			http.Redirect(w, r, "/moved", http.StatusTemporaryRedirect)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		if r.Method != "PUT" || string(b) != `<ExtensionImage/>` {
+			t.Errorf("Expected the PUT request with its body, but got %s %q", r.Method, b)
+		}
+		w.Header().Set(requestIDHeader, "operation-id")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	defer done()
+	op, err := cl.UpdateExtension(context.Background(), []byte(`<ExtensionImage/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op != "operation-id" {
+		t.Fatalf("Expected operation ID \"operation-id\", but got %q", op)
+	}
+}
+
+func TestSendRequestStopsFollowingRedirects(t *testing.T) {
+	requests := 0
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Redirect(w, r, r.URL.Path, http.StatusTemporaryRedirect)
+	})
+	defer done()
+	_, err := cl.UpdateExtension(context.Background(), []byte(`<ExtensionImage/>`))
+	if err == nil || !strings.Contains(err.Error(), "stopped after 10 redirects") {
+		t.Fatalf("Expected an error about redirects, but got: %v", err)
+	}
+	if requests != 10 {
+		t.Fatalf("Expected 10 requests, but got %d", requests)
+	}
+}
+
+func TestSendRequestReturnsAPIError(t *testing.T) {
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(requestIDHeader, "request-id")
+		w.WriteHeader(http.StatusConflict)
+		w.Write([]byte(`<Error xmlns="http://schemas.microsoft.com/windowsazure"><Code>ConflictError</Code><Message>Version already exists.</Message></Error>`))
+	})
+	defer done()
+
+	_, err := cl.GetReplicationStatus(context.Background(), "Microsoft.Azure.Extensions", "CustomScript", "2.0.1")
+	expected := APIError{StatusCode: http.StatusConflict, Code: "ConflictError", Message: "Version already exists.", RequestID: "request-id"}
+	if err != expected {
+		t.Fatalf("Expected %#v, but got %#v", expected, err)
+	}
+	if msg := "ConflictError: Version already exists. (x-ms-request-id=request-id)"; err.Error() != msg {
+		t.Fatalf("Expected message %q, but got %q", msg, err.Error())
+	}
+}
+
+func TestSendRequestHintsAtUnregisteredCertificate(t *testing.T) {
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+		w.Write([]byte(`<Error xmlns="http://schemas.microsoft.com/windowsazure"><Code>ForbiddenError</Code><Message>The server failed to authenticate the request.</Message></Error>`))
+	})
+	defer done()
+
+	_, err := cl.GetReplicationStatus(context.Background(), "Microsoft.Azure.Extensions", "CustomScript", "2.0.1")
+	if !isAuthError(err) {
+		t.Fatalf("Expected an authentication failure, but got %v", err)
+	}
+	if msg := err.Error(); !strings.Contains(msg, "may not be uploaded to subscription subscription-id") || !strings.Contains(msg, cl.client.certThumbprint) {
+		t.Fatalf("Expected a hint about the management certificate, but got %q", msg)
+	}
+}
+
+func TestSendRequestReturnsAPIErrorWithoutBody(t *testing.T) {
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	defer done()
+
+	_, err := cl.GetReplicationStatus(context.Background(), "Microsoft.Azure.Extensions", "CustomScript", "2.0.1")
+	if exitCode(err) != exitCodeNotFound {
+		t.Fatalf("Expected a not found error, but got %v", err)
+	}
+}
+
+func TestNewClientUsesProxy(t *testing.T) {
+	proxy, _ := url.Parse("http://proxy.example.com:8080")
+	cl, err := NewClient("subscription-id", testCert(t), ClientConfig{ManagementURL: "https://management.core.windows.net", ProxyURL: proxy})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr := httpTransport(cl.client.httpClient)
+	req, _ := http.NewRequest("GET", "https://management.core.windows.net", nil)
+	u, err := tr.Proxy(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.String() != proxy.String() {
+		t.Fatalf("Expected proxy %q, but got %q", proxy, u)
+	}
+	if len(tr.TLSClientConfig.Certificates) != 1 {
+		t.Fatal("Expected the client certificate to be preserved when using a proxy")
+	}
+}
+
+func TestListLocationsIsCached(t *testing.T) {
+	requests := 0
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Write([]byte(`<Locations xmlns="http://schemas.microsoft.com/windowsazure"><Location><Name>West US</Name><DisplayName>West US</DisplayName></Location></Locations>`))
+	})
+	defer done()
+
+	for i := 0; i < 2; i++ {
+		l, err := cl.ListLocations(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(l.Locations) != 1 || l.Locations[0].Name != "West US" {
+			t.Fatalf("Unexpected locations %+v", l.Locations)
+		}
+	}
+	if requests != 1 {
+		t.Fatalf("Expected exactly one request, but got %d", requests)
+	}
+}
+
+func TestSendRequestWithTokenSetsAuthorization(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get("Authorization"); v != "Bearer access-token" {
+			t.Errorf("Expected Authorization header %q, but got %q", "Bearer access-token", v)
+		}
+		w.Write([]byte(`<ExtensionImages></ExtensionImages>`))
+	}))
+	defer srv.Close()
+
+	oauthConfig, err := adal.NewOAuthConfig("https://login.microsoftonline.com/", "tenant-id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	token, err := adal.NewServicePrincipalTokenFromManualToken(*oauthConfig, "client-id", srv.URL+"/", adal.Token{
+		AccessToken: "access-token",
+		ExpiresOn:   strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := management.DefaultConfig()
+	cfg.APIVersion = apiVersion
+	cfg.ManagementURL = srv.URL
+	asm, err := newASMClientWithToken("subscription-id", token, cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := (ExtensionsClient{client: asm}).ListVersions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTokenRequestUsesClientTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/tenant-id/oauth2/token" {
+			w.Header().Set("Content-Type", "application/json")
+			fmt.Fprintf(w, `{"access_token": "access-token", "expires_in": "3600", "expires_on": "%d", "token_type": "Bearer"}`, time.Now().Add(time.Hour).Unix())
+			return
+		}
+		if v := r.Header.Get("Authorization"); v != "Bearer access-token" {
+			t.Errorf("Expected Authorization header %q, but got %q", "Bearer access-token", v)
+		}
+		w.Write([]byte(`<ExtensionImages></ExtensionImages>`))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	var trace bytes.Buffer
+	defer func(w io.Writer) { stderr = w }(stderr)
+	stderr = &trace
+
+	cl, err := NewClientFromServicePrincipal("tenant-id", "client-id", "client-secret", "subscription-id", ClientConfig{
+		ManagementURL:      srv.URL,
+		ActiveDirectoryURL: srv.URL,
+		Trace:              true,
+		RecordFixtures:     dir,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.ListVersions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(trace.String(), "POST /tenant-id/oauth2/token") {
+		t.Errorf("Expected the token request to be traced, but got %q", trace.String())
+	}
+	if strings.Contains(trace.String(), "client-secret") || strings.Contains(trace.String(), "access-token") {
+		t.Errorf("Expected no secrets in the trace, but got %q", trace.String())
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*.json"))
+	if len(files) != 2 {
+		t.Fatalf("Expected 2 fixtures, but got %v", files)
+	}
+	for _, file := range files {
+		b, _ := ioutil.ReadFile(file)
+		if bytes.Contains(b, []byte("access-token")) {
+			t.Errorf("Expected no token in fixture %s, but got %s", file, b)
+		}
+	}
+}
+
+func TestNewClientFromCertsFallsBack(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// The first certificate is rejected.
+		if requests == 1 {
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`<Error xmlns="http://schemas.microsoft.com/windowsazure"><Code>ForbiddenError</Code><Message>The server failed to authenticate the request.</Message></Error>`))
+			return
+		}
+		w.Write([]byte(`<Locations xmlns="http://schemas.microsoft.com/windowsazure"></Locations>`))
+	}))
+	defer srv.Close()
+
+	cert := testCert(t)
+	if _, err := NewClientFromCerts(context.Background(), "subscription-id", [][]byte{cert, cert}, ClientConfig{ManagementURL: srv.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if requests != 2 {
+		t.Fatalf("Expected 2 requests, but got %d", requests)
+	}
+}
+
+func TestNewClientFromCertsStopsWhenCancelled(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer srv.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cert := testCert(t)
+	if _, err := NewClientFromCerts(ctx, "subscription-id", [][]byte{cert, cert}, ClientConfig{ManagementURL: srv.URL}); err == nil || !strings.Contains(err.Error(), "canceled") {
+		t.Fatalf("Expected the cancellation error, but got: %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("Expected no requests, but got %d", requests)
+	}
+}
+
+func TestListVersionsFollowsContinuationToken(t *testing.T) {
+	pages := map[string]string{
+		"":       `<ExtensionImages><ExtensionImage><Type>CustomScript</Type></ExtensionImage><ContinuationToken>page 2</ContinuationToken></ExtensionImages>`,
+		"page 2": `<ExtensionImages><ExtensionImage><Type>DockerExtension</Type></ExtensionImage><ContinuationToken>page 3</ContinuationToken></ExtensionImages>`,
+		"page 3": `<ExtensionImages><ExtensionImage><Type>VMAccess</Type></ExtensionImage></ExtensionImages>`,
+	}
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		page, ok := pages[r.URL.Query().Get("ContinuationToken")]
+		if !ok {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		w.Write([]byte(page))
+	})
+	defer done()
+
+	l, err := cl.ListVersions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, e := range l.Extensions {
+		names = append(names, e.Name)
+	}
+	if expected := []string{"CustomScript", "DockerExtension", "VMAccess"}; !reflect.DeepEqual(names, expected) {
+		t.Fatalf("Expected extensions %q, but got %q", expected, names)
+	}
+}
+
+func TestReplicateExtensionKeepsRegions(t *testing.T) {
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "GET" {
+			w.Write([]byte(`<ExtensionImages><ExtensionImage><ProviderNameSpace>Microsoft.Azure.Extensions</ProviderNameSpace><Type>CustomScript</Type><Version>2.0.1</Version><Regions>West Central US</Regions></ExtensionImage></ExtensionImages>`))
+			return
+		}
+		var m extensionImage
+		b, _ := ioutil.ReadAll(r.Body)
+		if err := xml.Unmarshal(b, &m); err != nil {
+			t.Error(err)
+		}
+		if expected := "West Central US;West US"; m.Regions != expected {
+			t.Errorf("Expected regions %q, but got %q", expected, m.Regions)
+		}
+		w.Header().Set(requestIDHeader, "operation-id")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	defer done()
+
+	if _, err := cl.ReplicateExtension(context.Background(), "Microsoft.Azure.Extensions", "CustomScript", "2.0.1", []string{"West US", "west central us"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestReplicateExtensionRefusesGlobalVersion(t *testing.T) {
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "GET" {
+			t.Errorf("Expected no update of a version replicated to all regions, but got %s %s", r.Method, r.URL)
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.Write([]byte(`<ExtensionImages><ExtensionImage><ProviderNameSpace>Microsoft.Azure.Extensions</ProviderNameSpace><Type>CustomScript</Type><Version>2.0.1</Version><Regions></Regions></ExtensionImage></ExtensionImages>`))
+	})
+	defer done()
+
+	_, err := cl.ReplicateExtension(context.Background(), "Microsoft.Azure.Extensions", "CustomScript", "2.0.1", []string{"West US"})
+	if err == nil || !strings.Contains(err.Error(), "already replicated to all regions") {
+		t.Fatalf("Expected an error for a version replicated to all regions, but got: %v", err)
+	}
+}
+
+func TestNextPollInterval(t *testing.T) {
+	interval, max := 5*time.Second, 30*time.Second
+	var intervals []time.Duration
+	for i := 0; i < 5; i++ {
+		intervals = append(intervals, interval)
+		interval = nextPollInterval(interval, max)
+	}
+	if expected := []time.Duration{5 * time.Second, 10 * time.Second, 20 * time.Second, 30 * time.Second, 30 * time.Second}; !reflect.DeepEqual(intervals, expected) {
+		t.Fatalf("Expected intervals %v, but got %v", expected, intervals)
+	}
+}
+
+func TestWaitForOperationPollsUntilSucceeded(t *testing.T) {
+	polls := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := "InProgress"
+		if polls == 3 {
+			status = "Succeeded"
+		}
+		w.Write([]byte(`<Operation xmlns="http://schemas.microsoft.com/windowsazure"><ID>operation-id</ID><Status>` + status + `</Status></Operation>`))
+	}))
+	defer srv.Close()
+
+	cl, err := NewClient("subscription-id", testCert(t), ClientConfig{ManagementURL: srv.URL, PollMinInterval: time.Millisecond, PollMaxInterval: 2 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.WaitForOperation(context.Background(), "operation-id"); err != nil {
+		t.Fatal(err)
+	}
+	if polls != 3 {
+		t.Fatalf("Expected 3 status checks, but got %d", polls)
+	}
+}
+
+func TestWaitForOperationAlreadyFinished(t *testing.T) {
+	for status, failed := range map[string]bool{"Succeeded": false, "Failed": true} {
+		polls := 0
+		cl, closeServer := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+			polls++
+			w.Write([]byte(`<Operation xmlns="http://schemas.microsoft.com/windowsazure"><ID>operation-id</ID><Status>` + status +
+				`</Status><Error><Code>BadRequest</Code><Message>Invalid manifest</Message></Error></Operation>`))
+		})
+		cl.pollMinInterval, cl.pollMaxInterval = time.Hour, time.Hour
+
+		err := cl.WaitForOperation(context.Background(), "operation-id")
+		closeServer()
+		if failed && (err == nil || !strings.Contains(err.Error(), "Invalid manifest")) {
+			t.Fatalf("%s: expected the error of the operation, but got %v", status, err)
+		} else if !failed && err != nil {
+			t.Fatalf("%s: %v", status, err)
+		}
+		if polls != 1 {
+			t.Fatalf("%s: expected 1 status check, but got %d", status, polls)
+		}
+	}
+}
+
+func TestWaitForOperationTimesOut(t *testing.T) {
+	cl, closeServer := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<Operation xmlns="http://schemas.microsoft.com/windowsazure"><ID>operation-id</ID><Status>InProgress</Status></Operation>`))
+	})
+	defer closeServer()
+	cl.operationTimeout = 50 * time.Millisecond
+	cl.pollMinInterval, cl.pollMaxInterval = time.Hour, time.Hour
+
+	start := time.Now()
+	err := cl.WaitForOperation(context.Background(), "operation-id")
+	if err == nil || !strings.Contains(err.Error(), "Timed out") {
+		t.Fatalf("Expected a timeout, but got %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Expected the timeout to cut the poll interval short, but waited %v", d)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	cl.operationTimeout = time.Hour
+	if err := cl.WaitForOperation(ctx, "operation-id"); err != context.Canceled {
+		t.Fatalf("Expected %v, but got %v", context.Canceled, err)
+	}
+}
+
+func TestWaitForOperationNotFound(t *testing.T) {
+	polls := 0
+	cl, closeServer := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(`<Error xmlns="http://schemas.microsoft.com/windowsazure"><Code>ResourceNotFound</Code><Message>The operation was not found.</Message></Error>`))
+	})
+	defer closeServer()
+	cl.pollMinInterval, cl.pollMaxInterval = time.Hour, time.Hour
+
+	if err := cl.WaitForOperation(context.Background(), "operation-id"); exitCode(err) != exitCodeNotFound {
+		t.Fatalf("Expected a not found error, but got %v", err)
+	}
+	if polls != 1 {
+		t.Fatalf("Expected 1 status check, but got %d", polls)
+	}
+}
+
+func TestOperationResult(t *testing.T) {
+	for _, tc := range []struct {
+		status       management.OperationStatus
+		done, failed bool
+	}{
+		{management.OperationStatusInProgress, false, false},
+		{management.OperationStatusSucceeded, true, false},
+		{management.OperationStatusFailed, true, true},
+		{"Unknown", true, true},
+	} {
+		done, err := operationResult("operation-id", management.GetOperationStatusResponse{Status: tc.status})
+		if done != tc.done || (err != nil) != tc.failed {
+			t.Fatalf("%s: expected done=%v failed=%v, but got done=%v err=%v", tc.status, tc.done, tc.failed, done, err)
+		}
+	}
+}
+
+func TestHTTPTimeout(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	cl, err := NewClient("subscription-id", testCert(t), ClientConfig{ManagementURL: srv.URL, HTTPTimeout: 50 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	if _, err := cl.ListVersions(context.Background()); err == nil {
+		t.Fatal("Expected the hung request to time out")
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("Request timed out after %v", d)
+	}
+}
+
+func TestUserAgentSuffix(t *testing.T) {
+	if ua := userAgent("release-pipeline"); ua != "azure-extensions-cli/unknown release-pipeline" {
+		t.Fatalf("Unexpected User-Agent %q", ua)
+	}
+}
+
+func TestInsecureSkipVerify(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<Locations xmlns="http://schemas.microsoft.com/windowsazure"></Locations>`))
+	}))
+	defer srv.Close()
+
+	cl, err := NewClient("subscription-id", testCert(t), ClientConfig{ManagementURL: srv.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.ListLocations(context.Background()); err == nil {
+		t.Fatal("Expected the self-signed certificate to be rejected")
+	}
+
+	cl, err = NewClient("subscription-id", testCert(t), ClientConfig{ManagementURL: srv.URL, InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.ListLocations(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestUpdateExtensionChecksAllowedNamespaces(t *testing.T) {
+	requests := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.Header().Set("x-ms-request-id", "operation-id")
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer srv.Close()
+	cl, err := NewClient("subscription-id", testCert(t), ClientConfig{
+		ManagementURL:     srv.URL,
+		AllowedNamespaces: []string{"Contoso.", "microsoft.azure.extensions"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manifest := func(ns string) []byte {
+		return []byte(`<ExtensionImage><ProviderNameSpace>` + ns + `</ProviderNameSpace></ExtensionImage>`)
+	}
+	if _, err := cl.UpdateExtension(context.Background(), manifest("Fabrikam.Test")); err == nil || !strings.Contains(err.Error(), "Contoso., microsoft.azure.extensions") {
+		t.Fatalf("Expected an error listing the allowed namespaces, but got: %v", err)
+	}
+	if requests != 0 {
+		t.Fatalf("Expected no requests for a namespace that is not allowed, but got %d", requests)
+	}
+	for _, ns := range []string{"Contoso.Test", "Microsoft.Azure.Extensions"} {
+		if _, err := cl.UpdateExtension(context.Background(), manifest(ns)); err != nil {
+			t.Fatalf("%s: %v", ns, err)
+		}
+	}
+	if requests != 2 {
+		t.Fatalf("Expected 2 requests, but got %d", requests)
+	}
+}
+
+func TestNewClientOverridesAPIVersion(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get(msVersionHeader); v != "2016-06-01" {
+			t.Errorf("Expected %s header %q, but got %q", msVersionHeader, "2016-06-01", v)
+		}
+		w.Write([]byte(`<ExtensionImages></ExtensionImages>`))
+	}))
+	defer srv.Close()
+	cl, err := NewClient("subscription-id", testCert(t), ClientConfig{ManagementURL: srv.URL, APIVersion: "2016-06-01"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := cl.ListVersions(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+}
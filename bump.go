@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+// bumpLevels are the components of a version bump-version increments.
+var bumpLevels = []string{"major", "minor", "patch"}
+
+func bumpManifestVersion(ctx context.Context, c *cli.Context) error {
+	manifestFile, err := checkFlag(c, flManifest.Name)
+	if err != nil {
+		return err
+	}
+	b, err := readManifestFile(manifestFile)
+	if err != nil {
+		return fmt.Errorf("Error reading manifest: %v", err)
+	}
+	var manifest extensionImage
+	if err := xml.Unmarshal(b, &manifest); err != nil {
+		return fmt.Errorf("Error parsing manifest: %v", err)
+	}
+
+	level, err := checkFlag(c, flBump.Name)
+	if err != nil {
+		return err
+	}
+	version, err := bumpVersion(manifest.Version, level)
+	if err != nil {
+		return err
+	}
+	log.Infof("Bumped version %s to %s.", manifest.Version, version)
+	manifest.Version = version
+
+	bs, err := xml.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("xml marshall error: %v", err)
+	}
+	return writeManifest(c, bs)
+}
+
+// bumpVersion increments the major, minor or patch component of a dotted
+// numeric version, e.g. 1.2.3, and resets the components after it to zero.
+// Missing components are zero, so the patch of 1.2 is bumped to 1.2.1.
+func bumpVersion(version, level string) (string, error) {
+	i := -1
+	for j, l := range bumpLevels {
+		if l == level {
+			i = j
+		}
+	}
+	if i < 0 {
+		return "", fmt.Errorf("Unsupported --%s %q, must be one of: %s", flBump.Name, level, strings.Join(bumpLevels, ", "))
+	}
+
+	components := strings.Split(version, ".")
+	for len(components) <= i {
+		components = append(components, "0")
+	}
+	for j := range components {
+		n, err := versionComponent(components, j, version)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case j == i:
+			n++
+		case j > i:
+			n = 0
+		}
+		components[j] = strconv.Itoa(n)
+	}
+	return strings.Join(components, "."), nil
+}
@@ -0,0 +1,33 @@
+package main
+
+import "testing"
+
+func TestBumpVersion(t *testing.T) {
+	for _, tc := range []struct {
+		version, level, expected string
+	}{
+		{"1.2.3", "patch", "1.2.4"},
+		{"1.2.3", "minor", "1.3.0"},
+		{"1.2.3", "major", "2.0.0"},
+		{"4.3.2.1", "minor", "4.4.0.0"},
+		{"1.2", "patch", "1.2.1"},
+		{"1", "minor", "1.1"},
+	} {
+		v, err := bumpVersion(tc.version, tc.level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v != tc.expected {
+			t.Fatalf("Bumping the %s of %s: expected %s, but got %s", tc.level, tc.version, tc.expected, v)
+		}
+	}
+}
+
+func TestBumpVersionRejectsInvalidInput(t *testing.T) {
+	if _, err := bumpVersion("1.2.3", "build"); err == nil {
+		t.Fatal("Expected an error for an unsupported level")
+	}
+	if _, err := bumpVersion("1.2.x", "patch"); err == nil {
+		t.Fatal("Expected an error for a version which is not numeric")
+	}
+}
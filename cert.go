@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// readCert reads a .pem or .pfx certificate file and returns the certificate
+// and its private key in PEM, decrypting them with the password if necessary.
+func readCert(certFile, password string) ([]byte, error) {
+	b, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		return nil, err
+	}
+	return decodeCert(b, isPFXFile(certFile), password)
+}
+
+// isPFXFile reports whether the name of a certificate file has the extension
+// of a PKCS#12 file.
+func isPFXFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".pfx" || ext == ".p12"
+}
+
+// decodeCert returns the certificate and private key of PEM or PKCS#12 data
+// in PEM. The format is detected from the content, pfx only tells whether the
+// data is expected to be PKCS#12 for the error messages.
+func decodeCert(b []byte, pfx bool, password string) ([]byte, error) {
+	if p, _ := pem.Decode(b); p != nil {
+		return decryptPEM(b, password)
+	}
+
+	pemBlocks, err := pkcs12.ToPEM(b, password)
+	if err == pkcs12.ErrIncorrectPassword {
+		if password == "" {
+			return nil, fmt.Errorf(".pfx certificate is encrypted, its password must be provided with --%s", flCertPassword.Name)
+		}
+		return nil, errors.New("wrong certificate password")
+	} else if _, ok := err.(pkcs12.NotImplementedError); ok {
+		return nil, fmt.Errorf("%v, export the .pfx certificate with 3DES encryption (e.g. 'openssl pkcs12 -export -legacy') or convert it to .pem", err)
+	} else if err != nil {
+		if !pfx {
+			return nil, errors.New("certificate is neither PEM nor PKCS#12 (.pfx)")
+		}
+		return nil, fmt.Errorf("malformed .pfx certificate: %v", err)
+	}
+
+	var buf bytes.Buffer
+	for _, x := range pemBlocks {
+		buf.Write(pem.EncodeToMemory(x))
+	}
+
+	return buf.Bytes(), nil
+}
+
+// decryptPEM decrypts the encrypted blocks of PEM data with the password.
+// Blocks which are not encrypted are returned as is.
+func decryptPEM(b []byte, password string) ([]byte, error) {
+	var buf bytes.Buffer
+	for {
+		var p *pem.Block
+		p, b = pem.Decode(b)
+		if p == nil {
+			break
+		}
+
+		if p.Type == "ENCRYPTED PRIVATE KEY" {
+			return nil, errors.New("PKCS#8 encrypted private keys are not supported, convert the key with 'openssl rsa' first")
+		}
+		if x509.IsEncryptedPEMBlock(p) {
+			if password == "" {
+				return nil, fmt.Errorf("certificate is encrypted, its password must be provided with --%s", flCertPassword.Name)
+			}
+			der, err := x509.DecryptPEMBlock(p, []byte(password))
+			if err == x509.IncorrectPasswordError {
+				return nil, errors.New("wrong certificate password")
+			} else if err != nil {
+				return nil, fmt.Errorf("malformed encrypted certificate: %v", err)
+			}
+			p = &pem.Block{Type: p.Type, Bytes: der}
+		}
+		buf.Write(pem.EncodeToMemory(p))
+	}
+	return buf.Bytes(), nil
+}
+
+// normalizeThumbprint returns the SHA-1 thumbprint of a certificate in upper
+// case hex, without the spaces or colons it is often copied with.
+func normalizeThumbprint(thumbprint string) (string, error) {
+	t := strings.ToUpper(strings.NewReplacer(" ", "", ":", "").Replace(thumbprint))
+	if len(t) != 40 || strings.Trim(t, "0123456789ABCDEF") != "" {
+		return "", fmt.Errorf("Invalid certificate thumbprint %q, expected 40 hex characters", thumbprint)
+	}
+	return t, nil
+}
+
+// certExpiry describes the expiry of a management certificate if it expired or
+// expires within window of now, otherwise it returns "". Azure rejects expired
+// certificates with an unhelpful TLS handshake failure.
+func certExpiry(thumbprint string, notAfter, now time.Time, window time.Duration) string {
+	expires := notAfter.UTC().Format("2006-01-02")
+	switch {
+	case !now.Before(notAfter):
+		return fmt.Sprintf("Management certificate %s expired on %s, renew it and upload the new certificate to the subscription", thumbprint, expires)
+	case now.Add(window).After(notAfter):
+		days := int(notAfter.Sub(now).Hours() / 24)
+		return fmt.Sprintf("Management certificate %s expires on %s, in %d days, renew it and upload the new certificate to the subscription", thumbprint, expires, days)
+	}
+	return ""
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// encryptTestCert encrypts the private key of a PEM certificate with the password.
+func encryptTestCert(t *testing.T, b []byte, password string) []byte {
+	var out []byte
+	for {
+		var p *pem.Block
+		p, b = pem.Decode(b)
+		if p == nil {
+			return out
+		}
+		if p.Type != "CERTIFICATE" {
+			var err error
+			p, err = x509.EncryptPEMBlock(rand.Reader, p.Type, p.Bytes, []byte(password), x509.PEMCipherAES256)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		out = append(out, pem.EncodeToMemory(p)...)
+	}
+}
+
+func TestDecryptPEM(t *testing.T) {
+	encrypted := encryptTestCert(t, testCert(t), "secret")
+
+	b, err := decryptPEM(encrypted, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.X509KeyPair(b, b); err != nil {
+		t.Fatalf("Decrypted certificate is not a valid key pair: %v", err)
+	}
+}
+
+func TestDecryptPEMRequiresPassword(t *testing.T) {
+	if _, err := decryptPEM(encryptTestCert(t, testCert(t), "secret"), ""); err == nil {
+		t.Fatal("Expected an error for an encrypted certificate without a password")
+	}
+}
+
+func TestDecryptPEMPassesUnencryptedCert(t *testing.T) {
+	b, err := decryptPEM(testCert(t), "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.X509KeyPair(b, b); err != nil {
+		t.Fatalf("Certificate is not a valid key pair: %v", err)
+	}
+}
+
+func TestNormalizeThumbprint(t *testing.T) {
+	want := "0123456789ABCDEF0123456789ABCDEF01234567"
+	for _, in := range []string{
+		"0123456789abcdef0123456789abcdef01234567",
+		"01 23 45 67 89 ab cd ef 01 23 45 67 89 ab cd ef 01 23 45 67",
+		"01:23:45:67:89:AB:CD:EF:01:23:45:67:89:AB:CD:EF:01:23:45:67",
+	} {
+		got, err := normalizeThumbprint(in)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("%q: got %q, want %q", in, got, want)
+		}
+	}
+
+	for _, in := range []string{"", "0123", "0123456789ABCDEF0123456789ABCDEF0123456Z"} {
+		if _, err := normalizeThumbprint(in); err == nil {
+			t.Fatalf("%q: expected an error", in)
+		}
+	}
+}
+
+func TestDecodeCertPFX(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "cert.pfx"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pemCert, err := decodeCert(b, true, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tls.X509KeyPair(pemCert, pemCert); err != nil {
+		t.Fatalf("Certificate is not a valid key pair: %v", err)
+	}
+
+	for _, tc := range []struct {
+		password, expected string
+	}{
+		{"", "password must be provided with --cert-password"},
+		{"wrong", "wrong certificate password"},
+	} {
+		if _, err := decodeCert(b, true, tc.password); err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected an error containing %q for password %q, but got: %v", tc.expected, tc.password, err)
+		}
+	}
+	if _, err := decodeCert([]byte("not a certificate"), false, ""); err == nil || !strings.Contains(err.Error(), "neither PEM nor PKCS#12") {
+		t.Errorf("Expected an error for an unknown format, but got: %v", err)
+	}
+}
+
+func TestCertExpiry(t *testing.T) {
+	now := time.Date(2017, 3, 1, 0, 0, 0, 0, time.UTC)
+	window := 30 * 24 * time.Hour
+	for _, tc := range []struct {
+		notAfter time.Time
+		expected string
+	}{
+		{now.Add(60 * 24 * time.Hour), ""},
+		{now.Add(10 * 24 * time.Hour), "Management certificate ABCD expires on 2017-03-11, in 10 days"},
+		{now.Add(-time.Hour), "Management certificate ABCD expired on 2017-02-28"},
+	} {
+		msg := certExpiry("ABCD", tc.notAfter, now, window)
+		if tc.expected == "" && msg != "" || !strings.HasPrefix(msg, tc.expected) {
+			t.Errorf("Expected a message starting with %q for %v, but got %q", tc.expected, tc.notAfter, msg)
+		}
+	}
+}
+
+func TestNewClientStrictCertExpiry(t *testing.T) {
+	// The test certificate expires within the hour.
+	if _, err := NewClient("subscription-id", testCert(t), ClientConfig{CertExpiryWindow: 24 * time.Hour}); err != nil {
+		t.Fatalf("Expected only a warning, but got: %v", err)
+	}
+	_, err := NewClient("subscription-id", testCert(t), ClientConfig{CertExpiryWindow: 24 * time.Hour, StrictCertExpiry: true})
+	if exitCode(err) != exitCodeAuthFailure {
+		t.Fatalf("Expected an authentication error, but got: %v", err)
+	}
+}
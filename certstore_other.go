@@ -0,0 +1,15 @@
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// readCertFromStore reads the certificate with the given SHA-1 thumbprint
+// from the certificate store of the OS, which is only implemented on Windows.
+func readCertFromStore(thumbprint string) ([]byte, error) {
+	return nil, fmt.Errorf("reading certificates from the certificate store is not supported on %s, use --%s with the certificate file instead", runtime.GOOS, flSubsCert.Name)
+}
@@ -0,0 +1,101 @@
+//go:build windows
+// +build windows
+
+package main
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strings"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+const (
+	exportPrivateKeys               = 0x4
+	reportNoPrivateKey              = 0x1
+	reportNotAbleToExportPrivateKey = 0x2
+	pfxExportPassword               = "azure-extensions-cli"
+)
+
+var procPFXExportCertStoreEx = syscall.NewLazyDLL("crypt32.dll").NewProc("PFXExportCertStoreEx")
+
+// cryptDataBlob is the CRYPT_DATA_BLOB of the CryptoAPI.
+type cryptDataBlob struct {
+	size uint32
+	data *byte
+}
+
+// readCertFromStore reads the certificate with the given SHA-1 thumbprint,
+// and its private key, from the personal certificate store of the current
+// user, and returns them in PEM. The private key must be exportable.
+func readCertFromStore(thumbprint string) ([]byte, error) {
+	name, err := syscall.UTF16PtrFromString("MY")
+	if err != nil {
+		return nil, err
+	}
+	store, err := syscall.CertOpenSystemStore(0, name)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open certificate store: %v", err)
+	}
+	defer syscall.CertCloseStore(store, 0)
+
+	var cert *syscall.CertContext
+	for {
+		cert, err = syscall.CertEnumCertificatesInStore(store, cert)
+		if cert == nil {
+			return nil, fmt.Errorf("no certificate with thumbprint %s in the personal certificate store", thumbprint)
+		}
+		der := (*[1 << 20]byte)(unsafe.Pointer(cert.EncodedCert))[:cert.Length:cert.Length]
+		sum := sha1.Sum(der)
+		if strings.EqualFold(hex.EncodeToString(sum[:]), thumbprint) {
+			break
+		}
+	}
+	defer syscall.CertFreeCertificateContext(cert)
+
+	// Export the certificate and its key through a PFX in memory, the only
+	// way CryptoAPI gives out private keys.
+	mem, err := syscall.CertOpenStore(syscall.CERT_STORE_PROV_MEMORY, 0, 0, 0, 0)
+	if err != nil {
+		return nil, fmt.Errorf("cannot create certificate store: %v", err)
+	}
+	defer syscall.CertCloseStore(mem, 0)
+	if err := syscall.CertAddCertificateContextToStore(mem, cert, syscall.CERT_STORE_ADD_ALWAYS, nil); err != nil {
+		return nil, fmt.Errorf("cannot copy certificate: %v", err)
+	}
+
+	password, err := syscall.UTF16PtrFromString(pfxExportPassword)
+	if err != nil {
+		return nil, err
+	}
+	flags := uintptr(exportPrivateKeys | reportNoPrivateKey | reportNotAbleToExportPrivateKey)
+	var blob cryptDataBlob
+	if r, _, err := procPFXExportCertStoreEx.Call(uintptr(mem), uintptr(unsafe.Pointer(&blob)), uintptr(unsafe.Pointer(password)), 0, flags); r == 0 {
+		return nil, fmt.Errorf("cannot export certificate, make sure its private key is exportable: %v", err)
+	}
+	pfx := make([]byte, blob.size)
+	blob.data = &pfx[0]
+	if r, _, err := procPFXExportCertStoreEx.Call(uintptr(mem), uintptr(unsafe.Pointer(&blob)), uintptr(unsafe.Pointer(password)), 0, flags); r == 0 {
+		return nil, fmt.Errorf("cannot export certificate, make sure its private key is exportable: %v", err)
+	}
+
+	pemBlocks, err := pkcs12.ToPEM(pfx[:blob.size], pfxExportPassword)
+	if err != nil {
+		return nil, fmt.Errorf("cannot read exported certificate: %v", err)
+	}
+	if len(pemBlocks) < 2 {
+		return nil, errors.New("certificate has no private key")
+	}
+	var buf bytes.Buffer
+	for _, p := range pemBlocks {
+		buf.Write(pem.EncodeToMemory(p))
+	}
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+func cloneVersion(ctx context.Context, c *cli.Context) error {
+	ns, name, err := checkExtensionFlags(c)
+	if err != nil {
+		return err
+	}
+	source, err := checkFlag(c, flSourceVersion.Name)
+	if err != nil {
+		return err
+	}
+	version, err := checkFlag(c, flVersion.Name)
+	if err != nil {
+		return err
+	}
+
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	published, err := cl.GetExtensionManifest(ctx, ns, name, source)
+	if err != nil {
+		return wrapf(err, "Cannot get published version %s.%s %s: %v", ns, name, source, err)
+	}
+
+	blobURL, err := blobURLFlag(c, func(fl string) string { return stringFlag(c, fl) })
+	if err != nil {
+		return err
+	}
+	if blobURL == "" {
+		log.Warnf("No --%s given, replace the %s placeholder before publishing.", flBlobURL.Name, blobURLPlaceholder)
+		blobURL = blobURLPlaceholder
+	}
+	b, err := newClonedManifest(published, version, blobURL)
+	if err != nil {
+		return err
+	}
+	return writeManifest(c, b)
+}
+
+// newClonedManifest returns the manifest of a new version of a published
+// extension with the given package. Like a new manifest, the version is
+// internal and not promoted to any region.
+func newClonedManifest(published []byte, version, blobURL string) ([]byte, error) {
+	var manifest extensionImage
+	if err := xml.Unmarshal(published, &manifest); err != nil {
+		return nil, fmt.Errorf("Error parsing published manifest: %v", err)
+	}
+	manifest.NS = "http://schemas.microsoft.com/windowsazure"
+	manifest.Version = version
+	manifest.MediaLink = blobURL
+	manifest.IsInternalExtension = true
+	manifest.Regions = ""
+
+	b, err := xml.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("xml marshall error: %v", err)
+	}
+	return b, nil
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestNewClonedManifest(t *testing.T) {
+	published := []byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">
+  <ProviderNameSpace>Microsoft.Azure.Extensions</ProviderNameSpace>
+  <Type>CustomScript</Type>
+  <Version>2.0.1</Version>
+  <Label>Custom Script</Label>
+  <MediaLink>https://example.blob.core.windows.net/packages/1.zip</MediaLink>
+  <Description>Runs scripts</Description>
+  <IsInternalExtension>false</IsInternalExtension>
+  <CompanyName>Microsoft</CompanyName>
+  <SupportedOS>Linux</SupportedOS>
+  <Regions>West US</Regions>
+</ExtensionImage>`)
+
+	b, err := newClonedManifest(published, "2.0.2", "https://example.blob.core.windows.net/packages/2.zip")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m extensionImage
+	if err := xml.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Version != "2.0.2" || m.MediaLink != "https://example.blob.core.windows.net/packages/2.zip" {
+		t.Errorf("Expected the version and package to be overridden, but got %+v", m)
+	}
+	if !m.IsInternalExtension || m.Regions != "" {
+		t.Errorf("Expected the clone to be internal without regions, but got %+v", m)
+	}
+	if m.Label != "Custom Script" || m.Description != "Runs scripts" || m.CompanyName != "Microsoft" || m.SupportedOS != "Linux" {
+		t.Errorf("Expected the metadata to carry over, but got %+v", m)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/Azure/go-autorest/autorest/azure"
+	"github.com/codegangsta/cli"
+)
+
+// defaultCloud is the cloud used when --cloud is not given.
+const defaultCloud = "AzurePublicCloud"
+
+// clouds are the Azure clouds --cloud can name.
+var clouds = map[string]azure.Environment{
+	"AzurePublicCloud":  azure.PublicCloud,
+	"AzureChinaCloud":   azure.ChinaCloud,
+	"AzureUSGovernment": azure.USGovernmentCloud,
+	"AzureGermanCloud":  azure.GermanCloud,
+}
+
+// lookupCloud returns the cloud with the given name, ignoring case.
+func lookupCloud(name string) (azure.Environment, error) {
+	var names []string
+	for n, env := range clouds {
+		if strings.EqualFold(n, name) {
+			return env, nil
+		}
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return azure.Environment{}, fmt.Errorf("Unknown cloud %q, must be one of: %s", name, strings.Join(names, ", "))
+}
+
+// managementURL returns the management URL given with --management-url, or
+// else the one of the cloud.
+func managementURL(c *cli.Context, env azure.Environment) string {
+	if u := stringFlag(c, "management-url"); u != "" {
+		return u
+	}
+	return strings.TrimSuffix(env.ServiceManagementEndpoint, "/")
+}
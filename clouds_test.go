@@ -0,0 +1,17 @@
+package main
+
+import "testing"
+
+func TestLookupCloud(t *testing.T) {
+	env, err := lookupCloud("azurechinacloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if env.ServiceManagementEndpoint != "https://management.core.chinacloudapi.cn/" {
+		t.Fatalf("Unexpected management endpoint %q", env.ServiceManagementEndpoint)
+	}
+
+	if _, err := lookupCloud("AzureMoonCloud"); err == nil {
+		t.Fatal("Expected an error for an unknown cloud")
+	}
+}
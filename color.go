@@ -0,0 +1,63 @@
+package main
+
+import (
+	"os"
+
+	"github.com/codegangsta/cli"
+)
+
+// ANSI escape sequences of the colors used in tables.
+const (
+	colorRed    = "\033[31m"
+	colorGreen  = "\033[32m"
+	colorYellow = "\033[33m"
+	colorReset  = "\033[0m"
+)
+
+// useColor reports whether tables printed to stdout are colored.
+var useColor = false
+
+// setupColor enables colors if stdout is a terminal, unless disabled with
+// --no-color or the NO_COLOR environment variable (https://no-color.org).
+func setupColor(c *cli.Context) {
+	useColor = colorEnabled(c.GlobalBool(flNoColor.Name), isTerminal(os.Stdout))
+}
+
+// colorEnabled reports whether tables are colored. NO_COLOR only disables
+// colors when it is not empty.
+func colorEnabled(noColor, terminal bool) bool {
+	return terminal && !noColor && os.Getenv("NO_COLOR") == ""
+}
+
+// colorize returns s in the color, if colors are enabled.
+func colorize(s, color string) string {
+	if !useColor || color == "" {
+		return s
+	}
+	return color + s + colorReset
+}
+
+// replicationStatusColor returns the color of a replication status: green
+// when completed, red when failed and yellow while in progress.
+func replicationStatusColor(status string) string {
+	switch status {
+	case replicationStatusCompleted:
+		return colorGreen
+	case replicationStatusFailed:
+		return colorRed
+	}
+	return colorYellow
+}
+
+// colorStatuses colors the replication statuses in the Status column of the
+// rows of a table with the given header.
+func colorStatuses(header []string, rows [][]string) {
+	for i, h := range header {
+		if h != "Status" {
+			continue
+		}
+		for _, row := range rows {
+			row[i] = colorize(row[i], replicationStatusColor(row[i]))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestColorize(t *testing.T) {
+	defer func(v bool) { useColor = v }(useColor)
+
+	useColor = false
+	if got := colorize(replicationStatusFailed, replicationStatusColor(replicationStatusFailed)); got != replicationStatusFailed {
+		t.Fatalf("Expected no color, got %q", got)
+	}
+
+	useColor = true
+	for status, color := range map[string]string{
+		replicationStatusCompleted: colorGreen,
+		replicationStatusFailed:    colorRed,
+		"InProgress":               colorYellow,
+	} {
+		if got, expected := colorize(status, replicationStatusColor(status)), color+status+colorReset; got != expected {
+			t.Fatalf("Expected %q, got %q", expected, got)
+		}
+	}
+}
+
+func TestColorStatuses(t *testing.T) {
+	defer func(v bool) { useColor = v }(useColor)
+	useColor = true
+
+	all := []versionReplicationStatus{{Namespace: "Microsoft.Azure.Extensions", Name: "CustomScript", Version: "2.0.1", Statuses: []ReplicationStatus{
+		{Location: "West US", Status: replicationStatusFailed},
+	}}}
+	colored := colorRed + replicationStatusFailed + colorReset
+
+	// The table of --all.
+	rows := allReplicationStatusRows(all)
+	colorStatuses(allReplicationStatusHeader(all), rows)
+	if expected := []string{"Microsoft.Azure.Extensions.CustomScript", "2.0.1", "West US", colored}; !reflect.DeepEqual(rows[0], expected) {
+		t.Fatalf("Expected %q, but got %q", expected, rows[0])
+	}
+
+	// The table of several subscriptions.
+	rows = [][]string{append([]string{"subscription-id"}, allReplicationStatusRows(all)[0]...)}
+	colorStatuses(append([]string{"Subscription"}, allReplicationStatusHeader(all)...), rows)
+	if expected := []string{"subscription-id", "Microsoft.Azure.Extensions.CustomScript", "2.0.1", "West US", colored}; !reflect.DeepEqual(rows[0], expected) {
+		t.Fatalf("Expected %q, but got %q", expected, rows[0])
+	}
+}
+
+func TestColorEnabled(t *testing.T) {
+	defer os.Unsetenv("NO_COLOR")
+
+	for _, tc := range []struct {
+		env               string
+		noColor, terminal bool
+		expected          bool
+	}{
+		{"", false, true, true},
+		{"1", false, true, false},
+		{"", true, true, false},
+		{"", false, false, false},
+	} {
+		os.Setenv("NO_COLOR", tc.env)
+		if got := colorEnabled(tc.noColor, tc.terminal); got != tc.expected {
+			t.Errorf("NO_COLOR=%q, --no-color=%v, terminal=%v: expected %v, but got %v", tc.env, tc.noColor, tc.terminal, tc.expected, got)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// completionShells are the shells completion scripts are generated for.
+var completionShells = []string{"bash", "zsh", "fish"}
+
+func completion(ctx context.Context, c *cli.Context) error {
+	shell := c.Args().First()
+	switch shell {
+	case "bash":
+		return writeBashCompletion(os.Stdout, c.App)
+	case "zsh":
+		// zsh runs the bash script through its bash compatibility layer.
+		fmt.Fprintf(os.Stdout, "#compdef %s\n\nautoload -U +X bashcompinit && bashcompinit\n\n", c.App.Name)
+		return writeBashCompletion(os.Stdout, c.App)
+	case "fish":
+		return writeFishCompletion(os.Stdout, c.App)
+	}
+	return fmt.Errorf("Unsupported shell %q, must be one of: %s", shell, strings.Join(completionShells, ", "))
+}
+
+// flagNames returns the command line names of a flag, e.g. --quiet and -q.
+func flagNames(f cli.Flag) []string {
+	var names []string
+	for _, n := range strings.Split(f.GetName(), ",") {
+		n = strings.TrimSpace(n)
+		if len(n) == 1 {
+			names = append(names, "-"+n)
+		} else {
+			names = append(names, "--"+n)
+		}
+	}
+	return names
+}
+
+// flagTakesValue reports whether the flag is followed by a value.
+func flagTakesValue(f cli.Flag) bool {
+	switch f.(type) {
+	case cli.BoolFlag, cli.BoolTFlag:
+		return false
+	}
+	return true
+}
+
+// allFlagNames returns the command line names of the flags, sorted.
+func allFlagNames(flags []cli.Flag) []string {
+	var names []string
+	for _, f := range flags {
+		names = append(names, flagNames(f)...)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func writeBashCompletion(w io.Writer, app *cli.App) error {
+	fn := "_" + strings.Replace(app.Name, "-", "_", -1)
+
+	var valueFlags, commands []string
+	for _, f := range app.Flags {
+		if flagTakesValue(f) {
+			valueFlags = append(valueFlags, flagNames(f)...)
+		}
+	}
+	for _, cmd := range app.Commands {
+		commands = append(commands, cmd.Name)
+	}
+
+	fmt.Fprintf(w, "%s() {\n", fn)
+	fmt.Fprintf(w, "    local cur cmd i opts\n")
+	fmt.Fprintf(w, "    cur=\"${COMP_WORDS[COMP_CWORD]}\"\n")
+	fmt.Fprintf(w, "    cmd=\"\"\n")
+	fmt.Fprintf(w, "    for ((i=1; i<COMP_CWORD; i++)); do\n")
+	fmt.Fprintf(w, "        case \"${COMP_WORDS[i]}\" in\n")
+	if len(valueFlags) > 0 {
+		fmt.Fprintf(w, "            %s) ((i++)) ;;\n", strings.Join(valueFlags, "|"))
+	}
+	fmt.Fprintf(w, "            -*) ;;\n")
+	fmt.Fprintf(w, "            *) cmd=\"${COMP_WORDS[i]}\"; break ;;\n")
+	fmt.Fprintf(w, "        esac\n")
+	fmt.Fprintf(w, "    done\n\n")
+	fmt.Fprintf(w, "    case \"$cmd\" in\n")
+	for _, cmd := range app.Commands {
+		opts := allFlagNames(cmd.Flags)
+		if cmd.Name == "completion" {
+			opts = completionShells
+		}
+		fmt.Fprintf(w, "        %s) opts=%q ;;\n", cmd.Name, strings.Join(opts, " "))
+	}
+	fmt.Fprintf(w, "        \"\")\n")
+	fmt.Fprintf(w, "            if [[ \"$cur\" == -* ]]; then\n")
+	fmt.Fprintf(w, "                opts=%q\n", strings.Join(allFlagNames(app.Flags), " "))
+	fmt.Fprintf(w, "            else\n")
+	fmt.Fprintf(w, "                opts=%q\n", strings.Join(commands, " "))
+	fmt.Fprintf(w, "            fi ;;\n")
+	fmt.Fprintf(w, "        *) opts=\"\" ;;\n")
+	fmt.Fprintf(w, "    esac\n")
+	fmt.Fprintf(w, "    COMPREPLY=( $(compgen -W \"$opts\" -- \"$cur\") )\n")
+	fmt.Fprintf(w, "}\n\n")
+	_, err := fmt.Fprintf(w, "complete -o default -F %s %s\n", fn, app.Name)
+	return err
+}
+
+func writeFishCompletion(w io.Writer, app *cli.App) error {
+	fishFlag := func(name string) string {
+		if strings.HasPrefix(name, "--") {
+			return "-l " + strings.TrimPrefix(name, "--")
+		}
+		return "-s " + strings.TrimPrefix(name, "-")
+	}
+	quote := func(s string) string {
+		return "'" + strings.Replace(strings.Replace(s, `\`, `\\`, -1), "'", `\'`, -1) + "'"
+	}
+
+	for _, f := range app.Flags {
+		for _, n := range flagNames(f) {
+			fmt.Fprintf(w, "complete -c %s -n '__fish_use_subcommand' %s\n", app.Name, fishFlag(n))
+		}
+	}
+	for _, cmd := range app.Commands {
+		fmt.Fprintf(w, "complete -c %s -f -n '__fish_use_subcommand' -a %s -d %s\n", app.Name, cmd.Name, quote(cmd.Usage))
+	}
+	for _, cmd := range app.Commands {
+		cond := quote("__fish_seen_subcommand_from " + cmd.Name)
+		if cmd.Name == "completion" {
+			fmt.Fprintf(w, "complete -c %s -f -n %s -a %s\n", app.Name, cond, quote(strings.Join(completionShells, " ")))
+			continue
+		}
+		for _, n := range allFlagNames(cmd.Flags) {
+			fmt.Fprintf(w, "complete -c %s -n %s %s\n", app.Name, cond, fishFlag(n))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/codegangsta/cli"
+)
+
+func testCompletionApp() *cli.App {
+	app := cli.NewApp()
+	app.Name = "azure-extensions-cli"
+	app.Flags = []cli.Flag{flLogLevel, flQuiet}
+	app.Commands = []cli.Command{
+		{Name: "list-versions", Usage: "Lists all published extension versions for subscription", Flags: []cli.Flag{flNamespace, flName}},
+	}
+	return app
+}
+
+func TestBashCompletion(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeBashCompletion(&b, testCompletionApp()); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"--log-level) ((i++)) ;;",
+		`list-versions) opts="--name --namespace" ;;`,
+		`opts="--log-level --quiet -q"`,
+		"complete -o default -F _azure_extensions_cli azure-extensions-cli",
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("Expected the script to contain %q, but got:\n%s", s, b.String())
+		}
+	}
+}
+
+func TestFishCompletion(t *testing.T) {
+	var b bytes.Buffer
+	if err := writeFishCompletion(&b, testCompletionApp()); err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		"complete -c azure-extensions-cli -n '__fish_use_subcommand' -s q",
+		"complete -c azure-extensions-cli -f -n '__fish_use_subcommand' -a list-versions -d 'Lists all published extension versions for subscription'",
+		"complete -c azure-extensions-cli -n '__fish_seen_subcommand_from list-versions' -l namespace",
+	} {
+		if !strings.Contains(b.String(), s) {
+			t.Errorf("Expected the script to contain %q, but got:\n%s", s, b.String())
+		}
+	}
+}
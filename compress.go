@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// acceptEncoding is the Accept-Encoding of the requests sent to Azure.
+const acceptEncoding = "gzip, deflate"
+
+// decompressingTransport is an http.RoundTripper asking for compressed
+// responses and decompressing them, so that the transports wrapping it (and
+// the XML parsing of responses) only ever see the plain body.
+type decompressingTransport struct {
+	transport http.RoundTripper
+}
+
+func (t decompressingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get("Accept-Encoding") == "" {
+		req = cloneRequest(req)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+	}
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if err := decompressBody(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+	return resp, nil
+}
+
+// httpTransport returns the http.Transport sending the requests of an HTTP
+// client created by newHTTPClient, or nil if it was replaced.
+func httpTransport(c *http.Client) *http.Transport {
+	if t, ok := c.Transport.(decompressingTransport); ok {
+		tr, _ := t.transport.(*http.Transport)
+		return tr
+	}
+	return nil
+}
+
+// decompressBody replaces the body of a gzip or deflate encoded response with
+// its decompressed content.
+func decompressBody(resp *http.Response) error {
+	encoding := strings.ToLower(strings.TrimSpace(resp.Header.Get("Content-Encoding")))
+	if encoding == "" || encoding == "identity" {
+		return nil
+	}
+
+	var r io.ReadCloser
+	switch encoding {
+	case "gzip", "x-gzip":
+		gr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			return fmt.Errorf("Cannot decompress gzip response: %v", err)
+		}
+		r = gr
+	case "deflate":
+		// Deflate responses should be zlib streams, but some servers send
+		// raw deflate data.
+		br := bufio.NewReader(resp.Body)
+		if h, err := br.Peek(2); err == nil && h[0]&0x0f == 8 && (uint16(h[0])<<8|uint16(h[1]))%31 == 0 {
+			zr, err := zlib.NewReader(br)
+			if err != nil {
+				return fmt.Errorf("Cannot decompress deflate response: %v", err)
+			}
+			r = zr
+		} else {
+			r = flate.NewReader(br)
+		}
+	default:
+		return fmt.Errorf("Unsupported response encoding %q", encoding)
+	}
+
+	resp.Body = decompressedBody{r, resp.Body}
+	resp.Header.Del("Content-Encoding")
+	resp.Header.Del("Content-Length")
+	resp.ContentLength = -1
+	resp.Uncompressed = true
+	return nil
+}
+
+// decompressedBody reads the decompressed content of a response body, and
+// closes both the decompressor and the body.
+type decompressedBody struct {
+	io.ReadCloser
+	body io.Closer
+}
+
+func (b decompressedBody) Close() error {
+	err := b.ReadCloser.Close()
+	if cerr := b.body.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+// compressingTransport compresses the responses of a transport with the
+// given encoding, checking that it was accepted by the request.
+type compressingTransport struct {
+	t         *testing.T
+	transport http.RoundTripper
+	encoding  string
+}
+
+func (t compressingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if v := req.Header.Get("Accept-Encoding"); v != acceptEncoding {
+		t.t.Errorf("Expected Accept-Encoding %q, but got %q", acceptEncoding, v)
+	}
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := readResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if t.encoding == "gzip" {
+		w := gzip.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+	} else {
+		w := zlib.NewWriter(&buf)
+		w.Write(b)
+		w.Close()
+	}
+	resp.Body = ioutil.NopCloser(&buf)
+	resp.Header.Set("Content-Encoding", t.encoding)
+	return resp, nil
+}
+
+func TestCompressedFixtures(t *testing.T) {
+	for _, encoding := range []string{"gzip", "deflate"} {
+		for _, name := range []string{"list-versions", "replication-status"} {
+			tr, err := newReplayTransport(filepath.Join("testdata", "fixtures", name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			cl := replayClient(t, name)
+			cl.client.httpClient.Transport = decompressingTransport{compressingTransport{t, tr, encoding}}
+
+			if name == "list-versions" {
+				l, err := cl.ListVersions(context.Background())
+				if err != nil {
+					t.Fatalf("%s: %v", encoding, err)
+				}
+				if len(l.Extensions) != 2 || l.Extensions[1].Version != "2.0.2" {
+					t.Fatalf("%s: unexpected extensions %+v", encoding, l.Extensions)
+				}
+				continue
+			}
+			r, err := cl.GetReplicationStatus(context.Background(), "Microsoft.Azure.Extensions", "CustomScript", "2.0.2")
+			if err != nil {
+				t.Fatalf("%s: %v", encoding, err)
+			}
+			if len(r.Statuses) != 2 || r.Statuses[1].Status != "Replicating" {
+				t.Fatalf("%s: unexpected statuses %+v", encoding, r.Statuses)
+			}
+			// Error responses are decompressed before they are parsed too.
+			_, err = cl.GetReplicationStatus(context.Background(), "Microsoft.Azure.Extensions", "CustomScript", "9.9.9")
+			if exitCode(err) != exitCodeNotFound {
+				t.Fatalf("%s: expected a not found error, but got %v", encoding, err)
+			}
+		}
+	}
+}
+
+func TestNewClientDecompressesResponses(t *testing.T) {
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if v := r.Header.Get("Accept-Encoding"); v != acceptEncoding {
+			t.Errorf("Expected Accept-Encoding %q, but got %q", acceptEncoding, v)
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gw := gzip.NewWriter(w)
+		gw.Write([]byte(`<ExtensionImages><ExtensionImage><Type>CustomScript</Type></ExtensionImage></ExtensionImages>`))
+		gw.Close()
+	})
+	defer done()
+
+	l, err := cl.ListVersions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(l.Extensions) != 1 || l.Extensions[0].Name != "CustomScript" {
+		t.Fatalf("Unexpected extensions %+v", l.Extensions)
+	}
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+// defaultConfigFile is the name of the config file read from the home
+// directory when --config is not given.
+const defaultConfigFile = ".azure-extensions-cli.yaml"
+
+// config holds flag values read from the config file, keyed by flag name.
+var config = map[string]string{}
+
+// loadConfig reads the config file into config. A missing default config file
+// is not an error.
+func loadConfig(c *cli.Context) error {
+	path := c.GlobalString(flConfig.Name)
+	if path == "" {
+		home, err := homeDir()
+		if err != nil {
+			return nil
+		}
+		path = filepath.Join(home, defaultConfigFile)
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			return nil
+		}
+	}
+
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Error reading config file: %v", err)
+	}
+	m, err := parseConfig(b)
+	if err != nil {
+		return fmt.Errorf("Error parsing config file %s: %v", path, err)
+	}
+	log.Debugf("Read config file %s", path)
+	config = m
+	return nil
+}
+
+// homeDir returns the home directory of the user, from $HOME, or from
+// %USERPROFILE% on Windows.
+func homeDir() (string, error) {
+	env := "HOME"
+	if runtime.GOOS == "windows" {
+		env = "USERPROFILE"
+	}
+	if home := os.Getenv(env); home != "" {
+		return home, nil
+	}
+	return "", fmt.Errorf("Cannot find the home directory, %s is not set", env)
+}
+
+// parseConfig parses a flat YAML document of "key: value" lines, where keys
+// are flag names. Blank lines and comments starting with '#' are ignored.
+func parseConfig(b []byte) (map[string]string, error) {
+	m := map[string]string{}
+	s := bufio.NewScanner(bytes.NewReader(b))
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		i := strings.Index(line, ":")
+		if i <= 0 {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", n)
+		}
+		k, v := strings.TrimSpace(line[:i]), strings.TrimSpace(line[i+1:])
+		if len(v) >= 2 && (v[0] == '"' || v[0] == '\'') && v[len(v)-1] == v[0] {
+			v = v[1 : len(v)-1]
+		} else if j := strings.Index(v, " #"); j >= 0 {
+			v = strings.TrimSpace(v[:j])
+		}
+		m[k] = v
+	}
+	return m, s.Err()
+}
+
+// stringFlag returns the value of the flag. Flags given on the command line
+// take precedence over the config file, which takes precedence over
+// environment variables and defaults.
+func stringFlag(c *cli.Context, fl string) string {
+	if !c.IsSet(fl) {
+		if v, ok := config[fl]; ok {
+			return v
+		}
+	}
+	return c.String(fl)
+}
+
+// globalStringFlag is stringFlag for global flags.
+func globalStringFlag(c *cli.Context, fl string) string {
+	if !c.GlobalIsSet(fl) {
+		if v, ok := config[fl]; ok {
+			return v
+		}
+	}
+	return c.GlobalString(fl)
+}
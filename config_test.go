@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/codegangsta/cli"
+)
+
+func TestParseConfig(t *testing.T) {
+	m, err := parseConfig([]byte(`# publisher defaults
+subscription-id: 00000000-0000-0000-0000-000000000000
+subscription-cert: "/home/me/cert.pem"
+
+namespace: Microsoft.Azure.Extensions # comment
+name: 'CustomScript'
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"subscription-id":   "00000000-0000-0000-0000-000000000000",
+		"subscription-cert": "/home/me/cert.pem",
+		"namespace":         "Microsoft.Azure.Extensions",
+		"name":              "CustomScript",
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, m)
+	}
+}
+
+func TestParseConfigRejectsInvalidLines(t *testing.T) {
+	if _, err := parseConfig([]byte("namespace Microsoft.Azure.Extensions\n")); err == nil {
+		t.Fatal("Expected an error for a line without a key")
+	}
+}
+
+func TestStringFlagPrecedence(t *testing.T) {
+	defer func(m map[string]string) { config = m }(config)
+	config = map[string]string{flNamespace.Name: "Microsoft.Azure.Extensions", flName.Name: "CustomScript", flProxy.Name: "http://proxy:3128"}
+
+	global := flag.NewFlagSet("global", flag.ContinueOnError)
+	global.String(flProxy.Name, "", "")
+	set := flag.NewFlagSet("list-versions", flag.ContinueOnError)
+	set.String(flNamespace.Name, "", "")
+	set.String(flName.Name, "", "")
+	if err := set.Parse([]string{"--" + flName.Name, "DockerExtension"}); err != nil {
+		t.Fatal(err)
+	}
+	c := cli.NewContext(nil, set, cli.NewContext(nil, global, nil))
+
+	if v := stringFlag(c, flNamespace.Name); v != "Microsoft.Azure.Extensions" {
+		t.Fatalf("Expected the config file to fill the unset flag, but got %q", v)
+	}
+	if v := stringFlag(c, flName.Name); v != "DockerExtension" {
+		t.Fatalf("Expected the flag given on the command line to win, but got %q", v)
+	}
+	if v := globalStringFlag(c, flProxy.Name); v != "http://proxy:3128" {
+		t.Fatalf("Expected the config file to fill the unset global flag, but got %q", v)
+	}
+}
+
+func TestHomeDir(t *testing.T) {
+	env := "HOME"
+	if runtime.GOOS == "windows" {
+		env = "USERPROFILE"
+	}
+	defer os.Setenv(env, os.Getenv(env))
+
+	os.Setenv(env, "/home/publisher")
+	if home, err := homeDir(); err != nil || home != "/home/publisher" {
+		t.Fatalf("Expected \"/home/publisher\", but got %q, %v", home, err)
+	}
+	os.Setenv(env, "")
+	if _, err := homeDir(); err == nil {
+		t.Fatalf("Expected an error when %s is not set", env)
+	}
+}
@@ -1,22 +1,86 @@
 package main
 
 import (
+	"context"
+	"fmt"
+
+	"github.com/Azure/azure-sdk-for-go/management"
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 )
 
-func deleteVersion(c *cli.Context) {
-	cl := mkClient(checkFlag(c, flMgtURL.Name), checkFlag(c, flSubsID.Name), checkFlag(c, flSubsCert.Name))
-	ns, name, version := checkFlag(c, flNamespace.Name), checkFlag(c, flName.Name), checkFlag(c, flVersion.Name)
+func deleteVersion(ctx context.Context, c *cli.Context) error {
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	ns, name, version, err := checkVersionFlags(c)
+	if err != nil {
+		return err
+	}
+	if c.GlobalBool(flDryRun.Name) {
+		printDryRun("DELETE", cl.RequestURL(deleteExtensionPath(ns, name, version)), nil)
+		return nil
+	}
+	if err := checkConfirmNamespace(c, ns, name, version); err != nil {
+		return err
+	}
+	if !c.BoolT(flWaitOperation.Name) {
+		if c.Bool("force-unpublish") {
+			return fmt.Errorf("--%s cannot be used with --%s=false", "force-unpublish", flWaitOperation.Name)
+		}
+		cl.detach = true
+	}
 	log.Info("Deleting extension version. Make sure you unpublished before deleting.")
 
-	op, err := cl.DeleteExtension(ns, name, version)
+	err = deleteExtensionAndWait(ctx, cl, ns, name, version)
+	if err == nil || !c.Bool("force-unpublish") {
+		return err
+	}
+
+	// The delete may have failed because the version is still public.
+	e, gerr := cl.GetExtension(ctx, ns, name, version)
+	if gerr != nil || e.IsInternal {
+		return err
+	}
+	log.Warnf("Deleting failed, extension version is still published: %v", err)
+	log.Info("Unpublishing extension version before deleting it.")
+	b, err := newVisibilityManifest(ns, name, version, true, c.Bool(flIsXMLExtension.Name))
 	if err != nil {
-		log.Fatalf("Error deleting version: %v", err)
+		return err
+	}
+	if err := dumpManifest(c, b); err != nil {
+		return err
 	}
-	log.Debug("DeleteExtension operation started.")
-	if err := cl.WaitForOperation(op); err != nil {
-		log.Fatalf("DeleteExtension failed: %v", err)
+	if err := updateExtensionAndWait(ctx, cl, b); err != nil {
+		return err
 	}
-	log.Info("DeleteExtension operation finished.")
+	log.Info("Extension version unpublished, retrying delete.")
+	return deleteExtensionAndWait(ctx, cl, ns, name, version)
+}
+
+// checkConfirmNamespace checks that the target given with --confirm-namespace,
+// if any, is exactly the version a destructive command targets. With
+// --require-confirm-namespace, the target must be given.
+func checkConfirmNamespace(c *cli.Context, ns, name, version string) error {
+	target := ns + "/" + name + "/" + version
+	confirmed := stringFlag(c, flConfirmNamespace.Name)
+	if confirmed == "" {
+		if c.GlobalBool(flRequireConfirmNamespace.Name) {
+			return fmt.Errorf("Pass --%s %s to confirm the target of %s.", flConfirmNamespace.Name, target, c.Command.Name)
+		}
+		return nil
+	}
+	if confirmed != target {
+		return fmt.Errorf("--%s %q does not match the target %q, refusing to proceed.", flConfirmNamespace.Name, confirmed, target)
+	}
+	return nil
+}
+
+// deleteExtensionAndWait deletes the extension version and waits for the
+// operation to finish.
+func deleteExtensionAndWait(ctx context.Context, cl ExtensionsClient, ns, name, version string) error {
+	return runOperation(ctx, cl, "DeleteExtension", func() (management.OperationID, error) {
+		return cl.DeleteExtension(ctx, ns, name, version)
+	})
 }
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"testing"
+
+	"github.com/codegangsta/cli"
+)
+
+func TestCheckConfirmNamespace(t *testing.T) {
+	for _, tc := range []struct {
+		confirmed string
+		required  bool
+		ok        bool
+	}{
+		{"", false, true},
+		{"", true, false},
+		{"Microsoft.Azure.Extensions/CustomScript/2.0.1", true, true},
+		{"Microsoft.Azure.Extensions/CustomScript/2.0.1", false, true},
+		{"Microsoft.Azure.Extensions/CustomScript/2.0.2", false, false},
+		{"microsoft.azure.extensions/CustomScript/2.0.1", true, false},
+	} {
+		global := flag.NewFlagSet("global", flag.ContinueOnError)
+		global.Bool(flRequireConfirmNamespace.Name, tc.required, "")
+		set := flag.NewFlagSet("delete-version", flag.ContinueOnError)
+		set.String(flConfirmNamespace.Name, tc.confirmed, "")
+		c := cli.NewContext(nil, set, cli.NewContext(nil, global, nil))
+
+		err := checkConfirmNamespace(c, "Microsoft.Azure.Extensions", "CustomScript", "2.0.1")
+		if (err == nil) != tc.ok {
+			t.Errorf("%q (required=%v): expected ok=%v, but got: %v", tc.confirmed, tc.required, tc.ok, err)
+		}
+	}
+}
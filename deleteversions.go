@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+func deleteVersions(ctx context.Context, c *cli.Context) error {
+	ns, name, err := checkExtensionFlags(c)
+	if err != nil {
+		return err
+	}
+	olderThan, versions := stringFlag(c, flOlderThan.Name), stringFlag(c, flVersions.Name)
+	if (olderThan == "") == (versions == "") {
+		return fmt.Errorf("Exactly one of --%s or --%s must be provided", flOlderThan.Name, flVersions.Name)
+	}
+
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	l, err := cl.ListVersions(ctx)
+	if err != nil {
+		return wrapf(err, "Request failed: %v", err)
+	}
+	selected, err := selectVersions(filterVersions(l.Extensions, ns, name), olderThan, splitVersions(versions))
+	if err != nil {
+		return err
+	}
+	if len(selected) == 0 {
+		log.Infof("No version of %s.%s to delete.", ns, name)
+		return nil
+	}
+
+	fmt.Printf("Versions of %s.%s to delete:\n", ns, name)
+	for _, e := range selected {
+		visibility := "public, will be unpublished first"
+		if e.IsInternal {
+			visibility = "internal"
+		}
+		fmt.Printf("  %s (%s)\n", e.Version, visibility)
+	}
+
+	if c.GlobalBool(flDryRun.Name) {
+		for _, e := range selected {
+			printDryRun("DELETE", cl.RequestURL(deleteExtensionPath(e.Ns, e.Name, e.Version)), nil)
+		}
+		return nil
+	}
+	if !c.Bool(flConfirm.Name) {
+		return fmt.Errorf("Deleting versions cannot be reversed, pass --%s to proceed.", flConfirm.Name)
+	}
+
+	failed := 0
+	for _, e := range selected {
+		lg := log.WithField("version", e.Version)
+		if err := unpublishAndDelete(ctx, cl, e, c.Bool(flIsXMLExtension.Name)); err != nil {
+			lg.Errorf("Failed to delete version: %v", err)
+			failed++
+			continue
+		}
+		lg.Info("Version deleted.")
+	}
+	if failed > 0 {
+		return errorf(exitCodeOperationFailure, "Failed to delete %d of %d versions.", failed, len(selected))
+	}
+	return nil
+}
+
+// unpublishAndDelete deletes the extension version, unpublishing it first if
+// it is public.
+func unpublishAndDelete(ctx context.Context, cl ExtensionsClient, e PublishedExtension, isXMLExtension bool) error {
+	if !e.IsInternal {
+		b, err := newVisibilityManifest(e.Ns, e.Name, e.Version, true, isXMLExtension)
+		if err != nil {
+			return err
+		}
+		if err := updateExtensionAndWait(ctx, cl, b); err != nil {
+			return err
+		}
+	}
+	return deleteExtensionAndWait(ctx, cl, e.Ns, e.Name, e.Version)
+}
+
+// splitVersions splits a comma-separated list of versions.
+func splitVersions(s string) []string {
+	var versions []string
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			versions = append(versions, v)
+		}
+	}
+	return versions
+}
+
+// selectVersions returns the extensions with a version older than olderThan,
+// if set, or else with one of the versions, ordered by version. Every listed
+// version must be published.
+func selectVersions(extensions []PublishedExtension, olderThan string, versions []string) ([]PublishedExtension, error) {
+	var selected []PublishedExtension
+	if olderThan != "" {
+		for _, e := range extensions {
+			cmp, err := compareVersions(e.Version, olderThan)
+			if err != nil {
+				return nil, err
+			}
+			if cmp < 0 {
+				selected = append(selected, e)
+			}
+		}
+	} else {
+		for _, v := range versions {
+			found := false
+			for _, e := range extensions {
+				if e.Version == v {
+					selected = append(selected, e)
+					found = true
+				}
+			}
+			if !found {
+				return nil, errorf(exitCodeNotFound, "Version %s is not published.", v)
+			}
+		}
+	}
+
+	var err error
+	sort.SliceStable(selected, func(i, j int) bool {
+		cmp, cerr := compareVersions(selected[i].Version, selected[j].Version)
+		if cerr != nil {
+			err = cerr
+		}
+		return cmp < 0
+	})
+	return selected, err
+}
+
+// compareVersions compares two dotted numeric versions, e.g. 1.2.3, and
+// returns -1, 0 or 1 if a is older than, equal to or newer than b. Missing
+// components are zero, so 1.2 equals 1.2.0.
+func compareVersions(a, b string) (int, error) {
+	as, bs := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		x, err := versionComponent(as, i, a)
+		if err != nil {
+			return 0, err
+		}
+		y, err := versionComponent(bs, i, b)
+		if err != nil {
+			return 0, err
+		}
+		if x < y {
+			return -1, nil
+		} else if x > y {
+			return 1, nil
+		}
+	}
+	return 0, nil
+}
+
+func versionComponent(components []string, i int, version string) (int, error) {
+	if i >= len(components) {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(components[i])
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid version %q, expected numbers separated by dots", version)
+	}
+	return n, nil
+}
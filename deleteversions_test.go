@@ -0,0 +1,68 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		cmp  int
+	}{
+		{"1.0.0", "1.0.0", 0},
+		{"1.2", "1.2.0", 0},
+		{"1.9.0", "1.10.0", -1},
+		{"2.0", "1.99.99", 1},
+		{"1.0.0.1", "1.0.0", 1},
+	}
+	for _, tt := range tests {
+		cmp, err := compareVersions(tt.a, tt.b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cmp != tt.cmp {
+			t.Errorf("Expected %d comparing %q to %q, but got %d", tt.cmp, tt.a, tt.b, cmp)
+		}
+	}
+
+	if _, err := compareVersions("1.0-beta", "1.0"); err == nil {
+		t.Fatal("Expected an error for a non-numeric version")
+	}
+}
+
+func TestSelectVersions(t *testing.T) {
+	extensions := []PublishedExtension{
+		{Version: "1.10.0"},
+		{Version: "1.2.0"},
+		{Version: "2.0.0"},
+		{Version: "1.9.1"},
+	}
+	versionsOf := func(l []PublishedExtension) []string {
+		var v []string
+		for _, e := range l {
+			v = append(v, e.Version)
+		}
+		return v
+	}
+
+	selected, err := selectVersions(extensions, "2.0", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"1.2.0", "1.9.1", "1.10.0"}; !reflect.DeepEqual(versionsOf(selected), expected) {
+		t.Fatalf("Expected versions %q, but got %q", expected, versionsOf(selected))
+	}
+
+	selected, err = selectVersions(extensions, "", splitVersions("2.0.0, 1.2.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"1.2.0", "2.0.0"}; !reflect.DeepEqual(versionsOf(selected), expected) {
+		t.Fatalf("Expected versions %q, but got %q", expected, versionsOf(selected))
+	}
+
+	if _, err := selectVersions(extensions, "", []string{"3.0.0"}); exitCode(err) != exitCodeNotFound {
+		t.Fatalf("Expected a not found error, but got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/codegangsta/cli"
+	"github.com/olekukonko/tablewriter"
+)
+
+// highRiskFields are the manifest fields whose changes affect where and how
+// the extension is served, and are highlighted in diffs.
+var highRiskFields = map[string]bool{
+	"Version":             true,
+	"MediaLink":           true,
+	"IsInternalExtension": true,
+	"Regions":             true,
+}
+
+// manifestField is a named value of an extension manifest.
+type manifestField struct {
+	name, value string
+}
+
+// fieldDiff is a field whose value differs between two manifests.
+type fieldDiff struct {
+	Field    string
+	Old, New string
+}
+
+func diffManifest(ctx context.Context, c *cli.Context) error {
+	paths := c.StringSlice(flManifests.Name)
+	againstPublished := c.Bool(flAgainstPublished.Name)
+	if againstPublished && len(paths) != 1 {
+		return fmt.Errorf("Exactly one --%s is required with --%s", flManifests.Name, flAgainstPublished.Name)
+	} else if !againstPublished && len(paths) != 2 {
+		return fmt.Errorf("Exactly two --%s are required, or one with --%s", flManifests.Name, flAgainstPublished.Name)
+	}
+
+	var manifests []extensionImage
+	for _, p := range paths {
+		m, err := readManifest(p)
+		if err != nil {
+			return err
+		}
+		manifests = append(manifests, m)
+	}
+
+	var old, new []manifestField
+	if againstPublished {
+		cl, err := mkClient(ctx, c)
+		if err != nil {
+			return err
+		}
+		m := manifests[0]
+		e, err := cl.GetExtension(ctx, m.ProviderNameSpace, m.Type, m.Version)
+		if err != nil {
+			return wrapf(err, "Cannot get published version %s.%s %s: %v", m.ProviderNameSpace, m.Type, m.Version, err)
+		}
+		old, new = publishedFields(e), manifestFields(m)
+	} else {
+		old, new = manifestFields(manifests[0]), manifestFields(manifests[1])
+	}
+
+	diffs := diffManifestFields(old, new)
+	if len(diffs) == 0 {
+		fmt.Println("Manifests are identical.")
+		return nil
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"", "Field", "Old", "New"})
+	data := [][]string{}
+	for _, d := range diffs {
+		marker := ""
+		if highRiskFields[d.Field] {
+			marker = "!"
+		}
+		data = append(data, []string{marker, d.Field, d.Old, d.New})
+	}
+	table.AppendBulk(data)
+	table.Render()
+	return nil
+}
+
+func readManifest(path string) (extensionImage, error) {
+	var m extensionImage
+	b, err := readManifestFile(path)
+	if err != nil {
+		return m, fmt.Errorf("Error reading manifest: %v", err)
+	}
+	if err := xml.Unmarshal(b, &m); err != nil {
+		return m, fmt.Errorf("Error parsing manifest %s: %v", path, err)
+	}
+	return m, nil
+}
+
+// diffManifestFields returns the fields present in both old and new whose
+// values differ, in the order of new.
+func diffManifestFields(old, new []manifestField) []fieldDiff {
+	oldValues := map[string]string{}
+	for _, f := range old {
+		oldValues[f.name] = f.value
+	}
+
+	diffs := []fieldDiff{}
+	for _, f := range new {
+		v, ok := oldValues[f.name]
+		if ok && v != f.value {
+			diffs = append(diffs, fieldDiff{f.name, v, f.value})
+		}
+	}
+	return diffs
+}
+
+func manifestFields(m extensionImage) []manifestField {
+	cert := ""
+	if m.Certificate != nil {
+		cert = fmt.Sprintf("%+v", *m.Certificate)
+	}
+	return []manifestField{
+		{"ProviderNameSpace", m.ProviderNameSpace},
+		{"Type", m.Type},
+		{"Version", m.Version},
+		{"Label", m.Label},
+		{"Description", m.Description},
+		{"MediaLink", m.MediaLink},
+		{"IsInternalExtension", strconv.FormatBool(m.IsInternalExtension)},
+		{"Regions", sortRegions(m.Regions)},
+		{"HostingResources", m.HostingResources},
+		{"Endpoints", m.Endpoints},
+		{"Certificate", cert},
+		{"PublicConfigurationSchema", m.PublicConfigurationSchema},
+		{"PrivateConfigurationSchema", m.PrivateConfigurationSchema},
+		{"LocalResources", m.LocalResources},
+		{"BlockRoleUponFailure", m.BlockRoleUponFailure},
+		{"SampleConfig", m.SampleConfig},
+		{"Eula", m.Eula},
+		{"PrivacyUri", m.PrivacyURI},
+		{"HomepageUri", m.HomepageURI},
+		{"IsJsonExtension", strconv.FormatBool(m.IsJSONExtension)},
+		{"DisallowMajorVersionUpgrade", strconv.FormatBool(m.DisallowMajorVersionUpgrade)},
+		{"CompanyName", m.CompanyName},
+		{"SupportedOS", m.SupportedOS},
+	}
+}
+
+// publishedFields returns the manifest fields the API reports for a
+// published extension version.
+func publishedFields(e PublishedExtension) []manifestField {
+	return []manifestField{
+		{"ProviderNameSpace", e.Ns},
+		{"Type", e.Name},
+		{"Version", e.Version},
+		{"Label", e.Label},
+		{"Description", e.Description},
+		{"MediaLink", e.MediaLink},
+		{"IsInternalExtension", strconv.FormatBool(e.IsInternal)},
+		{"Regions", sortRegions(e.Regions)},
+	}
+}
+
+// sortRegions sorts a ';' separated list of regions, so that the same
+// regions in a different order are not reported as a change.
+func sortRegions(s string) string {
+	if s == "" {
+		return s
+	}
+	regions := strings.Split(s, ";")
+	sort.Strings(regions)
+	return strings.Join(regions, ";")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiffManifestFields(t *testing.T) {
+	old := manifestFields(extensionImage{
+		ProviderNameSpace: "Microsoft.Azure.Extensions",
+		Type:              "CustomScript",
+		Version:           "2.0.1",
+		MediaLink:         "https://example.blob.core.windows.net/packages/1.zip",
+		Regions:           "West US;East US",
+	})
+	new := manifestFields(extensionImage{
+		ProviderNameSpace:   "Microsoft.Azure.Extensions",
+		Type:                "CustomScript",
+		Version:             "2.0.2",
+		MediaLink:           "https://example.blob.core.windows.net/packages/1.zip",
+		Regions:             "East US;West US",
+		IsInternalExtension: true,
+	})
+
+	expected := []fieldDiff{
+		{"Version", "2.0.1", "2.0.2"},
+		{"IsInternalExtension", "false", "true"},
+	}
+	if diffs := diffManifestFields(old, new); !reflect.DeepEqual(diffs, expected) {
+		t.Fatalf("Expected %+v, but got %+v", expected, diffs)
+	}
+}
+
+func TestDiffManifestFieldsAgainstPublishedIgnoresUnknownFields(t *testing.T) {
+	old := publishedFields(PublishedExtension{Ns: "Microsoft.Azure.Extensions", Name: "CustomScript", Version: "2.0.1"})
+	new := manifestFields(extensionImage{
+		ProviderNameSpace: "Microsoft.Azure.Extensions",
+		Type:              "CustomScript",
+		Version:           "2.0.1",
+		CompanyName:       "Microsoft",
+	})
+
+	if diffs := diffManifestFields(old, new); len(diffs) != 0 {
+		t.Fatalf("Expected no differences, but got %+v", diffs)
+	}
+}
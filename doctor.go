@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"crypto/sha1"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/codegangsta/cli"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Statuses of the checks of the doctor command. Only failed checks make it
+// fail, warnings are problems which do not prevent the CLI from working yet.
+const (
+	checkPassed  = "pass"
+	checkWarning = "warn"
+	checkFailed  = "fail"
+	checkSkipped = "skip"
+)
+
+// doctorCheck is the result of a check of the doctor command, with a hint to
+// fix the problem it found, if any.
+type doctorCheck struct {
+	Name    string
+	Status  string
+	Details string
+	Hint    string
+}
+
+func doctor(ctx context.Context, c *cli.Context) error {
+	checks := runDoctorChecks(ctx, c)
+
+	var failed int
+	rows := [][]string{}
+	for _, ch := range checks {
+		color := colorGreen
+		switch ch.Status {
+		case checkFailed:
+			failed++
+			color = colorRed
+		case checkWarning:
+			color = colorYellow
+		case checkSkipped:
+			color = ""
+		}
+		rows = append(rows, []string{ch.Name, colorize(ch.Status, color), ch.Details})
+	}
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetColWidth(4000)
+	table.SetHeader([]string{"Check", "Status", "Details"})
+	table.AppendBulk(rows)
+	table.Render()
+	for _, ch := range checks {
+		if ch.Hint != "" {
+			fmt.Printf("%s: %s\n", ch.Name, ch.Hint)
+		}
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d of %d checks failed", failed, len(checks))
+	}
+	return nil
+}
+
+// runDoctorChecks checks the flags, files and network access the CLI needs to
+// authenticate to the subscription, and then that it does. The flags are not
+// required, so that missing ones are reported as failed checks.
+func runDoctorChecks(ctx context.Context, c *cli.Context) []doctorCheck {
+	var checks []doctorCheck
+	add := func(ch doctorCheck) bool {
+		checks = append(checks, ch)
+		return ch.Status != checkFailed
+	}
+	ok := true
+
+	credentials := "--" + flSubsCert.Name
+	switch {
+	case stringFlag(c, flPublishSettings.Name) != "":
+		credentials = "--" + flPublishSettings.Name
+	case stringFlag(c, flClientID.Name) != "":
+		credentials = "--" + flClientID.Name
+	case stringFlag(c, flCertThumbprint.Name) != "":
+		credentials = "--" + flCertThumbprint.Name
+	}
+
+	if id := stringFlag(c, flSubsID.Name); id == "" && credentials == "--"+flPublishSettings.Name {
+		add(doctorCheck{Name: "Subscription ID", Status: checkSkipped, Details: "First subscription of --" + flPublishSettings.Name})
+	} else {
+		ok = add(checkSubscriptionID(id)) && ok
+	}
+
+	if credentials == "--"+flSubsCert.Name {
+		certFiles := splitSubscriptions(stringFlag(c, flSubsCert.Name))
+		if len(certFiles) == 0 {
+			ok = add(doctorCheck{Name: "Certificate", Status: checkFailed, Details: "No management certificate given",
+				Hint: fmt.Sprintf("Pass the .pem or .pfx management certificate with --%s, or set SUBSCRIPTION_CERT.", flSubsCert.Name)}) && ok
+		}
+		for _, certFile := range certFiles {
+			for _, ch := range checkCertFile(certFile, stringFlag(c, flCertPassword.Name), time.Now(), c.GlobalDuration(flCertExpiryWindow.Name)) {
+				ok = add(ch) && ok
+			}
+		}
+	} else {
+		add(doctorCheck{Name: "Certificate", Status: checkSkipped, Details: "Authenticating with " + credentials})
+	}
+
+	if credentials == "--"+flPublishSettings.Name {
+		add(doctorCheck{Name: "Management endpoint", Status: checkSkipped, Details: "Read from --" + flPublishSettings.Name})
+	} else if env, err := lookupCloud(stringFlag(c, flCloud.Name)); err != nil {
+		ok = add(doctorCheck{Name: "Management endpoint", Status: checkFailed, Details: err.Error()}) && ok
+	} else {
+		ok = add(checkEndpoint(ctx, managementURL(c, env), globalStringFlag(c, flProxy.Name), c.GlobalDuration(flHTTPTimeout.Name))) && ok
+	}
+
+	if !ok {
+		add(doctorCheck{Name: "Authentication", Status: checkSkipped, Details: "Fix the failed checks first"})
+		return checks
+	}
+	add(checkAuthentication(ctx, c))
+	return checks
+}
+
+func checkSubscriptionID(id string) doctorCheck {
+	ch := doctorCheck{Name: "Subscription ID", Status: checkPassed, Details: id}
+	switch {
+	case id == "":
+		ch.Status, ch.Details = checkFailed, "No subscription ID given"
+		ch.Hint = fmt.Sprintf("Pass the ID of the publisher subscription with --%s, or set SUBSCRIPTION_ID.", flSubsID.Name)
+	case !subscriptionIDRegexp.MatchString(id):
+		ch.Status, ch.Details = checkFailed, fmt.Sprintf("%q is not a GUID", id)
+		ch.Hint = "Copy the subscription ID, e.g. 00000000-0000-0000-0000-000000000000, from the Azure portal."
+	}
+	return ch
+}
+
+// checkCertFile checks that the certificate file can be read, and that it is
+// a valid certificate which has not expired, nor expires within window.
+func checkCertFile(certFile, password string, now time.Time, window time.Duration) []doctorCheck {
+	read := doctorCheck{Name: "Certificate file " + certFile, Status: checkPassed, Details: "Readable"}
+	b, err := ioutil.ReadFile(certFile)
+	if err != nil {
+		read.Status, read.Details = checkFailed, err.Error()
+		read.Hint = "Check the path of the certificate file, and that it is readable by the current user."
+		return []doctorCheck{read}
+	}
+
+	valid := doctorCheck{Name: "Certificate " + certFile, Status: checkPassed}
+	pemBytes, err := decodeCert(b, isPFXFile(certFile), password)
+	if err == nil {
+		var keyPair tls.Certificate
+		if keyPair, err = tls.X509KeyPair(pemBytes, pemBytes); err == nil {
+			var cert *x509.Certificate
+			if cert, err = x509.ParseCertificate(keyPair.Certificate[0]); err == nil {
+				thumbprint := fmt.Sprintf("%X", sha1.Sum(keyPair.Certificate[0]))
+				valid.Details = fmt.Sprintf("Thumbprint %s, expires on %s", thumbprint, cert.NotAfter.UTC().Format("2006-01-02"))
+				if msg := certExpiry(thumbprint, cert.NotAfter, now, window); msg != "" {
+					valid.Status, valid.Details = checkWarning, msg
+					if !now.Before(cert.NotAfter) {
+						valid.Status = checkFailed
+					}
+				}
+			}
+		}
+	}
+	if err != nil {
+		valid.Status, valid.Details = checkFailed, err.Error()
+		valid.Hint = "The management certificate must hold both the certificate and its private key, " +
+			"e.g. create one with 'openssl req -x509 -newkey rsa:2048 -nodes -keyout cert.pem -out cert.pem'."
+	}
+	return []doctorCheck{read, valid}
+}
+
+// checkEndpoint checks that the management endpoint can be reached, whatever
+// it responds to an unauthenticated request.
+func checkEndpoint(ctx context.Context, endpoint, proxy string, timeout time.Duration) doctorCheck {
+	ch := doctorCheck{Name: "Management endpoint", Status: checkPassed}
+	var proxyURL *url.URL
+	if proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" {
+			ch.Status, ch.Details = checkFailed, fmt.Sprintf("Invalid proxy URL %q", proxy)
+			return ch
+		}
+		proxyURL = u
+	}
+	client := newHTTPClient(proxyURL, nil)
+	client.Timeout = timeout
+
+	req, err := http.NewRequest("HEAD", endpoint, nil)
+	if err == nil {
+		var resp *http.Response
+		if resp, err = client.Do(req.WithContext(ctx)); err == nil {
+			resp.Body.Close()
+			ch.Details = fmt.Sprintf("%s is reachable", endpoint)
+			return ch
+		}
+	}
+	ch.Status, ch.Details = checkFailed, err.Error()
+	ch.Hint = fmt.Sprintf("Check the network access to %s, e.g. pass --%s behind a proxy, or --%s for a non-public cloud.", endpoint, flProxy.Name, flCloud.Name)
+	return ch
+}
+
+// checkAuthentication checks that the credentials authenticate to the
+// subscription, like whoami.
+func checkAuthentication(ctx context.Context, c *cli.Context) doctorCheck {
+	ch := doctorCheck{Name: "Authentication", Status: checkPassed}
+	cl, err := mkClient(ctx, c)
+	if err == nil {
+		_, err = cl.ListLocations(ctx)
+	}
+	switch {
+	case isAuthError(err):
+		ch.Status, ch.Details = checkFailed, err.Error()
+		ch.Hint = "Upload the management certificate to the subscription in the Azure portal, " +
+			"or check that --" + flSubsID.Name + " is the subscription it was uploaded to."
+	case err != nil:
+		ch.Status, ch.Details = checkFailed, err.Error()
+	default:
+		ch.Details = "Authenticated to subscription " + cl.SubscriptionID()
+	}
+	return ch
+}
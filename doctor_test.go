@@ -0,0 +1,122 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/codegangsta/cli"
+)
+
+func TestCheckSubscriptionID(t *testing.T) {
+	for id, status := range map[string]string{
+		"00000000-0000-0000-0000-000000000000": checkPassed,
+		"0F1E2D3C-4B5A-6978-8796-A5B4C3D2E1F0": checkPassed,
+		"":                                     checkFailed,
+		"my-subscription":                      checkFailed,
+		"00000000-0000-0000-0000-00000000000":  checkFailed,
+	} {
+		if ch := checkSubscriptionID(id); ch.Status != status {
+			t.Errorf("%q: expected %s, but got %+v", id, status, ch)
+		}
+	}
+}
+
+func TestCheckCertFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile, garbage := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "garbage.pem")
+	if err := ioutil.WriteFile(certFile, testCert(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(garbage, []byte("not a certificate"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		certFile string
+		now      time.Time
+		window   time.Duration
+		statuses []string
+	}{
+		{certFile, time.Now(), 0, []string{checkPassed, checkPassed}},
+		{certFile, time.Now(), 24 * time.Hour, []string{checkPassed, checkWarning}},
+		{certFile, time.Now().Add(2 * time.Hour), 0, []string{checkPassed, checkFailed}},
+		{garbage, time.Now(), 0, []string{checkPassed, checkFailed}},
+		{filepath.Join(dir, "missing.pem"), time.Now(), 0, []string{checkFailed}},
+	} {
+		var statuses []string
+		for _, ch := range checkCertFile(tc.certFile, "", tc.now, tc.window) {
+			statuses = append(statuses, ch.Status)
+		}
+		if !reflect.DeepEqual(statuses, tc.statuses) {
+			t.Errorf("%s at %v: expected %v, but got %v", tc.certFile, tc.now, tc.statuses, statuses)
+		}
+	}
+}
+
+func TestRunDoctorChecks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "doctor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	if err := ioutil.WriteFile(certFile, testCert(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, authenticated := range []bool{true, false} {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !authenticated {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Write([]byte(`<Locations xmlns="http://schemas.microsoft.com/windowsazure"></Locations>`))
+		}))
+
+		global := flag.NewFlagSet("global", flag.ContinueOnError)
+		global.Duration(flCertExpiryWindow.Name, 0, "")
+		global.Duration(flHTTPTimeout.Name, time.Minute, "")
+		global.String(flProxy.Name, "", "")
+		global.String(flAPIVersion.Name, apiVersion, "")
+		set := flag.NewFlagSet("doctor", flag.ContinueOnError)
+		for name, value := range map[string]string{
+			"management-url":       srv.URL,
+			flCloud.Name:           defaultCloud,
+			flSubsID.Name:          "00000000-0000-0000-0000-000000000000",
+			flSubsCert.Name:        certFile,
+			flCertThumbprint.Name:  "",
+			flCertPassword.Name:    "",
+			flPublishSettings.Name: "",
+			flClientID.Name:        "",
+		} {
+			set.String(name, value, "")
+		}
+		c := cli.NewContext(nil, set, cli.NewContext(nil, global, nil))
+
+		checks := runDoctorChecks(context.Background(), c)
+		srv.Close()
+		var statuses []string
+		for _, ch := range checks {
+			statuses = append(statuses, ch.Status)
+		}
+		auth := checkPassed
+		if !authenticated {
+			auth = checkFailed
+		}
+		if expected := []string{checkPassed, checkPassed, checkPassed, checkPassed, auth}; !reflect.DeepEqual(statuses, expected) {
+			t.Fatalf("authenticated=%v: expected %v, but got %+v", authenticated, expected, checks)
+		}
+	}
+}
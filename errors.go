@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/Azure/azure-sdk-for-go/management"
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+// Exit codes of the CLI, so that scripts can branch on the class of failure.
+const (
+	exitCodeError            = 1
+	exitCodeAuthFailure      = 2
+	exitCodeNotFound         = 3
+	exitCodeOperationFailure = 4
+)
+
+// exitError is an error that terminates the CLI with a specific exit code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e exitError) Error() string {
+	return e.err.Error()
+}
+
+// errorf formats an error that terminates the CLI with the given exit code.
+func errorf(code int, format string, a ...interface{}) error {
+	return exitError{code, fmt.Errorf(format, a...)}
+}
+
+// wrapf formats an error describing err, preserving the exit code err maps to.
+func wrapf(err error, format string, a ...interface{}) error {
+	return errorf(exitCode(err), format, a...)
+}
+
+// exitCode returns the exit code for the class of failure err belongs to.
+func exitCode(err error) int {
+	if e, ok := err.(exitError); ok {
+		return e.code
+	}
+	if err == ErrExtensionNotFound || management.IsResourceNotFoundError(err) {
+		return exitCodeNotFound
+	}
+	var code string
+	switch e := err.(type) {
+	case APIError:
+		switch e.StatusCode {
+		case http.StatusNotFound:
+			return exitCodeNotFound
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return exitCodeAuthFailure
+		}
+		code = e.Code
+	case management.AzureError:
+		code = e.Code
+	}
+	switch code {
+	case "ResourceNotFound":
+		return exitCodeNotFound
+	case "AuthenticationFailed", "ForbiddenError":
+		return exitCodeAuthFailure
+	}
+	return exitCodeError
+}
+
+// isAuthError reports whether err is an authentication failure.
+func isAuthError(err error) bool {
+	return err != nil && exitCode(err) == exitCodeAuthFailure
+}
+
+// action adapts a command returning an error to the signature expected by the
+// cli package, and runs it with the root context. Errors are logged and
+// terminate the CLI with their exit code.
+func action(fn func(context.Context, *cli.Context) error) func(*cli.Context) {
+	return func(c *cli.Context) {
+		logContext.set("command", c.Command.Name)
+		if err := fn(rootContext, c); err != nil {
+			log.Error(err)
+			os.Exit(exitCode(err))
+		}
+	}
+}
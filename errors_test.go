@@ -0,0 +1,32 @@
+package main
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/management"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		code int
+	}{
+		{errors.New("generic"), exitCodeError},
+		{errorf(exitCodeOperationFailure, "operation failed"), exitCodeOperationFailure},
+		{ErrExtensionNotFound, exitCodeNotFound},
+		{management.AzureError{Code: "ResourceNotFound"}, exitCodeNotFound},
+		{management.AzureError{Code: "ForbiddenError"}, exitCodeAuthFailure},
+		{wrapf(management.AzureError{Code: "AuthenticationFailed"}, "wrapped"), exitCodeAuthFailure},
+		{APIError{StatusCode: 404, Code: "ResourceNotFound"}, exitCodeNotFound},
+		{APIError{StatusCode: 403, Code: "ForbiddenError"}, exitCodeAuthFailure},
+		{APIError{StatusCode: 409, Code: "ConflictError"}, exitCodeError},
+		{APIError{StatusCode: 401}, exitCodeAuthFailure},
+	}
+
+	for _, tt := range tests {
+		if code := exitCode(tt.err); code != tt.code {
+			t.Errorf("Expected exit code %d for %q, but got %d", tt.code, tt.err, code)
+		}
+	}
+}
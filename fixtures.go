@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// subscriptionPlaceholder replaces the subscription ID in the path of
+// recorded requests, so that fixtures can be replayed with any subscription.
+const subscriptionPlaceholder = "{subscription}"
+
+// fixtureHeaders are the response headers kept in fixtures.
+var fixtureHeaders = []string{"Content-Type", "Location", requestIDHeader}
+
+// redactedTokenFields are the fields of Azure AD token responses holding
+// tokens, which are not recorded.
+var redactedTokenFields = []string{"access_token", "refresh_token"}
+
+// fixture is an ASM request and the response Azure sent to it. Request
+// headers and bodies are not recorded, since they may hold credentials.
+type fixture struct {
+	Method     string            `json:"method"`
+	Path       string            `json:"path"`
+	StatusCode int               `json:"statusCode"`
+	Header     map[string]string `json:"header,omitempty"`
+	Body       string            `json:"body"`
+}
+
+// fixturePath returns the path of the request relative to the subscription,
+// with its query.
+func fixturePath(req *http.Request) string {
+	p := req.URL.Path
+	if parts := strings.SplitN(strings.TrimPrefix(p, "/"), "/", 2); len(parts) == 2 {
+		p = "/" + subscriptionPlaceholder + "/" + parts[1]
+	}
+	if req.URL.RawQuery != "" {
+		p += "?" + req.URL.RawQuery
+	}
+	return p
+}
+
+// redactToken returns the body of an Azure AD token response with its tokens
+// redacted, or no body at all if it cannot be parsed.
+func redactToken(b []byte) string {
+	var token map[string]interface{}
+	if err := json.Unmarshal(b, &token); err != nil {
+		return ""
+	}
+	for _, k := range redactedTokenFields {
+		if _, ok := token[k]; ok {
+			token[k] = "REDACTED"
+		}
+	}
+	out, err := json.Marshal(token)
+	if err != nil {
+		return ""
+	}
+	return string(out)
+}
+
+// recordingTransport is an http.RoundTripper saving the responses it
+// receives as fixtures in dir, one JSON file per request in the order they
+// were sent.
+type recordingTransport struct {
+	transport http.RoundTripper
+	dir       string
+
+	mu *sync.Mutex
+	n  *int
+}
+
+func newRecordingTransport(transport http.RoundTripper, dir string) recordingTransport {
+	return recordingTransport{transport: transport, dir: dir, mu: &sync.Mutex{}, n: new(int)}
+}
+
+func (t recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	b, err := readResponseBody(resp)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(b))
+
+	f := fixture{Method: req.Method, Path: fixturePath(req), StatusCode: resp.StatusCode, Header: map[string]string{}, Body: string(b)}
+	if isTokenRequest(req) {
+		f.Body = redactToken(b)
+	}
+	for _, h := range fixtureHeaders {
+		if v := resp.Header.Get(h); v != "" {
+			f.Header[h] = v
+		}
+	}
+	out, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if err := os.MkdirAll(t.dir, 0700); err != nil {
+		return nil, fmt.Errorf("Cannot create fixtures directory: %v", err)
+	}
+	*t.n++
+	name := filepath.Join(t.dir, fmt.Sprintf("%03d-%s.json", *t.n, strings.ToLower(req.Method)))
+	if err := ioutil.WriteFile(name, out, 0600); err != nil {
+		return nil, fmt.Errorf("Cannot record fixture: %v", err)
+	}
+	return resp, nil
+}
+
+// replayTransport is an http.RoundTripper answering requests with the
+// fixtures recorded in a directory, instead of sending them to Azure.
+// Fixtures of the same request are replayed in the order they were recorded,
+// and the last one is repeated, e.g. while polling an operation.
+type replayTransport struct {
+	mu       sync.Mutex
+	fixtures map[string][]fixture
+}
+
+func newReplayTransport(dir string) (*replayTransport, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	t := &replayTransport{fixtures: map[string][]fixture{}}
+	for _, file := range files {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var f fixture
+		if err := json.Unmarshal(b, &f); err != nil {
+			return nil, fmt.Errorf("Error parsing fixture %s: %v", file, err)
+		}
+		key := f.Method + " " + f.Path
+		t.fixtures[key] = append(t.fixtures[key], f)
+	}
+	return t, nil
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	key := req.Method + " " + fixturePath(req)
+
+	t.mu.Lock()
+	fixtures := t.fixtures[key]
+	if len(fixtures) == 0 {
+		t.mu.Unlock()
+		return nil, fmt.Errorf("No fixture recorded for %s", key)
+	}
+	f := fixtures[0]
+	if len(fixtures) > 1 {
+		t.fixtures[key] = fixtures[1:]
+	}
+	t.mu.Unlock()
+
+	resp := &http.Response{
+		Status:     fmt.Sprintf("%d %s", f.StatusCode, http.StatusText(f.StatusCode)),
+		StatusCode: f.StatusCode,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(f.Body)),
+		Request:    req,
+	}
+	for h, v := range f.Header {
+		resp.Header.Set(h, v)
+	}
+	return resp, nil
+}
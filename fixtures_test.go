@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// replayClient returns a client answering requests with the fixtures
+// recorded in testdata/fixtures/<name>.
+func replayClient(t *testing.T, name string) ExtensionsClient {
+	tr, err := newReplayTransport(filepath.Join("testdata", "fixtures", name))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl, err := NewClient("subscription-id", testCert(t), ClientConfig{ManagementURL: "https://management.core.windows.net"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.client.httpClient.Transport = tr
+	return cl
+}
+
+func TestListVersionsFixtures(t *testing.T) {
+	l, err := replayClient(t, "list-versions").ListVersions(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []PublishedExtension{
+		{Ns: "Microsoft.Azure.Extensions", Name: "CustomScript", Version: "2.0.1", Label: "Custom Script", Description: "Runs scripts on Linux VMs",
+			MediaLink: "https://example.blob.core.windows.net/extension-packages/customscript-2.0.1.zip", ReplicationCompleted: true, Regions: "West US;East US", PublishedDate: "2017-03-01T18:04:12.3Z"},
+		{Ns: "Microsoft.Azure.Extensions", Name: "CustomScript", Version: "2.0.2", Label: "Custom Script", Description: "Runs scripts on Linux VMs",
+			MediaLink: "https://example.blob.core.windows.net/extension-packages/customscript-2.0.2.zip", IsInternal: true},
+	}
+	if len(l.Extensions) != len(tests) {
+		t.Fatalf("Expected %d extensions, but got %d", len(tests), len(l.Extensions))
+	}
+	for i, expected := range tests {
+		if !reflect.DeepEqual(l.Extensions[i], expected) {
+			t.Errorf("Expected %+v, but got %+v", expected, l.Extensions[i])
+		}
+	}
+}
+
+func TestGetReplicationStatusFixtures(t *testing.T) {
+	cl := replayClient(t, "replication-status")
+
+	tests := []struct {
+		version  string
+		statuses []ReplicationStatus
+		exitCode int
+	}{
+		{"2.0.2", []ReplicationStatus{{Location: "West US", Status: "Completed"}, {Location: "East US", Status: "Replicating"}}, 0},
+		{"9.9.9", nil, exitCodeNotFound},
+	}
+	for _, tt := range tests {
+		r, err := cl.GetReplicationStatus(context.Background(), "Microsoft.Azure.Extensions", "CustomScript", tt.version)
+		if tt.exitCode != 0 {
+			if exitCode(err) != tt.exitCode {
+				t.Errorf("Expected exit code %d for version %s, but got %v", tt.exitCode, tt.version, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(r.Statuses, tt.statuses) {
+			t.Errorf("Expected statuses %+v for version %s, but got %+v", tt.statuses, tt.version, r.Statuses)
+		}
+	}
+}
+
+func TestRecordingTransportReplays(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(requestIDHeader, "request-id")
+		w.Write([]byte(`<Locations xmlns="http://schemas.microsoft.com/windowsazure"><Location><Name>West US</Name><DisplayName>West US</DisplayName></Location></Locations>`))
+	})
+	cl.client.httpClient.Transport = newRecordingTransport(cl.client.httpClient.Transport, dir)
+	recorded, err := cl.ListLocations(context.Background())
+	done()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := newReplayTransport(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cl.client.httpClient.Transport = tr
+	cl.cache = &clientCache{}
+	replayed, err := cl.ListLocations(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(recorded, replayed) {
+		t.Fatalf("Expected %+v, but got %+v", recorded, replayed)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+// Severities of the issues found by lint-manifest.
+const (
+	severityWarning = "warning"
+	severityInfo    = "info"
+)
+
+// maxLintRegions is the number of regions above which a manifest is reported
+// as publishing to a suspiciously large set of regions at once.
+const maxLintRegions = 20
+
+// lintIssue is a soft issue of a manifest, which Azure accepts but which
+// likely makes for a worse release.
+type lintIssue struct {
+	Severity string
+	Message  string
+}
+
+// lintManifest returns the soft issues of a manifest, which must be valid.
+func lintManifest(b []byte) ([]lintIssue, error) {
+	var m extensionImage
+	if err := xml.Unmarshal(b, &m); err != nil {
+		return nil, fmt.Errorf("Error parsing manifest: %v", err)
+	}
+
+	var issues []lintIssue
+	add := func(severity, format string, args ...interface{}) {
+		issues = append(issues, lintIssue{severity, fmt.Sprintf(format, args...)})
+	}
+
+	if strings.TrimSpace(m.Description) == "" {
+		add(severityWarning, "Description is empty")
+	}
+	if strings.EqualFold(strings.TrimSpace(m.Label), m.Type) {
+		add(severityInfo, "Label %q is the same as Type, use a human readable name", m.Label)
+	}
+	for _, f := range []struct{ field, value string }{
+		{"Eula", m.Eula},
+		{"PrivacyUri", m.PrivacyURI},
+		{"HomepageUri", m.HomepageURI},
+	} {
+		if f.value == "" {
+			if f.field != "HomepageUri" {
+				add(severityWarning, "%s is missing", f.field)
+			}
+			continue
+		}
+		if u, err := url.Parse(f.value); err != nil || u.Scheme != "https" {
+			add(severityWarning, "%s %q is not an https URL", f.field, f.value)
+		}
+	}
+	if m.Regions != "" {
+		if n := len(strings.Split(m.Regions, ";")); n > maxLintRegions {
+			add(severityInfo, "Regions lists %d regions, consider publishing to fewer regions first", n)
+		}
+	}
+	return issues, nil
+}
+
+func lintManifestFile(ctx context.Context, c *cli.Context) error {
+	manifest, err := checkFlag(c, flManifest.Name)
+	if err != nil {
+		return err
+	}
+	b, err := readManifestFile(manifest)
+	if err != nil {
+		return fmt.Errorf("Error reading manifest: %v", err)
+	}
+	if err := validateManifest(b); err != nil {
+		return err
+	}
+	issues, err := lintManifest(b)
+	if err != nil {
+		return err
+	}
+	for _, i := range issues {
+		fmt.Printf("%-7s  %s\n", i.Severity, i.Message)
+	}
+	if len(issues) == 0 {
+		log.Infof("Manifest %s has no issues.", manifest)
+		return nil
+	}
+	if c.Bool(flStrict.Name) {
+		return fmt.Errorf("Manifest %s has %d issues (--%s)", manifest, len(issues), flStrict.Name)
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLintManifest(t *testing.T) {
+	clean := `<ExtensionImage><ProviderNameSpace>Microsoft.Azure.Extensions</ProviderNameSpace><Type>CustomScript</Type><Version>2.0.1</Version>` +
+		`<Label>Custom Script</Label><Description>Runs scripts on Linux VMs</Description><MediaLink>https://example.blob.core.windows.net/p/customscript.zip</MediaLink>` +
+		`<Eula>https://example.com/eula</Eula><PrivacyUri>https://example.com/privacy</PrivacyUri></ExtensionImage>`
+	issues, err := lintManifest([]byte(clean))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(issues) != 0 {
+		t.Fatalf("Expected no issues, but got %+v", issues)
+	}
+
+	regions := strings.Repeat("West US;", maxLintRegions) + "East US"
+	sloppy := `<ExtensionImage><ProviderNameSpace>Microsoft.Azure.Extensions</ProviderNameSpace><Type>CustomScript</Type><Version>2.0.1</Version>` +
+		`<Label>customscript</Label><Description> </Description><MediaLink>https://example.blob.core.windows.net/p/customscript.zip</MediaLink>` +
+		`<PrivacyUri>https://example.com/privacy</PrivacyUri><Regions>` + regions + `</Regions></ExtensionImage>`
+	issues, err = lintManifest([]byte(sloppy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []lintIssue{
+		{severityWarning, "Description is empty"},
+		{severityInfo, `Label "customscript" is the same as Type, use a human readable name`},
+		{severityWarning, "Eula is missing"},
+		{severityInfo, "Regions lists 21 regions, consider publishing to fewer regions first"},
+	}
+	if !reflect.DeepEqual(issues, expected) {
+		t.Fatalf("Expected %+v, but got %+v", expected, issues)
+	}
+}
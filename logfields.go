@@ -0,0 +1,52 @@
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+// contextHook adds the fields describing what the CLI is doing, e.g. the
+// command, to every log entry, so that logs ingested by log aggregators can
+// be filtered by them. Fields set on an entry take precedence.
+type contextHook struct {
+	mu     sync.Mutex
+	fields log.Fields
+}
+
+// logContext holds the fields added to log entries in JSON format.
+var logContext = &contextHook{fields: log.Fields{}}
+
+// set adds a field to the log entries logged from now on.
+func (h *contextHook) set(key string, value interface{}) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.fields[key] = value
+}
+
+func (h *contextHook) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel, log.InfoLevel, log.DebugLevel}
+}
+
+func (h *contextHook) Fire(e *log.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	// The data of an entry is shared with the entries derived from it, copy
+	// it rather than adding to it.
+	data := make(log.Fields, len(e.Data)+len(h.fields))
+	for k, v := range h.fields {
+		data[k] = v
+	}
+	for k, v := range e.Data {
+		data[k] = v
+	}
+	e.Data = data
+	return nil
+}
+
+// subscriptionHash identifies a subscription in logs without revealing its ID.
+func subscriptionHash(subscriptionID string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(subscriptionID)))[:12]
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+)
+
+func TestContextHookAddsFields(t *testing.T) {
+	var buf bytes.Buffer
+	h := &contextHook{fields: log.Fields{}}
+	logger := log.New()
+	logger.Out = &buf
+	logger.Formatter = &log.JSONFormatter{}
+	logger.Hooks.Add(h)
+
+	h.set("command", "publish-version")
+	h.set("subscription", subscriptionHash("subscription-id"))
+	logger.WithField("x-ms-operation-id", "operation-id").Info("Operation started.")
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	for k, v := range map[string]string{
+		"command":           "publish-version",
+		"subscription":      subscriptionHash("subscription-id"),
+		"x-ms-operation-id": "operation-id",
+	} {
+		if entry[k] != v {
+			t.Fatalf("Expected %s=%q, but got %v", k, v, entry)
+		}
+	}
+}
+
+func TestSubscriptionHash(t *testing.T) {
+	h := subscriptionHash("00000000-0000-0000-0000-000000000000")
+	if len(h) != 12 || h == subscriptionHash("00000000-0000-0000-0000-000000000001") {
+		t.Fatalf("Unexpected subscription hash %q", h)
+	}
+}
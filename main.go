@@ -1,15 +1,18 @@
 package main
 
 import (
-	"bytes"
-	"encoding/pem"
-	"io/ioutil"
+	"context"
+	"fmt"
+	"net/url"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/management"
 	"github.com/Azure/azure-sdk-for-go/storage"
 	"github.com/codegangsta/cli"
-	"golang.org/x/crypto/pkcs12"
 
 	log "github.com/Sirupsen/logrus"
 )
@@ -17,10 +20,30 @@ import (
 var (
 	// GitSummary contains version info, provided by govvv at compile time
 	GitSummary string
+	// GitCommit is the hash of the commit the CLI was built from, provided
+	// by govvv at compile time
+	GitCommit string
+	// BuildDate is the UTC date the CLI was built, provided by govvv at
+	// compile time
+	BuildDate string
+
+	// rootContext is the context commands run with, which is cancelled when
+	// the CLI is interrupted.
+	rootContext = context.Background()
+)
+
+// Development and debugging settings are environment variables rather than
+// flags, so that they do not show in the help.
+const (
+	// envRecordFixtures is the directory the responses from Azure are saved
+	// to as test fixtures.
+	envRecordFixtures = "AZURE_EXTENSIONS_CLI_RECORD_FIXTURES"
+	// envInsecureSkipVerify disables the verification of the TLS
+	// certificates of Azure endpoints when set to true.
+	envInsecureSkipVerify = "AZURE_EXTENSIONS_CLI_INSECURE_SKIP_VERIFY"
 )
 
 func init() {
-	log.SetLevel(log.DebugLevel)
 	log.SetOutput(os.Stderr)
 }
 
@@ -29,31 +52,107 @@ var (
 	flPackage = cli.StringFlag{
 		Name:  "package",
 		Usage: "Path of extension package (.zip)"}
+	flBlobURL = cli.StringFlag{
+		Name:  "blob-url",
+		Usage: "URL of an already uploaded extension package (.zip)"}
+	flBlobBaseURL = cli.StringFlag{
+		Name:  "blob-base-url",
+		Usage: "Base URL, e.g. of a storage container, of the uploaded extension package named by --blob-name, instead of --blob-url"}
+	flBlobName = cli.StringFlag{
+		Name:  "blob-name",
+		Usage: "Name of the uploaded extension package blob under --blob-base-url"}
 	flManifest = cli.StringFlag{
 		Name:  "manifest",
-		Usage: "Path of extension manifest file (XML output of 'new-extension-manifest')"}
+		Usage: "Path of extension manifest file (XML output of 'new-extension-manifest'), or - to read it from stdin"}
+	flManifests = cli.StringSliceFlag{
+		Name:  "manifest",
+		Usage: "Path of an extension manifest file, can be repeated",
+	}
+	flAgainstPublished = cli.BoolFlag{
+		Name:  "against-published",
+		Usage: "Compare the manifest to the published version it describes"}
+	flSchema = cli.StringFlag{
+		Name:  "schema",
+		Usage: "Path of the JSON Schema of the handler settings"}
+	flSettings = cli.StringFlag{
+		Name:  "settings",
+		Usage: "Path of sample handler settings in JSON"}
 	flMgtURL = cli.StringFlag{
-		Name:   "management-url",
-		Usage:  "Azure Management URL for a non-public Azure cloud",
-		Value:  management.DefaultAzureManagementURL,
-		EnvVar: "MANAGEMENT_URL"}
+		Name:   "management-url, management-endpoint",
+		Usage:  "Azure Management URL for a non-public Azure cloud, overrides the URL of --cloud",
+		EnvVar: "MANAGEMENT_URL,AZURE_MANAGEMENT_ENDPOINT"}
+	flCloud = cli.StringFlag{
+		Name:  "cloud",
+		Usage: "Azure cloud: AzurePublicCloud, AzureChinaCloud, AzureUSGovernment or AzureGermanCloud",
+		Value: defaultCloud}
 	flStorageRealm = cli.StringFlag{
 		Name:   "storage-base-url",
 		Usage:  "Azure Storage base URL",
 		Value:  storage.DefaultBaseURL,
 		EnvVar: "STORAGE_BASE_URL"}
+	flStorageKey = cli.StringFlag{
+		Name:   "storage-key",
+		Usage:  "Access key of the storage account, fetched from the publisher subscription if not provided",
+		EnvVar: "STORAGE_KEY"}
+	flContainer = cli.StringFlag{
+		Name:  "container",
+		Usage: "Name of the blob container to upload the extension package to",
+		Value: containerName}
 	flSubsID = cli.StringFlag{
 		Name:   "subscription-id",
-		Usage:  "Subscription ID for the publisher subscription",
-		EnvVar: "SUBSCRIPTION_ID",
+		Usage:  "Subscription ID for the publisher subscription, or comma-separated IDs for list-versions and replication-status",
+		EnvVar: "SUBSCRIPTION_ID,AZURE_SUBSCRIPTION_ID",
 	}
 	flSubsCert = cli.StringFlag{
 		Name:   "subscription-cert",
-		Usage:  "Path of subscription management certificate (.pem or .pfx) file",
-		EnvVar: "SUBSCRIPTION_CERT"}
+		Usage:  "Path of subscription management certificate (.pem or .pfx) file, or comma-separated paths tried in order",
+		EnvVar: "SUBSCRIPTION_CERT,AZURE_SUBSCRIPTION_CERT"}
+	flCertThumbprint = cli.StringFlag{
+		Name:   "cert-thumbprint",
+		Usage:  "Thumbprint of the subscription management certificate in the certificate store of the current user (Windows only), used instead of --subscription-cert",
+		EnvVar: "AZURE_CERT_THUMBPRINT"}
+	flCertPassword = cli.StringFlag{
+		Name:   "cert-password",
+		Usage:  "Password of an encrypted subscription management certificate (.pem or .pfx)",
+		EnvVar: "AZURE_CERT_PASSWORD"}
+	flPublishSettings = cli.StringFlag{
+		Name:   "publish-settings",
+		Usage:  "Path of .publishsettings file, used instead of the subscription certificate",
+		EnvVar: "PUBLISH_SETTINGS,AZURE_PUBLISH_SETTINGS"}
+	flTenantID = cli.StringFlag{
+		Name:   "tenant-id",
+		Usage:  "Azure AD tenant of the service principal, used instead of the subscription certificate",
+		EnvVar: "AZURE_TENANT_ID"}
+	flClientID = cli.StringFlag{
+		Name:   "client-id",
+		Usage:  "Application ID of the service principal",
+		EnvVar: "AZURE_CLIENT_ID"}
+	flClientSecret = cli.StringFlag{
+		Name:   "client-secret",
+		Usage:  "Secret of the service principal",
+		EnvVar: "AZURE_CLIENT_SECRET"}
 	flVersion = cli.StringFlag{
 		Name:  "version",
 		Usage: "Version of the extension package e.g. 1.0.0"}
+	flBump = cli.StringFlag{
+		Name:  "bump",
+		Usage: "Version component to increment: major, minor or patch",
+		Value: "patch"}
+	flAllowDowngrade = cli.BoolFlag{
+		Name:  "allow-downgrade",
+		Usage: "Publish the version even if a newer version is already published"}
+	flSummary = cli.BoolFlag{
+		Name:  "summary",
+		Usage: "Print the name, status and duration of each step once done, as a table or with --output"}
+	flStrict = cli.BoolFlag{
+		Name:  "strict",
+		Usage: "Fail if any issue is found"}
+	flShowManifest = cli.BoolFlag{
+		Name:  "show-manifest",
+		Usage: "Print the manifest stored by Azure once published"}
+	flSourceVersion = cli.StringFlag{
+		Name:  "source-version",
+		Usage: "Published version of the extension to copy"}
 	flNamespace = cli.StringFlag{
 		Name:   "namespace",
 		Usage:  "Publisher namespace e.g. Microsoft.Azure.Extensions",
@@ -69,125 +168,648 @@ var (
 		Name:  "region",
 		Usage: "List of one or more regions to rollout an extension (e.g. 'Japan East')",
 	}
+	flRegions = cli.StringFlag{
+		Name:  "regions",
+		Usage: "Comma-separated list of regions to rollout an extension (e.g. 'Japan East,West US')",
+	}
+	flRegionFile = cli.StringFlag{
+		Name:  "region-file",
+		Usage: "Path of a file of one region per line, instead of --regions. Blank lines and lines starting with '#' are ignored",
+	}
+	flRing = cli.StringFlag{
+		Name:  "ring",
+		Usage: "Name of a rollout ring, e.g. canary, whose regions are defined as 'ring.<name>: <regions>' in the config file, instead of --regions",
+	}
+	flExpectedRegions = cli.StringFlag{
+		Name:  "expected-regions",
+		Usage: "Comma-separated list of the regions a version should be replicated to (e.g. 'Japan East,West US')",
+	}
 	flJSON = cli.BoolFlag{
 		Name:  "json",
 		Usage: "Print output as JSON"}
+	flOutput = cli.StringFlag{
+		Name:  "output, o",
+		Usage: "Output format: table, json or csv",
+		Value: "table"}
+	flWait = cli.BoolFlag{
+		Name:  "wait",
+		Usage: "Poll until replication reaches a terminal state in all locations"}
+	flWaitReplication = cli.BoolFlag{
+		Name:  "wait-replication",
+		Usage: "Once published, poll until replication reaches a terminal state in all locations, within --operation-timeout"}
+	flWaitOperation = cli.BoolTFlag{
+		Name:  "wait",
+		Usage: "Wait for the operation to complete. With --wait=false, print its ID and exit once it started"}
+	flSince = cli.DurationFlag{
+		Name:  "since",
+		Usage: "How far back to list operations, at most 2160h (90 days)",
+		Value: 7 * 24 * time.Hour}
+	flLimit = cli.IntFlag{
+		Name:  "limit",
+		Usage: "Maximum number of operations to list, newest first, or 0 for all",
+		Value: 20}
+	flSelect = cli.StringFlag{
+		Name:  "select",
+		Usage: "Comma-separated fields of each version to print as JSON, e.g. Ns,Version,ReplicationCompleted"}
+	flWatch = cli.BoolFlag{
+		Name:  "watch",
+		Usage: "Refresh the table every --interval until interrupted"}
+	flWatchInterval = cli.DurationFlag{
+		Name:  "interval",
+		Usage: "Interval between refreshes with --watch",
+		Value: time.Second * 30}
+	flPollInterval = cli.DurationFlag{
+		Name:  "poll-interval",
+		Usage: "Interval between replication status checks when waiting",
+		Value: time.Second * 30}
+	flStallPolls = cli.IntFlag{
+		Name:  "stall-polls",
+		Usage: "Warn when replication made no progress for this many polls when waiting, 0 to disable",
+		Value: 5}
+	flAll = cli.BoolFlag{
+		Name:  "all",
+		Usage: "Show the replication status of every published version"}
+	flConcurrency = cli.IntFlag{
+		Name:  "concurrency",
+		Usage: "Maximum number of concurrent requests",
+		Value: 8}
+	flManifestDir = cli.StringFlag{
+		Name:  "manifest-dir",
+		Usage: "Directory of the *.xml extension manifests to publish"}
+	flBatchConcurrency = cli.IntFlag{
+		Name:  "concurrency",
+		Usage: "Maximum number of manifests published at a time",
+		Value: 1}
+	flFailFast = cli.BoolFlag{
+		Name:  "fail-fast",
+		Usage: "Stop publishing after the first failure"}
+	flLabel = cli.StringFlag{
+		Name:  "label",
+		Usage: "Label of the extension"}
+	flDescription = cli.StringFlag{
+		Name:  "description",
+		Usage: "Description of the extension"}
+	flSampleConfig = cli.StringFlag{
+		Name:  "sample-config",
+		Usage: "Path of a sample configuration of the extension in JSON, shown to users"}
+	flHomepageURL = cli.StringFlag{
+		Name:  "homepage-url",
+		Usage: "URL of the homepage of the extension"}
+	flOperationID = cli.StringFlag{
+		Name:  "operation-id",
+		Usage: "ID of an Azure operation (x-ms-request-id)"}
+	flForce = cli.BoolFlag{
+		Name:  "force",
+		Usage: "Overwrite existing resources"}
+	flBlockSize = cli.IntFlag{
+		Name:  "block-size",
+		Usage: "Size in MiB of the blocks the package is uploaded in, an interrupted upload resumes from the last uploaded block",
+		Value: uploadBlockSize / 1024 / 1024}
+	flVerifyChecksum = cli.BoolFlag{
+		Name:  "verify-checksum",
+		Usage: "Download the uploaded blob and check that it matches the checksum of the package"}
+	flForceUnpublish = cli.BoolFlag{
+		Name:  "force-unpublish, force",
+		Usage: "Unpublish the version first if it is still published"}
+	flMetadata = cli.StringSliceFlag{
+		Name:  "metadata",
+		Usage: "key=value metadata of the version, e.g. build=1234, kept locally and shown by get-version. Can be repeated"}
+	flOut = cli.StringFlag{
+		Name:  "out",
+		Usage: "Path of the file to write the manifest to, instead of stdout"}
+	flIfNotExists = cli.BoolFlag{
+		Name:  "if-not-exists",
+		Usage: "Do nothing if the version of the manifest is already published, so that publishing can be retried"}
+	flOlderThan = cli.StringFlag{
+		Name:  "older-than",
+		Usage: "Select the versions older than this version, e.g. 1.2.0"}
+	flVersions = cli.StringFlag{
+		Name:  "versions",
+		Usage: "Comma-separated list of versions (e.g. '1.0.0,1.0.1')"}
+	flConfirm = cli.BoolFlag{
+		Name:  "confirm",
+		Usage: "Confirm a public-facing change that is hard to reverse"}
+	flConfirmNamespace = cli.StringFlag{
+		Name:  "confirm-namespace",
+		Usage: "Exact <namespace>/<name>/<version> of the target, the command refuses to proceed if it does not match"}
+	flDumpManifest = cli.StringFlag{
+		Name:  "dump-manifest",
+		Usage: "Path of a file to write the manifest to before it is submitted, e.g. for auditing"}
+	flRequireConfirmNamespace = cli.BoolFlag{
+		Name:   "require-confirm-namespace",
+		Usage:  "Require --confirm-namespace for delete-version and unpublish-version",
+		EnvVar: "AZURE_EXTENSIONS_CLI_REQUIRE_CONFIRM_NAMESPACE"}
+	flOperationTimeout = cli.DurationFlag{
+		Name:  "operation-timeout",
+		Usage: "Maximum duration to wait for an Azure operation to complete",
+		Value: time.Minute * 60}
+	flHTTPTimeout = cli.DurationFlag{
+		Name:  "http-timeout",
+		Usage: "Maximum duration of each HTTP request to Azure, or 0 for no limit",
+		Value: time.Second * 60}
+	flPollMinInterval = cli.DurationFlag{
+		Name:  "poll-min-interval",
+		Usage: "Interval before the first status check of an Azure operation, doubled after each check",
+		Value: defaultPollMinInterval}
+	flPollMaxInterval = cli.DurationFlag{
+		Name:  "poll-max-interval",
+		Usage: "Maximum interval between status checks of an Azure operation",
+		Value: defaultPollMaxInterval}
+	flUserAgentSuffix = cli.StringFlag{
+		Name:   "user-agent-suffix",
+		Usage:  "Text appended to the User-Agent of requests to Azure, e.g. the name of the pipeline",
+		EnvVar: "AZURE_EXTENSIONS_CLI_USER_AGENT_SUFFIX"}
+	flAllowedNamespaces = cli.StringFlag{
+		Name:   "allowed-namespaces",
+		Usage:  "Comma-separated namespace prefixes manifests can be published or updated under, e.g. Microsoft.Azure.Extensions",
+		EnvVar: "AZURE_EXTENSIONS_CLI_ALLOWED_NAMESPACES"}
+	flAPIVersion = cli.StringFlag{
+		Name:   "api-version",
+		Usage:  "Version of the Service Management API sent in the x-ms-version header of requests",
+		Value:  apiVersion,
+		EnvVar: "AZURE_EXTENSIONS_CLI_API_VERSION"}
+	flCertExpiryWindow = cli.DurationFlag{
+		Name:  "cert-expiry-window",
+		Usage: "Warn when the management certificate expires within this duration",
+		Value: 30 * 24 * time.Hour}
+	flStrictCertExpiry = cli.BoolFlag{
+		Name:  "strict-cert-expiry",
+		Usage: "Fail instead of warning when the management certificate expired or expires within --cert-expiry-window"}
+	flProxy = cli.StringFlag{
+		Name:  "proxy",
+		Usage: "URL of the HTTP proxy to use, overrides the HTTP_PROXY and HTTPS_PROXY environment variables"}
+	flDryRun = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "Print the requests of destructive commands instead of sending them"}
+	flLogLevel = cli.StringFlag{
+		Name:  "log-level",
+		Usage: "Log level: debug, info, warn or error",
+		Value: "info"}
+	flLogFormat = cli.StringFlag{
+		Name:  "log-format",
+		Usage: "Log format: text or json",
+		Value: "text"}
+	flTrace = cli.BoolFlag{
+		Name:  "trace",
+		Usage: "Print the HTTP requests and responses sent to Azure, with credentials redacted"}
+	flQuiet = cli.BoolFlag{
+		Name:  "quiet, q",
+		Usage: "Only print errors and the data requested by the command"}
+	flNoColor = cli.BoolFlag{
+		Name:  "no-color",
+		Usage: "Do not color tables, also disabled when stdout is not a terminal or NO_COLOR is set"}
+	flInteractive = cli.BoolFlag{
+		Name:  "interactive",
+		Usage: "Prompt for missing required arguments instead of failing, only when stdin is a terminal"}
+	flConfig = cli.StringFlag{
+		Name:  "config",
+		Usage: "Path of a YAML file with default flag values (default: ~/" + defaultConfigFile + ")"}
+	flCompact = cli.BoolFlag{
+		Name:  "compact",
+		Usage: "Print the manifest on a single line, without indentation"}
+	flValues = cli.StringFlag{
+		Name:  "values",
+		Usage: "Path of a JSON or YAML file with the values of the manifest fields, e.g. namespace, name, version or label. Flags take precedence"}
+	flSupportedOS = cli.StringFlag{
+		Name:  "supported-os",
+		Usage: "Extension platform: Linux or Windows"}
 	flIsXMLExtension = cli.BoolFlag{
 		Name:  "is-xml-extension",
 		Usage: "Set if this is an XML extension, i.e. PaaS"}
 )
 
+// authFlags select the cloud and subscription of the commands sending
+// requests to Azure, and how they authenticate.
+var authFlags = []cli.Flag{flMgtURL, flCloud, flSubsID, flSubsCert, flCertThumbprint, flCertPassword, flPublishSettings, flTenantID, flClientID, flClientSecret}
+
 func main() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-sigs
+		cancel()
+		// Restore the default behavior, so that a second signal exits
+		// right away.
+		signal.Stop(sigs)
+	}()
+	rootContext = ctx
+	newApp().RunAndExitOnError()
+}
+
+// newApp returns the CLI with all its commands.
+func newApp() *cli.App {
 	app := cli.NewApp()
 	app.Name = "azure-extensions-cli"
-	app.Version = GitSummary
+	app.Version = buildInfo(GitSummary)
+	cli.VersionPrinter = func(*cli.Context) { printBuildInfo(os.Stdout) }
 	app.Usage = "This tool is designed for Microsoft internal extension publishers to release, update and manage Virtual Machine extensions."
 	app.Authors = []cli.Author{{Name: "Ahmet Alp Balkan", Email: "ahmetb at microsoft döt com"}}
+	app.Flags = []cli.Flag{flOperationTimeout, flHTTPTimeout, flPollMinInterval, flPollMaxInterval, flProxy, flUserAgentSuffix, flAllowedNamespaces, flAPIVersion, flCertExpiryWindow, flStrictCertExpiry, flRequireConfirmNamespace, flDryRun, flLogLevel, flLogFormat, flQuiet, flTrace, flConfig, flNoColor, flInteractive}
+	app.Before = before
 	app.Commands = []cli.Command{
 		{Name: "new-extension-manifest",
 			Usage:  "Creates an XML file used to publish or update extension.",
-			Action: newExtensionManifest,
-			Flags: []cli.Flag{
-				flMgtURL, flSubsID, flSubsCert, flPackage, flStorageRealm,
-				flStorageAccount, flNamespace, flName, flVersion,
-				cli.StringFlag{
-					Name:  "label",
-					Usage: "Human readable name of the extension"},
-				cli.StringFlag{
-					Name:  "description",
-					Usage: "Description of the extension"},
+			Action: action(newExtensionManifest),
+			Flags: append(authFlags,
+				flPackage, flBlobURL, flBlobBaseURL, flBlobName, flStorageRealm,
+				flStorageAccount, flNamespace, flName, flVersion, flRegions, flRegionFile, flRing, flLabel, flDescription,
 				cli.StringFlag{
 					Name:  "eula-url",
 					Usage: "URL to the End-User License Agreement page"},
 				cli.StringFlag{
 					Name:  "privacy-url",
 					Usage: "URL to the Privacy Policy page"},
-				cli.StringFlag{
-					Name:  "homepage-url",
-					Usage: "URL to the homepage of the extension"},
+				flHomepageURL,
 				cli.StringFlag{
 					Name:  "company",
 					Usage: "Human-readable Company Name of the publisher"},
-				cli.StringFlag{
-					Name:  "supported-os",
-					Usage: "Extension platform e.g. 'Linux'"},
-			}},
+				flSampleConfig, flSupportedOS, flMetadata, flValues, flCompact, flOut,
+			)},
+		{Name: "clone-version",
+			Usage:  "Creates a manifest for a new version from a published version.",
+			Flags:  append(authFlags, flNamespace, flName, flSourceVersion, flVersion, flBlobURL, flBlobBaseURL, flBlobName, flOut),
+			Action: action(cloneVersion)},
+		{Name: "bump-version",
+			Usage:  "Creates a manifest for the next version from a manifest, incrementing its major, minor or patch version",
+			Flags:  []cli.Flag{flManifest, flBump, flOut},
+			Action: action(bumpManifestVersion)},
+		{Name: "upload-blob",
+			Usage: "Uploads an extension package to Azure Storage and prints its URL.",
+			Flags: append(authFlags, flPackage, flStorageRealm,
+				flStorageAccount, flStorageKey, flContainer, flForce, flVerifyChecksum, flBlockSize),
+			Action: action(uploadPackage)},
+		{Name: "validate-manifest",
+			Usage:  "Checks that the required fields of an extension manifest are present and well-formed.",
+			Flags:  []cli.Flag{flManifest},
+			Action: action(validateManifestFile)},
+		{Name: "lint-manifest",
+			Usage:  "Warns about soft issues of a valid manifest, e.g. missing EULA or privacy URLs.",
+			Flags:  []cli.Flag{flManifest, flStrict},
+			Action: action(lintManifestFile)},
+		{Name: "validate-schema",
+			Usage:  "Checks that sample handler settings are valid according to a JSON Schema.",
+			Flags:  []cli.Flag{flSchema, flSettings},
+			Action: action(validateSchema)},
+		{Name: "diff-manifest",
+			Usage:  "Prints the fields that differ between two manifests, or a manifest and the published version",
+			Flags:  append(authFlags, flManifests, flAgainstPublished),
+			Action: action(diffManifest)},
 		{Name: "new-extension",
 			Usage:  "Creates a new type of extension, not for releasing new versions.",
-			Flags:  []cli.Flag{flMgtURL, flSubsID, flSubsCert, flManifest},
-			Action: createExtension},
+			Flags:  append(authFlags, flManifest, flWaitOperation),
+			Action: action(createExtension)},
 		{Name: "new-extension-version",
 			Usage:  "Publishes a new type of extension internally.",
-			Flags:  []cli.Flag{flMgtURL, flSubsID, flSubsCert, flManifest},
-			Action: updateExtension},
+			Flags:  append(authFlags, flManifest, flAllowDowngrade, flWaitOperation),
+			Action: action(updateExtension)},
+		{Name: "publish-version",
+			Usage:  "Publishes a new extension version from a manifest with the package already uploaded.",
+			Flags:  append(authFlags, flManifest, flIfNotExists, flAllowDowngrade, flShowManifest, flWaitOperation, flWaitReplication, flSummary, flOutput),
+			Action: action(publishVersion)},
+		{Name: "publish-batch",
+			Usage:  "Publishes the new extension versions of all the manifests in a directory.",
+			Flags:  append(authFlags, flManifestDir, flBatchConcurrency, flFailFast, flAllowDowngrade),
+			Action: action(publishBatch)},
 		{Name: "promote",
 			Usage:  "Promote published internal extension to PROD in one or more locations.",
-			Flags:  []cli.Flag{flMgtURL, flSubsID, flSubsCert, flManifest, flRegion},
-			Action: promoteToRegions},
+			Flags:  append(authFlags, flManifest, flRegion),
+			Action: action(promoteToRegions)},
 		{Name: "promote-all-regions",
 			Usage:  "Promote published extension to all Locations.",
-			Flags:  []cli.Flag{flMgtURL, flSubsID, flSubsCert, flManifest},
-			Action: promoteToAllRegions},
+			Flags:  append(authFlags, flManifest),
+			Action: action(promoteToAllRegions)},
+		{Name: "promote-version",
+			Usage:  "Marks the specified version of the extension public.",
+			Flags:  append(authFlags, flNamespace, flName, flVersion, flIsXMLExtension, flConfirm),
+			Action: action(promoteVersion)},
 		{Name: "list-versions",
 			Usage:  "Lists all published extension versions for subscription",
-			Flags:  []cli.Flag{flMgtURL, flSubsID, flSubsCert, flJSON},
-			Action: listVersions},
+			Flags:  append(authFlags, flNamespace, flName, flJSON, flOutput, flWatch, flWatchInterval, flSelect, flConcurrency),
+			Action: action(listVersions)},
+		{Name: "get-version",
+			Usage:  "Shows the details of a published extension version",
+			Flags:  append(authFlags, flNamespace, flName, flVersion),
+			Action: action(getVersion)},
+		{Name: "replicate",
+			Usage:  "Replicates a published version to more regions, e.g. canary regions first",
+			Flags:  append(authFlags, flNamespace, flName, flVersion, flRegions, flRegionFile, flRing),
+			Action: action(replicate)},
+		{Name: "whoami",
+			Usage:  "Checks that the credentials authenticate to the subscription",
+			Flags:  authFlags,
+			Action: action(whoami)},
+		{Name: "doctor",
+			Usage:  "Checks the certificate, subscription ID, network access and credentials, with hints to fix them",
+			Flags:  authFlags,
+			Action: action(doctor)},
+		{Name: "list-regions",
+			Usage:  "Lists the Azure regions available to the subscription",
+			Flags:  authFlags,
+			Action: action(listRegions)},
+		{Name: "check-regions",
+			Usage:  "Checks that a version is replicated to exactly the expected regions",
+			Flags:  append(authFlags, flNamespace, flName, flVersion, flExpectedRegions),
+			Action: action(checkRegions)},
 		{Name: "replication-status",
 			Usage:  "Retrieves replication status for an uploaded extension package",
-			Flags:  []cli.Flag{flMgtURL, flSubsID, flSubsCert, flNamespace, flName, flVersion, flJSON},
-			Action: replicationStatus},
+			Flags:  append(authFlags, flNamespace, flName, flVersion, flJSON, flOutput, flWait, flPollInterval, flStallPolls, flAll, flConcurrency),
+			Action: action(replicationStatus)},
+		{Name: "update-metadata",
+			Usage:  "Updates the label, description or homepage of a published version, keeping all other fields",
+			Flags:  append(authFlags, flNamespace, flName, flVersion, flLabel, flDescription, flHomepageURL, flDumpManifest),
+			Action: action(updateMetadata)},
+		{Name: "update-medialink",
+			Usage:  "Points a published version to another package blob, keeping all other fields",
+			Flags:  append(authFlags, flNamespace, flName, flVersion, flBlobURL, flBlobBaseURL, flBlobName, flConfirm, flDumpManifest),
+			Action: action(updateMediaLink)},
+		{Name: "wait-operation",
+			Usage:  "Waits for a previously started operation to complete",
+			Flags:  append(authFlags, flOperationID),
+			Action: action(waitOperation)},
+		{Name: "list-operations",
+			Usage:  "Lists the recent operations of the subscription, newest first",
+			Flags:  append(authFlags, flSince, flLimit),
+			Action: action(listOperations)},
+		{Name: "get-operation-status",
+			Usage:  "Shows the status of an operation, and its error if it failed",
+			Flags:  append(authFlags, flOperationID),
+			Action: action(getOperationStatus)},
 		{Name: "unpublish-version",
 			Usage:  "Marks the specified version of the extension internal. Does not delete.",
-			Flags:  []cli.Flag{flMgtURL, flSubsID, flSubsCert, flNamespace, flName, flVersion, flIsXMLExtension},
-			Action: unpublishVersion},
+			Flags:  append(authFlags, flNamespace, flName, flVersion, flIsXMLExtension, flWaitOperation, flConfirmNamespace, flDumpManifest),
+			Action: action(unpublishVersion)},
+		{Name: "rollback",
+			Usage:  "Unpublishes the newest public version, so that the previous public version is the newest",
+			Flags:  append(authFlags, flNamespace, flName, flIsXMLExtension, flConfirm),
+			Action: action(rollback)},
 		{Name: "delete-version",
-			Usage:  "Deletes the extension version. It should be unpublished first.",
-			Flags:  []cli.Flag{flMgtURL, flSubsID, flSubsCert, flNamespace, flName, flVersion},
-			Action: deleteVersion},
+			Usage:  "Deletes the extension version. It should be unpublished first, see --force-unpublish.",
+			Flags:  append(authFlags, flNamespace, flName, flVersion, flForceUnpublish, flIsXMLExtension, flWaitOperation, flConfirmNamespace, flDumpManifest),
+			Action: action(deleteVersion)},
+		{Name: "delete-versions",
+			Usage:  "Deletes the versions older than --older-than, or listed in --versions, unpublishing them first if needed",
+			Flags:  append(authFlags, flNamespace, flName, flOlderThan, flVersions, flIsXMLExtension, flConfirm),
+			Action: action(deleteVersions)},
+		{Name: "completion",
+			Usage:  "Prints the completion script of a shell: bash, zsh or fish",
+			Action: action(completion)},
+		{Name: "version",
+			Usage:  "Prints the version, git commit and build date of the CLI",
+			Action: action(version)},
+	}
+	return app
+}
+
+func before(c *cli.Context) error {
+	if err := setupLogging(c); err != nil {
+		return err
 	}
-	app.RunAndExitOnError()
+	setupColor(c)
+	return loadConfig(c)
 }
 
-func mkClient(mgtURL, subscriptionID, certFile string) ExtensionsClient {
-	b, err := readCert(certFile)
+// setupLogging configures the logs, which are always written to stderr so
+// that stdout only has the data requested, e.g. to pipe it to jq.
+func setupLogging(c *cli.Context) error {
+	stderr = newSyncWriter(os.Stderr)
+	log.SetOutput(stderr)
+	switch lvl := c.GlobalString(flLogLevel.Name); lvl {
+	case "debug", "info", "warn", "error":
+		l, err := log.ParseLevel(lvl)
+		if err != nil {
+			return err
+		}
+		log.SetLevel(l)
+		if c.GlobalBool("quiet") {
+			log.SetLevel(log.ErrorLevel)
+		}
+	default:
+		return fmt.Errorf("Unsupported log level %q, must be one of: debug, info, warn, error", lvl)
+	}
+
+	switch f := c.GlobalString(flLogFormat.Name); f {
+	case "text":
+		log.SetFormatter(&log.TextFormatter{})
+	case "json":
+		log.SetFormatter(&log.JSONFormatter{})
+		log.AddHook(logContext)
+	default:
+		return fmt.Errorf("Unsupported log format %q, must be one of: text, json", f)
+	}
+	return nil
+}
+
+// mkClient creates the client of the subscription given with the flags.
+func mkClient(ctx context.Context, c *cli.Context) (ExtensionsClient, error) {
+	cl, err := newClientFromFlags(ctx, c, subscription{})
+	if err == nil {
+		logContext.set("subscription", subscriptionHash(cl.SubscriptionID()))
+	}
+	return cl, err
+}
+
+// subscription overrides the subscription ID and certificate files given with
+// the flags, to create the clients of several subscriptions.
+type subscription struct {
+	id, certFiles string
+}
+
+func newClientFromFlags(ctx context.Context, c *cli.Context, sub subscription) (ExtensionsClient, error) {
+	subscriptionFlag := func(fl, override string) (string, error) {
+		if override != "" {
+			return override, nil
+		}
+		return checkFlag(c, fl)
+	}
+
+	cfg := ClientConfig{
+		OperationTimeout: c.GlobalDuration(flOperationTimeout.Name),
+		HTTPTimeout:      c.GlobalDuration(flHTTPTimeout.Name),
+		PollMinInterval:  c.GlobalDuration(flPollMinInterval.Name),
+		PollMaxInterval:  c.GlobalDuration(flPollMaxInterval.Name),
+		Trace:            c.GlobalBool(flTrace.Name),
+		UserAgentSuffix:  globalStringFlag(c, flUserAgentSuffix.Name),
+		APIVersion:       globalStringFlag(c, flAPIVersion.Name),
+		CertExpiryWindow: c.GlobalDuration(flCertExpiryWindow.Name),
+		StrictCertExpiry: c.GlobalBool(flStrictCertExpiry.Name),
+		RecordFixtures:   os.Getenv(envRecordFixtures),
+		ShowProgress:     !c.GlobalBool("quiet") && isTerminal(os.Stdout) && isTerminal(os.Stderr),
+	}
+	if s := os.Getenv(envInsecureSkipVerify); s != "" {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return ExtensionsClient{}, fmt.Errorf("Invalid %s %q, expected true or false", envInsecureSkipVerify, s)
+		}
+		cfg.InsecureSkipVerify = v
+	}
+	if !apiVersionRegexp.MatchString(cfg.APIVersion) {
+		return ExtensionsClient{}, fmt.Errorf("Invalid API version %q, expected a date like %s", cfg.APIVersion, apiVersion)
+	}
+	if cfg.PollMinInterval > cfg.PollMaxInterval {
+		return ExtensionsClient{}, fmt.Errorf("--%s cannot be greater than --%s", flPollMinInterval.Name, flPollMaxInterval.Name)
+	}
+	if ns := globalStringFlag(c, flAllowedNamespaces.Name); ns != "" {
+		for _, prefix := range strings.Split(ns, ",") {
+			if prefix = strings.TrimSpace(prefix); prefix != "" {
+				cfg.AllowedNamespaces = append(cfg.AllowedNamespaces, prefix)
+			}
+		}
+	}
+	if proxy := globalStringFlag(c, flProxy.Name); proxy != "" {
+		u, err := url.Parse(proxy)
+		if err != nil || u.Host == "" {
+			return ExtensionsClient{}, fmt.Errorf("Invalid proxy URL %q", proxy)
+		}
+		cfg.ProxyURL = u
+	}
+
+	if publishSettings := stringFlag(c, flPublishSettings.Name); publishSettings != "" {
+		cl, err := NewClientFromPublishSettings(publishSettings, stringFlag(c, flSubsID.Name), cfg)
+		if err != nil {
+			return cl, errorf(exitCodeAuthFailure, "Cannot create client from publish settings %s: %v", publishSettings, err)
+		}
+		return cl, nil
+	}
+
+	env, err := lookupCloud(stringFlag(c, flCloud.Name))
+	if err != nil {
+		return ExtensionsClient{}, err
+	}
+	cfg.ActiveDirectoryURL = env.ActiveDirectoryEndpoint
+	cfg.ManagementURL = managementURL(c, env)
+	if clientID := stringFlag(c, flClientID.Name); clientID != "" {
+		tenantID, err := checkFlag(c, flTenantID.Name)
+		if err != nil {
+			return ExtensionsClient{}, err
+		}
+		clientSecret, err := checkFlag(c, flClientSecret.Name)
+		if err != nil {
+			return ExtensionsClient{}, err
+		}
+		subscriptionID, err := subscriptionFlag(flSubsID.Name, sub.id)
+		if err != nil {
+			return ExtensionsClient{}, err
+		}
+		cl, err := NewClientFromServicePrincipal(tenantID, clientID, clientSecret, subscriptionID, cfg)
+		if err != nil {
+			return cl, errorf(exitCodeAuthFailure, "Cannot create client from service principal: %v", err)
+		}
+		return cl, nil
+	}
+	if thumbprint := stringFlag(c, flCertThumbprint.Name); thumbprint != "" {
+		subscriptionID, err := subscriptionFlag(flSubsID.Name, sub.id)
+		if err != nil {
+			return ExtensionsClient{}, err
+		}
+		thumbprint, err := normalizeThumbprint(thumbprint)
+		if err != nil {
+			return ExtensionsClient{}, err
+		}
+		cert, err := readCertFromStore(thumbprint)
+		if err != nil {
+			return ExtensionsClient{}, errorf(exitCodeAuthFailure, "Cannot read certificate %s: %v", thumbprint, err)
+		}
+		log.Debugf("Read management certificate %s from the certificate store.", thumbprint)
+		cl, err := NewClient(subscriptionID, cert, cfg)
+		if err != nil {
+			return cl, errorf(exitCodeAuthFailure, "Cannot create client: %v", err)
+		}
+		return cl, nil
+	}
+
+	subscriptionID, err := subscriptionFlag(flSubsID.Name, sub.id)
 	if err != nil {
-		log.Fatalf("Cannot read certificate %s: %v", certFile, err)
+		return ExtensionsClient{}, err
 	}
-	cl, err := NewClient(mgtURL, subscriptionID, b)
+	certFiles, err := subscriptionFlag(flSubsCert.Name, sub.certFiles)
 	if err != nil {
-		log.Fatalf("Cannot create client: %v", err)
+		return ExtensionsClient{}, err
 	}
-	return cl
+	var certs [][]byte
+	for _, certFile := range strings.Split(certFiles, ",") {
+		certFile = strings.TrimSpace(certFile)
+		b, err := readCert(certFile, stringFlag(c, flCertPassword.Name))
+		if err != nil {
+			return ExtensionsClient{}, errorf(exitCodeAuthFailure, "Cannot read certificate %s: %v", certFile, err)
+		}
+		log.Debugf("Read management certificate %d from %s.", len(certs)+1, certFile)
+		certs = append(certs, b)
+	}
+	cl, err := NewClientFromCerts(ctx, subscriptionID, certs, cfg)
+	if err != nil {
+		return cl, errorf(exitCodeAuthFailure, "Cannot create client: %v", err)
+	}
+	return cl, nil
 }
 
-func readCert(certFile string) ([]byte, error) {
-	b, err := ioutil.ReadFile(certFile)
-	if err != nil {
-		return nil, err
+// checkFlag returns the value of the string flag, prompting for it in
+// interactive mode, or an error if it is not provided.
+func checkFlag(c *cli.Context, fl string) (string, error) {
+	v := stringFlag(c, fl)
+	if v == "" && interactive(c) {
+		v = promptMissingFlag(c, fl)
 	}
+	if v == "" {
+		if env := flagEnvVars(c, fl); env != "" {
+			return "", fmt.Errorf("argument %q (or environment variable %s) must be provided", fl, strings.Replace(env, ",", " or ", -1))
+		}
+		return "", fmt.Errorf("argument %q must be provided", fl)
+	}
+	return v, nil
+}
 
-	p, _ := pem.Decode(b)
-	if p != nil {
-		return b, nil
+// checkVersionFlags returns the namespace, name and version of the extension
+// given with the flags.
+func checkVersionFlags(c *cli.Context) (ns, name, version string, err error) {
+	if ns, name, err = checkExtensionFlags(c); err != nil {
+		return "", "", "", err
+	}
+	if version, err = checkFlag(c, flVersion.Name); err != nil {
+		return "", "", "", err
 	}
+	return ns, name, version, nil
+}
 
-	pemBlocks, err := pkcs12.ToPEM(b, "")
-	if err != nil {
-		return nil, err
+// checkExtensionFlags returns the namespace and name of the extension given
+// with the flags.
+func checkExtensionFlags(c *cli.Context) (ns, name string, err error) {
+	if ns, err = checkFlag(c, flNamespace.Name); err != nil {
+		return "", "", err
 	}
+	if name, err = checkFlag(c, flName.Name); err != nil {
+		return "", "", err
+	}
+	return ns, name, nil
+}
 
-	var buf bytes.Buffer
-	for _, x := range pemBlocks {
-		buf.Write(pem.EncodeToMemory(x))
+// flagEnvVars returns the comma-separated environment variables the string
+// flag of the command falls back to, if any.
+func flagEnvVars(c *cli.Context, fl string) string {
+	if sf, ok := commandStringFlag(c, fl); ok {
+		return sf.EnvVar
 	}
+	return ""
+}
 
-	return buf.Bytes(), nil
+// commandStringFlag returns the string flag of the command with the given
+// name.
+func commandStringFlag(c *cli.Context, fl string) (cli.StringFlag, bool) {
+	for _, f := range c.Command.Flags {
+		if sf, ok := f.(cli.StringFlag); ok && strings.Split(sf.Name, ",")[0] == fl {
+			return sf, true
+		}
+	}
+	return cli.StringFlag{}, false
 }
 
-func checkFlag(c *cli.Context, fl string) string {
-	v := c.String(fl)
-	if v == "" {
-		log.Fatalf("argument %q must be provided", fl)
+// printDryRun prints the request a command would have sent in --dry-run mode.
+func printDryRun(method, url string, body []byte) {
+	// A single write, so that requests printed concurrently do not interleave.
+	s := fmt.Sprintf("%s %s\n", method, url)
+	if len(body) > 0 {
+		s += fmt.Sprintf("\n%s\n", string(body))
 	}
-	return v
+	fmt.Print(s)
 }
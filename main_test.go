@@ -0,0 +1,97 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+// TestListVersionsJSONHasNoLogsOnStdout runs list-versions -o json with debug
+// logs, and checks that stdout can be piped to jq.
+func TestListVersionsJSONHasNoLogsOnStdout(t *testing.T) {
+	b, err := ioutil.ReadFile(filepath.Join("testdata", "fixtures", "list-versions", "001-get.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var f fixture
+	if err := json.Unmarshal(b, &f); err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(f.Body))
+	}))
+	defer srv.Close()
+
+	dir, err := ioutil.TempDir("", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", dir)
+	certFile := filepath.Join(dir, "cert.pem")
+	if err := ioutil.WriteFile(certFile, testCert(t), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+	outFile, errFile := filepath.Join(dir, "stdout"), filepath.Join(dir, "stderr")
+	if os.Stdout, err = os.Create(outFile); err != nil {
+		t.Fatal(err)
+	}
+	if os.Stderr, err = os.Create(errFile); err != nil {
+		t.Fatal(err)
+	}
+	defer log.SetOutput(stderr)
+	defer log.SetLevel(log.GetLevel())
+
+	err = newApp().Run([]string{"azure-extensions-cli", "--log-level", "debug", "--trace",
+		"list-versions", "--management-url", srv.URL, "--subscription-id", "subscription-id", "--subscription-cert", certFile, "-o", "json"})
+	os.Stdout.Close()
+	os.Stderr.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out, err := ioutil.ReadFile(outFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var versions []PublishedExtension
+	if err := json.Unmarshal(out, &versions); err != nil {
+		t.Fatalf("Stdout is not JSON: %v\n%s", err, out)
+	}
+	if len(versions) != 2 {
+		t.Fatalf("Expected 2 versions, but got %d", len(versions))
+	}
+	if logs, err := ioutil.ReadFile(errFile); err != nil || len(logs) == 0 {
+		t.Fatalf("Expected the logs on stderr, but got %q (%v)", logs, err)
+	}
+}
+
+func TestCheckFlagReturnsErrorForMissingArgument(t *testing.T) {
+	set := flag.NewFlagSet("unpublish-version", flag.ContinueOnError)
+	set.String(flNamespace.Name, "", "")
+	set.String(flName.Name, "CustomScript", "")
+	c := cli.NewContext(nil, set, cli.NewContext(nil, flag.NewFlagSet("global", flag.ContinueOnError), nil))
+
+	if v, err := checkFlag(c, flName.Name); err != nil || v != "CustomScript" {
+		t.Fatalf("Expected \"CustomScript\", but got %q, %v", v, err)
+	}
+	_, _, err := checkExtensionFlags(c)
+	if err == nil || err.Error() != `argument "namespace" must be provided` {
+		t.Fatalf("Expected an error about the missing namespace, but got: %v", err)
+	}
+	if code := exitCode(err); code != 1 {
+		t.Fatalf("Expected exit code 1, but got %d", code)
+	}
+}
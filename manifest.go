@@ -1,15 +1,39 @@
 package main
 
 import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
 	"encoding/xml"
 	"fmt"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 )
 
+const (
+	// blobURLPlaceholder is the MediaLink value of a manifest whose extension
+	// package has not been uploaded yet.
+	blobURLPlaceholder = "%BLOB_URL%"
+)
+
+// stdinPath is the manifest path reading the manifest from standard input.
+const stdinPath = "-"
+
+// readManifestFile reads the manifest at path, or from standard input if path
+// is "-".
+func readManifestFile(path string) ([]byte, error) {
+	if path == stdinPath {
+		return ioutil.ReadAll(os.Stdin)
+	}
+	return ioutil.ReadFile(path)
+}
+
 type certificate struct {
 	StoreLocation       string `xml:"StoreLocation,omitempty"`
 	StoreName           string `xml:"StoreName,omitempty"`
@@ -51,6 +75,7 @@ type extensionImage struct {
 	LocalResources              string       `xml:"LocalResources"`
 	BlockRoleUponFailure        string       `xml:"BlockRoleUponFailure,omitempty"`
 	IsInternalExtension         bool         `xml:"IsInternalExtension"`
+	SampleConfig                string       `xml:"SampleConfig,omitempty"`
 	Eula                        string       `xml:"Eula,omitempty"`
 	PrivacyURI                  string       `xml:"PrivacyUri,omitempty"`
 	HomepageURI                 string       `xml:"HomepageUri,omitempty"`
@@ -78,6 +103,7 @@ type extensionImageGlobal struct {
 	LocalResources              string       `xml:"LocalResources"`
 	BlockRoleUponFailure        string       `xml:"BlockRoleUponFailure,omitempty"`
 	IsInternalExtension         bool         `xml:"IsInternalExtension"`
+	SampleConfig                string       `xml:"SampleConfig,omitempty"`
 	Eula                        string       `xml:"Eula,omitempty"`
 	PrivacyURI                  string       `xml:"PrivacyUri,omitempty"`
 	HomepageURI                 string       `xml:"HomepageUri,omitempty"`
@@ -97,7 +123,7 @@ func isGuestAgent(providerNameSpace string) bool {
 }
 
 func newExtensionImageManifest(filename string, regions []string) (extensionManifest, error) {
-	b, err := ioutil.ReadFile(filename)
+	b, err := readManifestFile(filename)
 	if err != nil {
 		return nil, err
 	}
@@ -115,7 +141,7 @@ func newExtensionImageManifest(filename string, regions []string) (extensionMani
 }
 
 func newExtensionImageGlobalManifest(filename string) (extensionManifest, error) {
-	b, err := ioutil.ReadFile(filename)
+	b, err := readManifestFile(filename)
 	if err != nil {
 		return nil, err
 	}
@@ -138,39 +164,188 @@ func (ext *extensionImageGlobal) Marshal() ([]byte, error) {
 	return xml.Marshal(*ext)
 }
 
-func newExtensionManifest(c *cli.Context) {
-	cl := mkClient(checkFlag(c, flMgtURL.Name), checkFlag(c, flSubsID.Name), checkFlag(c, flSubsCert.Name))
-	storageRealm := checkFlag(c, flStorageRealm.Name)
-	storageAccount := checkFlag(c, flStorageAccount.Name)
-	extensionPkg := checkFlag(c, flPackage.Name)
+func newExtensionManifest(ctx context.Context, c *cli.Context) error {
+	values := manifestValues{}
+	if path := stringFlag(c, flValues.Name); path != "" {
+		var err error
+		if values, err = readValuesFile(path); err != nil {
+			return err
+		}
+	}
+	ns, err := values.require(c, flNamespace.Name)
+	if err != nil {
+		return err
+	}
+	name, err := values.require(c, flName.Name)
+	if err != nil {
+		return err
+	}
+	version, err := values.require(c, flVersion.Name)
+	if err != nil {
+		return err
+	}
 
-	// Upload extension blob
-	blobURL, err := uploadBlob(cl, storageRealm, storageAccount, extensionPkg)
+	if problems := validateMetadata(values.get(c, flLabel.Name), values.get(c, flDescription.Name)); len(problems) > 0 {
+		return problems
+	}
+	annotations, err := parseAnnotations(c.StringSlice(flMetadata.Name))
+	if err != nil {
+		return err
+	}
+
+	// The MediaLink is either given, uploaded from the package, or left as a
+	// placeholder to be replaced before publishing.
+	blobURL, err := blobURLFlag(c, func(fl string) string { return values.get(c, fl) })
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if blobURL == "" && stringFlag(c, flPackage.Name) != "" {
+		cl, err := mkClient(ctx, c)
+		if err != nil {
+			return err
+		}
+		storageRealm, err := checkFlag(c, flStorageRealm.Name)
+		if err != nil {
+			return err
+		}
+		storageAccount, err := checkFlag(c, flStorageAccount.Name)
+		if err != nil {
+			return err
+		}
+
+		blobURL, err = uploadBlob(ctx, cl, storageRealm, storageAccount, stringFlag(c, flPackage.Name))
+		if err != nil {
+			return err
+		}
+		log.Debugf("Extension package uploaded to: %s", blobURL)
+	} else if blobURL == "" {
+		blobURL = blobURLPlaceholder
 	}
-	log.Debugf("Extension package uploaded to: %s", blobURL)
 
 	manifest := extensionImage{
-		ProviderNameSpace:   checkFlag(c, flNamespace.Name),
-		Type:                checkFlag(c, flName.Name),
-		Version:             checkFlag(c, flVersion.Name),
-		Label:               "label",
-		Description:         "description",
+		ProviderNameSpace:   ns,
+		Type:                name,
+		Version:             version,
+		Label:               values.get(c, flLabel.Name),
+		Description:         values.get(c, flDescription.Name),
 		IsInternalExtension: true,
 		MediaLink:           blobURL,
-		Eula:                "eula-url",
-		PrivacyURI:          "privacy-url",
-		HomepageURI:         "homepage-url",
+		Eula:                values.get(c, "eula-url"),
+		PrivacyURI:          values.get(c, "privacy-url"),
+		HomepageURI:         values.get(c, flHomepageURL.Name),
 		IsJSONExtension:     true,
-		CompanyName:         "company",
-		SupportedOS:         "supported-os",
+		CompanyName:         values.get(c, "company"),
+	}
+
+	if path := values.get(c, flSampleConfig.Name); path != "" {
+		if manifest.SampleConfig, err = readSampleConfig(path); err != nil {
+			return err
+		}
+	}
+
+	if v := values.get(c, flSupportedOS.Name); v != "" {
+		os, err := normalizeSupportedOS(v)
+		if err != nil {
+			return err
+		}
+		manifest.SupportedOS = os
+	}
+
+	regions, err := regionsFlag(c, values.get(c, flRegions.Name))
+	if err != nil {
+		return err
+	}
+	if len(regions) > 0 {
+		manifest.Regions = strings.Join(normalizeRegionList(regions), ";")
 	}
 
-	bs, err := xml.MarshalIndent(manifest, "", "  ")
+	bs, err := marshalManifest(manifest, c.Bool(flCompact.Name))
 	if err != nil {
-		log.Fatalf("xml marshall error: %v", err)
+		return fmt.Errorf("xml marshall error: %v", err)
+	}
+
+	if len(annotations) > 0 {
+		path, err := annotationsPath()
+		if err != nil {
+			return err
+		}
+		if err := addAnnotations(path, annotationsKey(manifest.ProviderNameSpace, manifest.Type, manifest.Version), annotations); err != nil {
+			return fmt.Errorf("Cannot save metadata: %v", err)
+		}
+		log.Infof("Metadata saved to %s", path)
 	}
+	return writeManifest(c, bs)
+}
+
+// readSampleConfig reads a sample configuration in JSON, and returns it
+// base64-encoded as the SampleConfig of a manifest.
+func readSampleConfig(path string) (string, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("Error reading sample configuration: %v", err)
+	}
+	if !json.Valid(b) {
+		return "", fmt.Errorf("Sample configuration %s is not valid JSON", path)
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// marshalManifest marshals a manifest, indented for humans unless compact is
+// set, in which case it is on a single line.
+func marshalManifest(manifest interface{}, compact bool) ([]byte, error) {
+	if compact {
+		return xml.Marshal(manifest)
+	}
+	return xml.MarshalIndent(manifest, "", "  ")
+}
 
-	fmt.Println(string(bs))
+// joinBlobURL returns the URL of the blob with the given name under the base
+// URL, e.g. of a storage container. The URL must use https. The query of the
+// base URL, e.g. the SAS token of the container, is kept.
+func joinBlobURL(base, name string) (string, error) {
+	var query string
+	if i := strings.Index(base, "?"); i >= 0 {
+		base, query = base[:i], base[i:]
+	}
+	blobURL := strings.TrimSuffix(base, "/") + "/" + strings.TrimPrefix(name, "/")
+	u, err := url.Parse(blobURL + query)
+	if err != nil || u.Host == "" || u.Scheme != "https" {
+		return "", fmt.Errorf("Invalid blob URL %q, expected an https URL", blobURL)
+	}
+	return blobURL + query, nil
+}
+
+// blobURLFlag returns the URL given with --blob-url, or joined from
+// --blob-base-url and --blob-name, or "" if none of them were given. The
+// fallback is used for --blob-url, e.g. to read it from a values file.
+func blobURLFlag(c *cli.Context, fallback func(string) string) (string, error) {
+	base, name := stringFlag(c, flBlobBaseURL.Name), stringFlag(c, flBlobName.Name)
+	if base == "" && name == "" {
+		return fallback(flBlobURL.Name), nil
+	}
+	if stringFlag(c, flBlobURL.Name) != "" {
+		return "", fmt.Errorf("--%s cannot be used with --%s and --%s", flBlobURL.Name, flBlobBaseURL.Name, flBlobName.Name)
+	}
+	if base == "" || name == "" {
+		return "", fmt.Errorf("--%s and --%s must be given together", flBlobBaseURL.Name, flBlobName.Name)
+	}
+	return joinBlobURL(base, name)
+}
+
+// writeManifest writes a generated manifest to the file given with --out,
+// creating its directory if needed, or else to stdout.
+func writeManifest(c *cli.Context, b []byte) error {
+	out := stringFlag(c, flOut.Name)
+	if out == "" {
+		fmt.Println(string(b))
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		return fmt.Errorf("Cannot create directory of %s: %v", out, err)
+	}
+	if err := ioutil.WriteFile(out, append(b, '\n'), 0644); err != nil {
+		return fmt.Errorf("Cannot write manifest: %v", err)
+	}
+	log.Infof("Manifest written to %s", out)
+	return nil
 }
@@ -2,7 +2,12 @@ package main
 
 import (
 	"bytes"
+	"encoding/base64"
 	"encoding/xml"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/approvals/go-approval-tests"
@@ -15,7 +20,7 @@ func TestRoundTripExtensionImage(t *testing.T) {
   <Version>4.3.2.1</Version>
   <Label>Microsoft Azure Custom Script Extension for Linux Virtual Machines</Label>
   <HostingResources>VmRole</HostingResources>
-  <MediaLink>http://localhost/extension.zip</MediaLink>
+  <MediaLink>https://localhost/extension.zip</MediaLink>
   <Endpoints></Endpoints>
   <Description>Please consider using Microsoft.Azure.Extensions.CustomScript instead.</Description>
   <LocalResources></LocalResources>
@@ -54,7 +59,7 @@ func TestRoundTripXmlExtensionImage(t *testing.T) {
   <Version>4.3.2.1</Version>
   <Label>Microsoft Azure Custom Script Extension for Linux Virtual Machines</Label>
   <HostingResources>WebRole|WorkerRole</HostingResources>
-  <MediaLink>http://localhost/extension.zip</MediaLink>
+  <MediaLink>https://localhost/extension.zip</MediaLink>
   <Certificate>
     <StoreLocation>LocalMachine</StoreLocation>
     <StoreName>My</StoreName>
@@ -99,7 +104,7 @@ func TestSuppressRegionWhenEmpty(t *testing.T) {
   <Version>4.3.2.1</Version>
   <Label>Microsoft Azure Custom Script Extension for Linux Virtual Machines</Label>
   <HostingResources>VmRole</HostingResources>
-  <MediaLink>http://localhost/extension.zip</MediaLink>
+  <MediaLink>https://localhost/extension.zip</MediaLink>
   <Endpoints></Endpoints>
   <Description>Please consider using Microsoft.Azure.Extensions.CustomScript instead.</Description>
   <LocalResources></LocalResources>
@@ -137,7 +142,7 @@ func TestRoundTripXmlExtensionImageGlobal(t *testing.T) {
   <Version>4.3.2.1</Version>
   <Label>Microsoft Azure Custom Script Extension for Linux Virtual Machines</Label>
   <HostingResources>WebRole|WorkerRole</HostingResources>
-  <MediaLink>http://localhost/extension.zip</MediaLink>
+  <MediaLink>https://localhost/extension.zip</MediaLink>
   <Certificate>
     <StoreLocation>LocalMachine</StoreLocation>
     <StoreName>My</StoreName>
@@ -175,6 +180,82 @@ func TestRoundTripXmlExtensionImageGlobal(t *testing.T) {
 	}
 }
 
+func TestKeepEmptyLabelAndDescription(t *testing.T) {
+	for _, m := range []extensionManifest{
+		&extensionImage{ProviderNameSpace: "Microsoft.Azure.Extensions", Type: "CustomScript", Version: "2.0.1"},
+		&extensionImageGlobal{ProviderNameSpace: "Microsoft.Azure.Extensions", Type: "CustomScript", Version: "2.0.1"},
+	} {
+		b, err := m.Marshal()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Contains(b, []byte("<Label></Label>")) || !bytes.Contains(b, []byte("<Description></Description>")) {
+			t.Fatalf("Expected empty Label and Description elements, but got %s", b)
+		}
+		if bytes.Contains(b, []byte("<SampleConfig>")) {
+			t.Fatalf("Expected no SampleConfig element, but got %s", b)
+		}
+	}
+}
+
+func TestSampleConfigRoundTrips(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sample.json")
+	if err := ioutil.WriteFile(path, []byte(`{"commandToExecute": "echo hello"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	sample, err := readSampleConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manifest := extensionImage{
+		ProviderNameSpace:   "Microsoft.Azure.Extensions",
+		Type:                "CustomScript",
+		Version:             "2.0.1",
+		MediaLink:           "https://example.blob.core.windows.net/extensions/package.zip",
+		SampleConfig:        sample,
+		IsInternalExtension: true,
+	}
+	bs, err := manifest.Marshal()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateManifest(bs); err != nil {
+		t.Fatalf("Manifest is not valid: %v", err)
+	}
+
+	var obj extensionImage
+	if err := xml.Unmarshal(bs, &obj); err != nil {
+		t.Fatal(err)
+	}
+	b, err := base64.StdEncoding.DecodeString(obj.SampleConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"commandToExecute": "echo hello"}` {
+		t.Fatalf("Expected the sample configuration, but got %q", b)
+	}
+}
+
+func TestReadSampleConfigRejectsInvalidJSON(t *testing.T) {
+	f, err := ioutil.TempFile("", "sample")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"commandToExecute": `)
+	f.Close()
+
+	if _, err := readSampleConfig(f.Name()); err == nil || !strings.Contains(err.Error(), "not valid JSON") {
+		t.Fatalf("Expected an error about invalid JSON, but got %v", err)
+	}
+}
+
 func TestIsGuestAgent(t *testing.T) {
 	if !isGuestAgent("Microsoft.OSTCLinuxAgent") {
 		t.Error("true if namespace == \"Microsoft.OSTCAgentLinux\"")
@@ -184,3 +265,96 @@ func TestIsGuestAgent(t *testing.T) {
 		t.Error("true if namespace != \"Microsoft.OSTCAgentLinux\"")
 	}
 }
+
+func TestCompactManifestRoundTrips(t *testing.T) {
+	manifest := extensionImage{
+		ProviderNameSpace:   "Microsoft.Azure.Extensions",
+		Type:                "CustomScript",
+		Version:             "2.0.1",
+		Label:               "Custom Script",
+		Description:         "Runs scripts",
+		MediaLink:           "https://example.blob.core.windows.net/extensions/package.zip",
+		IsInternalExtension: true,
+		IsJSONExtension:     true,
+	}
+	bs, err := marshalManifest(manifest, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.ContainsAny(bs, "\n\t") {
+		t.Fatalf("Compact manifest has whitespace: %s", bs)
+	}
+	if err := validateManifest(bs); err != nil {
+		t.Fatalf("Compact manifest is not valid: %v", err)
+	}
+
+	var obj extensionImage
+	if err := xml.Unmarshal(bs, &obj); err != nil {
+		t.Fatal(err)
+	}
+	if obj != manifest {
+		t.Fatalf("Expected %+v, but got %+v", manifest, obj)
+	}
+}
+
+func TestManifestEscapesSpecialCharacters(t *testing.T) {
+	manifest := extensionImage{
+		ProviderNameSpace:   "Microsoft.Azure.Extensions",
+		Type:                "CustomScript",
+		Version:             "2.0.1",
+		Label:               `Custom <Script> & "more"`,
+		Description:         `Runs <scripts> & 'commands' > /dev/null "safely"`,
+		MediaLink:           "https://example.blob.core.windows.net/extensions/package.zip?sv=1&sig=2",
+		IsInternalExtension: true,
+		IsJSONExtension:     true,
+	}
+	for _, compact := range []bool{false, true} {
+		bs, err := marshalManifest(manifest, compact)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if bytes.Contains(bs, []byte("<scripts>")) || bytes.Contains(bs, []byte(" & ")) {
+			t.Fatalf("compact=%v: expected special characters to be escaped, but got: %s", compact, bs)
+		}
+		if err := validateManifest(bs); err != nil {
+			t.Fatalf("compact=%v: manifest is not valid: %v", compact, err)
+		}
+
+		var obj extensionImage
+		if err := xml.Unmarshal(bs, &obj); err != nil {
+			t.Fatalf("compact=%v: manifest is not well-formed XML: %v", compact, err)
+		}
+		if obj != manifest {
+			t.Fatalf("compact=%v: expected %+v, but got %+v", compact, manifest, obj)
+		}
+	}
+}
+
+func TestJoinBlobURL(t *testing.T) {
+	for _, base := range []string{"https://example.blob.core.windows.net/extensions", "https://example.blob.core.windows.net/extensions/"} {
+		u, err := joinBlobURL(base, "CustomScript-2.0.1.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "https://example.blob.core.windows.net/extensions/CustomScript-2.0.1.zip"; u != expected {
+			t.Fatalf("Expected %q, but got %q", expected, u)
+		}
+	}
+
+	sas := "?sv=2019-12-12&sr=c&sig=abc%2Bdef%3D&se=2030-01-01T00%3A00%3A00Z&sp=r"
+	for _, base := range []string{"https://example.blob.core.windows.net/extensions" + sas, "https://example.blob.core.windows.net/extensions/" + sas} {
+		u, err := joinBlobURL(base, "CustomScript-2.0.1.zip")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected := "https://example.blob.core.windows.net/extensions/CustomScript-2.0.1.zip" + sas; u != expected {
+			t.Fatalf("Expected %q, but got %q", expected, u)
+		}
+	}
+
+	for _, base := range []string{"http://example.blob.core.windows.net/extensions", "example.blob.core.windows.net/extensions"} {
+		if _, err := joinBlobURL(base, "CustomScript-2.0.1.zip"); err == nil {
+			t.Fatalf("%s: expected an error for a URL which is not https", base)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/management"
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/olekukonko/tablewriter"
+)
+
+const (
+	// operationsFile is the name of the file in the home directory recording
+	// the operations started by the CLI.
+	operationsFile = ".azure-extensions-cli-operations.json"
+
+	// maxRecordedOperations bounds the number of operations kept in the
+	// operations file.
+	maxRecordedOperations = 100
+)
+
+// operationRecord describes an asynchronous operation started by the CLI, so
+// that waiting for it can be resumed.
+type operationRecord struct {
+	ID             management.OperationID `json:"id"`
+	Operation      string                 `json:"operation"`
+	SubscriptionID string                 `json:"subscriptionId"`
+	StartedAt      time.Time              `json:"startedAt"`
+}
+
+// operationsPath returns the path of the operations file.
+func operationsPath() (string, error) {
+	home, err := homeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, operationsFile), nil
+}
+
+// readOperations returns the operations recorded in the file at path, oldest
+// first. A missing file has no operations.
+func readOperations(path string) ([]operationRecord, error) {
+	var ops []operationRecord
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ops, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(b, &ops); err != nil {
+		return nil, fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+	return ops, nil
+}
+
+// appendOperation adds an operation to the file at path, dropping the oldest
+// operations beyond maxRecordedOperations.
+func appendOperation(path string, op operationRecord) error {
+	ops, err := readOperations(path)
+	if err != nil {
+		return err
+	}
+	ops = append(ops, op)
+	if len(ops) > maxRecordedOperations {
+		ops = ops[len(ops)-maxRecordedOperations:]
+	}
+	b, err := json.MarshalIndent(ops, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+// recordOperation records a started operation in the operations file. Failing
+// to record it does not fail the command, since the operation has started.
+func recordOperation(cl ExtensionsClient, operation string, id management.OperationID) {
+	path, err := operationsPath()
+	if err == nil {
+		err = appendOperation(path, operationRecord{
+			ID:             id,
+			Operation:      operation,
+			SubscriptionID: cl.client.subscriptionID,
+			StartedAt:      time.Now().UTC(),
+		})
+	}
+	if err != nil {
+		log.Warnf("Cannot record operation %s: %v", id, err)
+	}
+}
+
+// runOperation starts an asynchronous operation, records it and waits for it
+// to finish, unless the client detaches from its operations.
+func runOperation(ctx context.Context, cl ExtensionsClient, operation string, start func() (management.OperationID, error)) error {
+	op, err := start()
+	if err != nil {
+		return wrapf(err, "%s failed: %v", operation, err)
+	}
+	lg := log.WithField("x-ms-operation-id", op)
+	lg.Infof("%s operation started.", operation)
+	recordOperation(cl, operation, op)
+	if detachOperation(cl, op) {
+		return nil
+	}
+	if err := cl.WaitForOperation(ctx, op); err != nil {
+		return errorf(exitCodeOperationFailure, "%s (x-ms-operation-id=%s) failed: %v", operation, op, err)
+	}
+	lg.Infof("%s operation finished.", operation)
+	return nil
+}
+
+// detachOperation prints the ID of a started operation, and reports true,
+// if the client does not wait for operations. Waiting can be resumed with
+// wait-operation.
+func detachOperation(cl ExtensionsClient, op management.OperationID) bool {
+	if !cl.detach {
+		return false
+	}
+	fmt.Println(op)
+	log.WithField("x-ms-operation-id", op).Infof("Not waiting for the operation, resume with: wait-operation --%s %s", flOperationID.Name, op)
+	return true
+}
+
+func waitOperation(ctx context.Context, c *cli.Context) error {
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	id, err := checkFlag(c, flOperationID.Name)
+	if err != nil {
+		return err
+	}
+	op := management.OperationID(id)
+	lg := log.WithField("x-ms-operation-id", op)
+	lg.Info("Waiting for operation to complete.")
+	if err := cl.WaitForOperation(ctx, op); err != nil {
+		return errorf(exitCodeOperationFailure, "Operation (x-ms-operation-id=%s) failed: %v", op, err)
+	}
+	lg.Info("Operation finished.")
+	return nil
+}
+
+func getOperationStatus(ctx context.Context, c *cli.Context) error {
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	opID, err := checkFlag(c, flOperationID.Name)
+	if err != nil {
+		return err
+	}
+	id := management.OperationID(opID)
+	op, err := cl.GetOperationStatus(ctx, id)
+	if err != nil {
+		return wrapf(err, "Cannot get status of operation %s: %v", id, err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetColWidth(4000)
+	table.SetHeader([]string{"Field", "Value"})
+	table.AppendBulk(operationStatusRows(op))
+	table.Render()
+
+	if _, err := operationResult(id, op); err != nil {
+		return errorf(exitCodeOperationFailure, "Operation (x-ms-operation-id=%s) failed: %v", id, err)
+	}
+	return nil
+}
+
+// operationStatusRows returns the fields of an operation status, with the
+// error code and message of failed operations.
+func operationStatusRows(op management.GetOperationStatusResponse) [][]string {
+	rows := [][]string{
+		{"Operation ID", op.ID},
+		{"Status", string(op.Status)},
+		{"HTTP Status", op.HTTPStatusCode},
+	}
+	if op.Error != nil {
+		rows = append(rows, []string{"Error Code", op.Error.Code}, []string{"Error Message", op.Error.Message})
+	}
+	return rows
+}
+
+// maxOperationsHistory is how far back the List Subscription Operations API
+// goes.
+const maxOperationsHistory = 90 * 24 * time.Hour
+
+func listOperations(ctx context.Context, c *cli.Context) error {
+	since, limit := c.Duration(flSince.Name), c.Int(flLimit.Name)
+	if since <= 0 || since > maxOperationsHistory {
+		return fmt.Errorf("--%s must be positive and at most %v", flSince.Name, maxOperationsHistory)
+	}
+	if limit < 0 {
+		return fmt.Errorf("--%s cannot be negative", flLimit.Name)
+	}
+
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	l, err := cl.ListOperations(ctx, now.Add(-since), now)
+	if err != nil {
+		return wrapf(err, "Request failed: %v", err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetColWidth(4000)
+	table.SetHeader([]string{"Operation ID", "Operation", "Object", "Status", "Started"})
+	table.AppendBulk(operationRows(l.Operations, limit))
+	table.Render()
+	return nil
+}
+
+// operationRows returns the most recent operations as rows of a table, newest
+// first, limited to limit rows unless it is zero.
+func operationRows(ops []SubscriptionOperation, limit int) [][]string {
+	sorted := append([]SubscriptionOperation(nil), ops...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].StartedTime > sorted[j].StartedTime
+	})
+	if limit > 0 && len(sorted) > limit {
+		sorted = sorted[:limit]
+	}
+
+	rows := [][]string{}
+	for _, op := range sorted {
+		rows = append(rows, []string{op.ID, op.Name, op.ObjectID, op.Status.Status, formatPublishedDate(op.StartedTime)})
+	}
+	return rows
+}
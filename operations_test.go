@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/management"
+)
+
+func TestAppendOperation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "operations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, operationsFile)
+
+	for i := 0; i < maxRecordedOperations+1; i++ {
+		if err := appendOperation(path, operationRecord{ID: "first", Operation: "CreateExtension"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := appendOperation(path, operationRecord{ID: "last", Operation: "UpdateExtension"}); err != nil {
+		t.Fatal(err)
+	}
+
+	ops, err := readOperations(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != maxRecordedOperations {
+		t.Fatalf("Expected %d operations, but got %d", maxRecordedOperations, len(ops))
+	}
+	if last := ops[len(ops)-1]; last.ID != "last" || last.Operation != "UpdateExtension" {
+		t.Fatalf("Unexpected last operation %+v", last)
+	}
+}
+
+func TestReadOperationsMissingFile(t *testing.T) {
+	ops, err := readOperations(filepath.Join(os.TempDir(), "does-not-exist.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 0 {
+		t.Fatalf("Expected no operations, but got %+v", ops)
+	}
+}
+
+func TestOperationStatusRowsOfFailedOperation(t *testing.T) {
+	rows := operationStatusRows(management.GetOperationStatusResponse{
+		ID:             "operation-id",
+		Status:         management.OperationStatusFailed,
+		HTTPStatusCode: "400",
+		Error:          &management.AzureError{Code: "BadRequest", Message: "The MediaLink is not accessible."},
+	})
+	expected := [][]string{
+		{"Operation ID", "operation-id"},
+		{"Status", "Failed"},
+		{"HTTP Status", "400"},
+		{"Error Code", "BadRequest"},
+		{"Error Message", "The MediaLink is not accessible."},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Expected %q, but got %q", expected, rows)
+	}
+}
+
+func TestDetachedOperationIsNotAwaited(t *testing.T) {
+	dir, err := ioutil.TempDir("", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", dir)
+
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "DELETE" {
+			t.Errorf("Expected only the DELETE request, but got %s %s", r.Method, r.URL)
+		}
+		w.Header().Set(requestIDHeader, "operation-id")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	defer done()
+
+	cl.detach = true
+	if err := deleteExtensionAndWait(context.Background(), cl, "Microsoft.Azure.Extensions", "CustomScript", "2.0.1"); err != nil {
+		t.Fatal(err)
+	}
+	ops, err := readOperations(filepath.Join(dir, operationsFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 1 || ops[0].ID != "operation-id" {
+		t.Fatalf("Expected the operation to be recorded, but got %+v", ops)
+	}
+}
+
+func TestRunOperationWaitsForOperation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "home")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("HOME", os.Getenv("HOME"))
+	os.Setenv("HOME", dir)
+
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "PUT" {
+			w.Header().Set(requestIDHeader, "operation-id")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.Write([]byte(`<Operation xmlns="http://schemas.microsoft.com/windowsazure"><ID>operation-id</ID><Status>Failed</Status>` +
+			`<Error><Code>BadRequest</Code><Message>Invalid manifest</Message></Error></Operation>`))
+	})
+	defer done()
+
+	err = updateExtensionAndWait(context.Background(), cl, []byte(`<ExtensionImage/>`))
+	if exitCode(err) != exitCodeOperationFailure || !strings.Contains(err.Error(), "UpdateExtension (x-ms-operation-id=operation-id) failed") {
+		t.Fatalf("Expected the failure of the operation, but got: %v", err)
+	}
+}
+
+func TestListOperations(t *testing.T) {
+	var query url.Values
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		w.Write([]byte(`<SubscriptionOperationCollection xmlns="http://schemas.microsoft.com/windowsazure">
+  <SubscriptionOperations>
+    <SubscriptionOperation>
+      <OperationId>operation-1</OperationId>
+      <OperationObjectId>/subscription-id/services/extensions</OperationObjectId>
+      <OperationName>CreateExtension</OperationName>
+      <OperationStatus><Status>Succeeded</Status><HttpStatusCode>200</HttpStatusCode></OperationStatus>
+      <OperationStartedTime>2026-10-01T10:00:00Z</OperationStartedTime>
+    </SubscriptionOperation>
+    <SubscriptionOperation>
+      <OperationId>operation-2</OperationId>
+      <OperationObjectId>/subscription-id/services/extensions</OperationObjectId>
+      <OperationName>UpdateExtension</OperationName>
+      <OperationStatus><Status>Failed</Status><HttpStatusCode>400</HttpStatusCode></OperationStatus>
+      <OperationStartedTime>2026-10-02T10:00:00Z</OperationStartedTime>
+    </SubscriptionOperation>
+  </SubscriptionOperations>
+</SubscriptionOperationCollection>`))
+	})
+	defer done()
+
+	start := time.Date(2026, 9, 24, 10, 0, 0, 0, time.UTC)
+	l, err := cl.ListOperations(context.Background(), start, start.Add(7*24*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if query.Get("StartTime") != "2026-09-24T10:00:00Z" || query.Get("EndTime") != "2026-10-01T10:00:00Z" {
+		t.Fatalf("Unexpected time range in query %v", query)
+	}
+
+	rows := operationRows(l.Operations, 1)
+	expected := [][]string{{"operation-2", "UpdateExtension", "/subscription-id/services/extensions", "Failed", "2026-10-02 10:00:00"}}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Expected %q, but got %q", expected, rows)
+	}
+	if rows := operationRows(l.Operations, 0); len(rows) != 2 {
+		t.Fatalf("Expected all operations without a limit, but got %q", rows)
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/codegangsta/cli"
+)
+
+// outputFormat returns the format requested with --output, honoring the
+// legacy --json flag.
+func outputFormat(c *cli.Context) (string, error) {
+	output := stringFlag(c, "output")
+	if c.Bool(flJSON.Name) {
+		output = "json"
+	}
+	switch output {
+	case "table", "json", "csv":
+		return output, nil
+	}
+	return "", fmt.Errorf("Unsupported output format %q, must be one of: table, json, csv", output)
+}
+
+// stderr is where logs and progress are written. setupLogging replaces it with
+// a syncWriter shared by the logger and the spinners.
+var stderr io.Writer = os.Stderr
+
+// syncWriter serializes the writes to w, so that the output of concurrent
+// goroutines, e.g. the logs of a batch and a spinner, never interleaves within
+// a write. Tables of parallel commands are instead rendered once all results
+// are collected.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+
+	// partial is set while the last write did not end a line, e.g. a
+	// spinner frame, which is erased before a new line is written over it.
+	partial bool
+}
+
+func newSyncWriter(w io.Writer) *syncWriter {
+	return &syncWriter{w: w}
+}
+
+func (s *syncWriter) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if s.partial && p[0] != '\r' {
+		if _, err := io.WriteString(s.w, "\r\033[K"); err != nil {
+			return 0, err
+		}
+	}
+	s.partial = p[len(p)-1] != '\n'
+	return s.w.Write(p)
+}
+
+// writeCSV writes the header and rows as RFC 4180 CSV, quoting fields
+// containing separators or quotes.
+func writeCSV(w io.Writer, header []string, rows [][]string) error {
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	if err := cw.Write(header); err != nil {
+		return err
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return fmt.Errorf("failed to format as csv: %v", err)
+	}
+	return nil
+}
+
+// parseSelect parses the comma-separated field names given with --select into
+// the names of the fields of the struct type t, ignoring case.
+func parseSelect(t reflect.Type, s string) ([]string, error) {
+	var valid []string
+	for i := 0; i < t.NumField(); i++ {
+		valid = append(valid, t.Field(i).Name)
+	}
+
+	var fields []string
+	for _, f := range strings.Split(s, ",") {
+		f = strings.TrimSpace(f)
+		name := ""
+		for _, v := range valid {
+			if strings.EqualFold(v, f) {
+				name = v
+			}
+		}
+		if name == "" {
+			return nil, fmt.Errorf("Unknown field %q, must be one of: %s", f, strings.Join(valid, ", "))
+		}
+		fields = append(fields, name)
+	}
+	return fields, nil
+}
+
+// projection is a JSON object of the selected fields of a struct, in the
+// order they were selected.
+type projection struct {
+	v      reflect.Value
+	fields []string
+}
+
+func (p projection) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	for i, f := range p.fields {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		k, _ := json.Marshal(f)
+		v, err := json.Marshal(p.v.FieldByName(f).Interface())
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// project returns the selected fields of each struct of a slice, to be
+// marshaled to JSON.
+func project(items interface{}, fields []string) []projection {
+	v := reflect.ValueOf(items)
+	p := make([]projection, v.Len())
+	for i := range p {
+		p[i] = projection{v.Index(i), fields}
+	}
+	return p
+}
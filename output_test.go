@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriteCSVQuotesFields(t *testing.T) {
+	var b bytes.Buffer
+	err := writeCSV(&b, []string{"Version", "Regions"}, [][]string{
+		{"2.0.1", "West US,East US"},
+		{"2.0.2", `say "hi"`},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Version,Regions\r\n2.0.1,\"West US,East US\"\r\n2.0.2,\"say \"\"hi\"\"\"\r\n"
+	if b.String() != expected {
+		t.Fatalf("Expected %q, but got %q", expected, b.String())
+	}
+}
+
+func TestSelectFields(t *testing.T) {
+	typ := reflect.TypeOf(PublishedExtension{})
+	fields, err := parseSelect(typ, "version, Ns,replicationcompleted")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := json.Marshal(project([]PublishedExtension{{Ns: "Microsoft.Azure.Extensions", Name: "CustomScript", Version: "2.0.1", ReplicationCompleted: true}}, fields))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[{"Version":"2.0.1","Ns":"Microsoft.Azure.Extensions","ReplicationCompleted":true}]`
+	if string(b) != expected {
+		t.Fatalf("Expected %s, but got %s", expected, b)
+	}
+
+	if _, err := parseSelect(typ, "Ns,Namespace"); err == nil || !strings.Contains(err.Error(), `Unknown field "Namespace", must be one of: Ns, Name, Version`) {
+		t.Fatalf("Expected an error listing the valid fields, but got: %v", err)
+	}
+}
+
+func TestSyncWriterErasesPartialLines(t *testing.T) {
+	var b bytes.Buffer
+	w := newSyncWriter(&b)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.Write([]byte("a line\n"))
+		}()
+	}
+	wg.Wait()
+	if expected := strings.Repeat("a line\n", 10); b.String() != expected {
+		t.Fatalf("Expected %q, but got %q", expected, b.String())
+	}
+
+	b.Reset()
+	w.Write([]byte("\r| Waiting"))
+	w.Write([]byte("\r/ Waiting"))
+	w.Write([]byte("a log line\n"))
+	if expected := "\r| Waiting\r/ Waiting\r\033[Ka log line\n"; b.String() != expected {
+		t.Fatalf("Expected %q, but got %q", expected, b.String())
+	}
+}
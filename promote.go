@@ -1,42 +1,80 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"strings"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 )
 
-func promoteToRegions(c *cli.Context) {
+func promoteToRegions(ctx context.Context, c *cli.Context) error {
 	regions := c.StringSlice(flRegion.Name)
 
 	if len(regions) == 0 {
-		log.Fatalf("At least one region must be specified!")
-		return
+		return errors.New("At least one region must be specified!")
 	}
 
 	normalizedRegions := normalizeRegionList(regions)
 
-	if err := promoteExtension(c, func() (extensionManifest, error) {
-		return newExtensionImageManifest(checkFlag(c, flManifest.Name), normalizedRegions)
+	if err := promoteExtension(ctx, c, func() (extensionManifest, error) {
+		manifestFile, err := checkFlag(c, flManifest.Name)
+		if err != nil {
+			return nil, err
+		}
+		return newExtensionImageManifest(manifestFile, normalizedRegions)
 	}); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	log.Infof("Extension is promoted to PROD in %s. See replication-status.", strings.Join(regions, ","))
+	return nil
 }
 
-func promoteToAllRegions(c *cli.Context) {
-	if err := promoteExtension(c, func() (extensionManifest, error) {
-		return newExtensionImageGlobalManifest(checkFlag(c, flManifest.Name))
+func promoteToAllRegions(ctx context.Context, c *cli.Context) error {
+	if err := promoteExtension(ctx, c, func() (extensionManifest, error) {
+		manifestFile, err := checkFlag(c, flManifest.Name)
+		if err != nil {
+			return nil, err
+		}
+		return newExtensionImageGlobalManifest(manifestFile)
 	}); err != nil {
-		log.Fatal(err)
+		return err
 	}
 
 	log.Info("Extension is promoted to all regions. See replication-status.")
+	return nil
+}
+
+func promoteVersion(ctx context.Context, c *cli.Context) error {
+	ns, name, version, err := checkVersionFlags(c)
+	if err != nil {
+		return err
+	}
+	if !c.Bool(flConfirm.Name) {
+		return fmt.Errorf("Making %s.%s version %s public cannot be easily reversed, pass --%s to proceed.", ns, name, version, flConfirm.Name)
+	}
+
+	b, err := newVisibilityManifest(ns, name, version, false, c.Bool(flIsXMLExtension.Name))
+	if err != nil {
+		return err
+	}
+
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	if err := updateExtensionAndWait(ctx, cl, b); err != nil {
+		return err
+	}
+
+	log.Infof("Extension %s.%s version %s is now public.", ns, name, version)
+	return nil
 }
 
-func promoteExtension(c *cli.Context, factory func() (extensionManifest, error)) error {
+func promoteExtension(ctx context.Context, c *cli.Context, factory func() (extensionManifest, error)) error {
 	manifest, err := factory()
 	if err != nil {
 		return err
@@ -47,6 +85,9 @@ func promoteExtension(c *cli.Context, factory func() (extensionManifest, error))
 		return err
 	}
 
-	return publishExtension(c, "UpdateExtension", b,
-		mkClient(checkFlag(c, flMgtURL.Name), checkFlag(c, flSubsID.Name), checkFlag(c, flSubsCert.Name)).UpdateExtension)
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	return publishExtension(ctx, cl, "UpdateExtension", b, cl.UpdateExtension)
 }
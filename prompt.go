@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+var (
+	// stdin is shared by all prompts, which would otherwise lose the input
+	// buffered by each other.
+	stdin = bufio.NewReader(os.Stdin)
+
+	// prompted holds the values entered for missing flags, so that each flag
+	// is only prompted for once.
+	prompted = map[string]string{}
+)
+
+// interactive reports whether missing required flags are prompted for, which
+// is only the case with --interactive when stdin is a terminal, so that
+// scripts keep failing on them.
+func interactive(c *cli.Context) bool {
+	return c.GlobalBool(flInteractive.Name) && isTerminal(os.Stdin)
+}
+
+// promptMissingFlag prompts for the value of a missing required flag, or
+// returns "" if none could be read.
+func promptMissingFlag(c *cli.Context, fl string) string {
+	if v, ok := prompted[fl]; ok {
+		return v
+	}
+	var usage string
+	if sf, ok := commandStringFlag(c, fl); ok {
+		usage = sf.Usage
+	}
+	v, err := promptFlag(stdin, stderr, fl, usage)
+	if err != nil {
+		log.Debugf("Cannot read argument %q: %v", fl, err)
+		return ""
+	}
+	prompted[fl] = v
+	return v
+}
+
+// promptFlag writes a prompt for the flag to w and reads its value from r,
+// prompting again until a value is entered.
+func promptFlag(r *bufio.Reader, w io.Writer, fl, usage string) (string, error) {
+	prompt := fmt.Sprintf("--%s: ", fl)
+	if usage != "" {
+		prompt = fmt.Sprintf("%s (--%s): ", usage, fl)
+	}
+	for {
+		fmt.Fprint(w, prompt)
+		line, err := r.ReadString('\n')
+		if v := strings.TrimSpace(line); v != "" {
+			return v, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestPromptFlag(t *testing.T) {
+	var out bytes.Buffer
+	r := bufio.NewReader(strings.NewReader("\n  \n 00000000-0000-0000-0000-000000000000 \nCustomScript"))
+
+	v, err := promptFlag(r, &out, flSubsID.Name, "Subscription ID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := "00000000-0000-0000-0000-000000000000"; v != expected {
+		t.Fatalf("Expected %q, but got %q", expected, v)
+	}
+	if expected := strings.Repeat("Subscription ID (--subscription-id): ", 3); out.String() != expected {
+		t.Fatalf("Expected to be prompted until a value is entered, but got %q", out.String())
+	}
+
+	// The last line may not end with a newline.
+	if v, err := promptFlag(r, &out, flName.Name, ""); err != nil || v != "CustomScript" {
+		t.Fatalf("Expected \"CustomScript\", but got %q, %v", v, err)
+	}
+	if _, err := promptFlag(r, &out, flVersion.Name, ""); err != io.EOF {
+		t.Fatalf("Expected EOF, but got %v", err)
+	}
+}
@@ -1,24 +1,21 @@
 package main
 
 import (
+	"context"
+	"encoding/xml"
 	"fmt"
 	"io/ioutil"
-	"os"
 	"path/filepath"
-	"time"
 
 	"github.com/Azure/azure-sdk-for-go/management"
-	"github.com/Azure/azure-sdk-for-go/management/storageservice"
-	"github.com/Azure/azure-sdk-for-go/storage"
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 )
 
-const (
-	containerName = "extension-packages"
-)
-
-func publishExtension(c *cli.Context, operationName string, manifest []byte, op func([]byte) (management.OperationID, error)) error {
+func publishExtension(ctx context.Context, cl ExtensionsClient, operationName string, manifest []byte, op func(context.Context, []byte) (management.OperationID, error)) error {
+	if err := validateManifest(manifest); err != nil {
+		return err
+	}
 	log.Infof("%s operation starting...", operationName)
 
 	mPath, err := saveManifestForDebugging(manifest)
@@ -27,17 +24,9 @@ func publishExtension(c *cli.Context, operationName string, manifest []byte, op
 	}
 	log.Debugf("Saving used manifest for debugging: %s", mPath)
 
-	cl := mkClient(checkFlag(c, flMgtURL.Name), checkFlag(c, flSubsID.Name), checkFlag(c, flSubsCert.Name))
-	opID, err := op(manifest)
-	if err != nil {
-		return fmt.Errorf("Error: %v", err)
-	}
-	log.Debugf("%s operation started.", operationName)
-	if err := cl.WaitForOperation(opID); err != nil {
-		return fmt.Errorf("%s failed: %v", operationName, err)
-	}
-	log.Infof("%s operation finished.", operationName)
-	return nil
+	return runOperation(ctx, cl, operationName, func() (management.OperationID, error) {
+		return op(ctx, manifest)
+	})
 }
 
 func saveManifestForDebugging(contents []byte) (string, error) {
@@ -59,65 +48,235 @@ func saveManifestForDebugging(contents []byte) (string, error) {
 	return filepath.Join(dir, fi.Name()), nil
 }
 
-func publishExtensionFromManifestFile(c *cli.Context, operationName, manifestPath string, op func([]byte) (management.OperationID, error)) error {
-	b, err := ioutil.ReadFile(manifestPath)
+func publishExtensionFromManifestFile(ctx context.Context, cl ExtensionsClient, operationName, manifestPath string, op func(context.Context, []byte) (management.OperationID, error)) error {
+	b, err := readManifestFile(manifestPath)
 	if err != nil {
 		return fmt.Errorf("Error reading manifest: %v", err)
 	}
-	return publishExtension(c, operationName, b, op)
+	return publishExtension(ctx, cl, operationName, b, op)
 }
 
-func createExtension(c *cli.Context) {
-	cl := mkClient(checkFlag(c, flMgtURL.Name), checkFlag(c, flSubsID.Name), checkFlag(c, flSubsCert.Name))
-	if err := publishExtensionFromManifestFile(c, "CreateExtension",
-		checkFlag(c, flManifest.Name), cl.CreateExtension); err != nil {
-		log.Fatal(err)
+func createExtension(ctx context.Context, c *cli.Context) error {
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	cl.detach = !c.BoolT(flWaitOperation.Name)
+	manifestFile, err := checkFlag(c, flManifest.Name)
+	if err != nil {
+		return err
 	}
+	return publishExtensionFromManifestFile(ctx, cl, "CreateExtension", manifestFile, cl.CreateExtension)
 }
 
-func updateExtension(c *cli.Context) {
-	cl := mkClient(checkFlag(c, flMgtURL.Name), checkFlag(c, flSubsID.Name), checkFlag(c, flSubsCert.Name))
-	if err := publishExtensionFromManifestFile(c, "UpdateExtension", checkFlag(c, flManifest.Name),
-		cl.UpdateExtension); err != nil {
-		log.Fatal(err)
+func updateExtension(ctx context.Context, c *cli.Context) error {
+	manifestFile, err := checkFlag(c, flManifest.Name)
+	if err != nil {
+		return err
+	}
+	b, err := readManifestFile(manifestFile)
+	if err != nil {
+		return fmt.Errorf("Error reading manifest: %v", err)
+	}
+	if err := validateManifest(b); err != nil {
+		return err
+	}
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	if err := checkDowngrade(ctx, cl, b, c.Bool(flAllowDowngrade.Name)); err != nil {
+		return err
 	}
+	cl.detach = !c.BoolT(flWaitOperation.Name)
+	return publishExtension(ctx, cl, "UpdateExtension", b, cl.UpdateExtension)
 }
 
-func uploadBlob(cl ExtensionsClient, storageRealm, storageAccount, packagePath string) (string, error) {
-	// Fetch keys for storage account
-	svc := storageservice.NewClient(cl.client)
-	keys, err := svc.GetStorageServiceKeys(storageAccount)
-	if err != nil {
-		return "", fmt.Errorf("Could not fetch keys for storage account. Make sure it is in publisher subscription. Error: %v", err)
+func publishVersion(ctx context.Context, c *cli.Context) error {
+	for _, fl := range []string{flShowManifest.Name, flWaitReplication.Name} {
+		if c.Bool(fl) && !c.BoolT(flWaitOperation.Name) {
+			return fmt.Errorf("--%s cannot be used with --%s=false", fl, flWaitOperation.Name)
+		}
+	}
+	var report *stepReport
+	if c.Bool(flSummary.Name) {
+		output, err := outputFormat(c)
+		if err != nil {
+			return err
+		}
+		// The manifest is printed to stdout as XML, where it cannot be told
+		// apart from a summary meant for other programs.
+		if output != "table" && c.Bool(flShowManifest.Name) {
+			return fmt.Errorf("--%s cannot be used with --%s and --output %s", flShowManifest.Name, flSummary.Name, output)
+		}
+		report = &stepReport{}
+		defer func() {
+			if err := report.print(output); err != nil {
+				log.Errorf("Cannot print the summary: %v", err)
+			}
+		}()
 	}
-	log.Debug("Retrieved storage account keys.")
 
-	// Read package
-	pkg, err := os.OpenFile(packagePath, os.O_RDONLY, 0777)
+	var b []byte
+	err := report.run("validate", func() error {
+		manifestFile, err := checkFlag(c, flManifest.Name)
+		if err != nil {
+			return err
+		}
+		if b, err = readManifestFile(manifestFile); err != nil {
+			return fmt.Errorf("Error reading manifest: %v", err)
+		}
+		return validateManifest(b)
+	})
 	if err != nil {
-		return "", fmt.Errorf("Could not reach package file: %v", err)
+		return err
 	}
-	defer pkg.Close()
 
-	// Upload blob
-	sc, err := storage.NewClient(storageAccount, keys.PrimaryKey, storageRealm, storage.DefaultAPIVersion, true)
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	published := false
+	err = report.run("check", func() error {
+		if c.Bool(flIfNotExists.Name) {
+			var m extensionImage
+			if err := xml.Unmarshal(b, &m); err != nil {
+				return fmt.Errorf("Error parsing manifest: %v", err)
+			}
+			_, err := cl.GetExtension(ctx, m.ProviderNameSpace, m.Type, m.Version)
+			if err == nil {
+				log.WithFields(log.Fields{
+					"namespace": m.ProviderNameSpace,
+					"name":      m.Type,
+					"version":   m.Version,
+				}).Info("Version is already published, nothing to do.")
+				published = true
+				return nil
+			}
+			if err != ErrExtensionNotFound {
+				return wrapf(err, "Cannot check if the version is already published: %v", err)
+			}
+		}
+		return checkDowngrade(ctx, cl, b, c.Bool(flAllowDowngrade.Name))
+	})
 	if err != nil {
-		return "", fmt.Errorf("Could not create storage client: %v", err)
+		return err
+	}
+	if published {
+		report.skip("publish")
+		return nil
 	}
 
-	bs := sc.GetBlobService()
-	container := bs.GetContainerReference(containerName)
-	opts := storage.CreateContainerOptions{
-		Access: storage.ContainerAccessTypeBlob,
+	cl.detach = !c.BoolT(flWaitOperation.Name)
+	if !c.Bool(flWaitReplication.Name) {
+		if err := report.run("publish", func() error { return createExtensionAndWait(ctx, cl, b) }); err != nil {
+			return err
+		}
+		if cl.detach {
+			report.mark(stepStarted)
+		}
+	} else if err := publishAndWaitForReplication(ctx, cl, b, report); err != nil {
+		return err
+	}
+	if c.Bool(flShowManifest.Name) {
+		return report.run("show-manifest", func() error { return showPublishedManifest(ctx, cl, b) })
 	}
+	return nil
+}
+
+// publishAndWaitForReplication publishes the version of the manifest and
+// waits for it to replicate to all of its locations. The operation timeout of
+// the client bounds both waits together.
+func publishAndWaitForReplication(ctx context.Context, cl ExtensionsClient, manifest []byte, report *stepReport) error {
+	var m extensionImage
+	if err := xml.Unmarshal(manifest, &m); err != nil {
+		return fmt.Errorf("Error parsing manifest: %v", err)
+	}
+	if cl.operationTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cl.operationTimeout)
+		defer cancel()
+	}
+
+	log.Info("Step 1/2: publishing the version.")
+	err := report.run("publish", func() error { return createExtensionAndWait(ctx, cl, manifest) })
+	if err == nil {
+		log.Info("Step 2/2: waiting for the version to replicate.")
+		err = report.run("replicate", func() error { return waitForReplication(ctx, cl, m.ProviderNameSpace, m.Type, m.Version) })
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return errorf(exitCodeOperationFailure, "Timed out after %v publishing %s.%s %s and waiting for its replication", cl.operationTimeout, m.ProviderNameSpace, m.Type, m.Version)
+	}
+	return err
+}
 
-	if _, err := container.CreateIfNotExists(&opts); err != nil {
-		return "", fmt.Errorf("Error creating blob container: %v", err)
+// showPublishedManifest prints the manifest Azure stored for the version of
+// the manifest, to check that all fields were accepted as intended.
+func showPublishedManifest(ctx context.Context, cl ExtensionsClient, manifest []byte) error {
+	var m extensionImage
+	if err := xml.Unmarshal(manifest, &m); err != nil {
+		return fmt.Errorf("Error parsing manifest: %v", err)
 	}
-	blobName := fmt.Sprintf("%d.zip", time.Now().Unix())
-	blob := container.GetBlobReference(blobName)
-	if err := blob.CreateBlockBlobFromReader(pkg, &storage.PutBlobOptions{}); err != nil {
-		return "", fmt.Errorf("Error uploading blob: %v", err)
+	published, err := cl.GetExtensionManifest(ctx, m.ProviderNameSpace, m.Type, m.Version)
+	if err != nil {
+		return wrapf(err, "Cannot get published version %s.%s %s: %v", m.ProviderNameSpace, m.Type, m.Version, err)
 	}
-	return blob.GetURL(), nil
+	fmt.Println(string(published))
+	return nil
+}
+
+// checkDowngrade fails, unless allowed, if a newer version of the extension of
+// the manifest is already published. Updating a published version is not a
+// downgrade.
+func checkDowngrade(ctx context.Context, cl ExtensionsClient, manifest []byte, allow bool) error {
+	var m extensionImage
+	if err := xml.Unmarshal(manifest, &m); err != nil {
+		return fmt.Errorf("Error parsing manifest: %v", err)
+	}
+	l, err := cl.ListVersions(ctx)
+	if err != nil {
+		return wrapf(err, "Cannot list published versions: %v", err)
+	}
+	newer, err := newerVersion(filterVersions(l.Extensions, m.ProviderNameSpace, m.Type), m.Version)
+	if err != nil || newer == "" {
+		return err
+	}
+	if allow {
+		log.Warnf("Version %s is older than the published version %s.", m.Version, newer)
+		return nil
+	}
+	return fmt.Errorf("Version %s is older than the published version %s, pass --%s if this is intended.", m.Version, newer, flAllowDowngrade.Name)
+}
+
+// newerVersion returns the newest of the versions of the extensions if it is
+// newer than version, or "" if it is not or version is one of them.
+func newerVersion(extensions []PublishedExtension, version string) (string, error) {
+	newest := ""
+	for _, e := range extensions {
+		cmp, err := compareVersions(e.Version, version)
+		if err != nil {
+			return "", err
+		}
+		if cmp == 0 {
+			return "", nil
+		} else if cmp < 0 {
+			continue
+		}
+		if newest == "" {
+			newest = e.Version
+		} else if cmp, err := compareVersions(e.Version, newest); err != nil {
+			return "", err
+		} else if cmp > 0 {
+			newest = e.Version
+		}
+	}
+	return newest, nil
+}
+
+// createExtensionAndWait publishes the extension version of the manifest and
+// waits for the operation to finish.
+func createExtensionAndWait(ctx context.Context, cl ExtensionsClient, manifest []byte) error {
+	return runOperation(ctx, cl, "CreateExtension", func() (management.OperationID, error) {
+		return cl.CreateExtension(ctx, manifest)
+	})
 }
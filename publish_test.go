@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/codegangsta/cli"
+)
+
+func TestNewerVersion(t *testing.T) {
+	published := []PublishedExtension{{Version: "1.0.0"}, {Version: "1.10.0"}, {Version: "1.2.0"}}
+	for _, tc := range []struct {
+		version, expected string
+	}{
+		{"1.11.0", ""},
+		{"1.10.0", ""},
+		{"1.3.0", "1.10.0"},
+		{"1.2", ""},
+		{"0.9", "1.10.0"},
+	} {
+		newer, err := newerVersion(published, tc.version)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if newer != tc.expected {
+			t.Fatalf("%s: expected newer version %q, but got %q", tc.version, tc.expected, newer)
+		}
+	}
+
+	if _, err := newerVersion(published, "1.x"); err == nil {
+		t.Fatal("Expected an error for an invalid version")
+	}
+}
+
+func TestPublishVersionRejectsManifestWithMachineReadableSummary(t *testing.T) {
+	for _, output := range []string{"json", "csv"} {
+		set := flag.NewFlagSet("publish", flag.ContinueOnError)
+		set.Bool(flShowManifest.Name, true, "")
+		set.Bool(flWaitOperation.Name, true, "")
+		set.Bool(flSummary.Name, true, "")
+		set.String("output", output, "")
+		c := cli.NewContext(nil, set, cli.NewContext(nil, flag.NewFlagSet("global", flag.ContinueOnError), nil))
+
+		err := publishVersion(context.Background(), c)
+		if err == nil || !strings.Contains(err.Error(), "--show-manifest cannot be used with --summary") {
+			t.Errorf("%s: expected an error about --show-manifest, but got: %v", output, err)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/olekukonko/tablewriter"
+)
+
+// Results of publishing a manifest of a batch.
+const (
+	batchPublished = "published"
+	batchFailed    = "failed"
+	batchSkipped   = "skipped"
+)
+
+// batchResult is the result of publishing a manifest of a batch.
+type batchResult struct {
+	Manifest string
+	Result   string
+	err      error
+}
+
+func publishBatch(ctx context.Context, c *cli.Context) error {
+	dir, err := checkFlag(c, flManifestDir.Name)
+	if err != nil {
+		return err
+	}
+	manifests, err := filepath.Glob(filepath.Join(dir, "*.xml"))
+	if err != nil {
+		return err
+	}
+	if len(manifests) == 0 {
+		return fmt.Errorf("No *.xml manifests found in %s", dir)
+	}
+	sort.Strings(manifests)
+
+	concurrency := c.Int(flBatchConcurrency.Name)
+	if concurrency < 1 {
+		return fmt.Errorf("--%s must be at least 1", flBatchConcurrency.Name)
+	}
+
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	if concurrency > 1 {
+		// Spinners of concurrent operations would overwrite each other.
+		cl.showProgress = false
+	}
+
+	results := publishManifests(manifests, concurrency, c.Bool(flFailFast.Name), func(path string) error {
+		b, err := readManifestFile(path)
+		if err != nil {
+			return fmt.Errorf("Error reading manifest: %v", err)
+		}
+		if err := validateManifest(b); err != nil {
+			return err
+		}
+		if err := checkDowngrade(ctx, cl, b, c.Bool(flAllowDowngrade.Name)); err != nil {
+			return err
+		}
+		return createExtensionAndWait(ctx, cl, b)
+	})
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetColWidth(4000)
+	table.SetHeader([]string{"Manifest", "Result", "Error"})
+	failed := 0
+	for _, r := range results {
+		msg := ""
+		if r.err != nil {
+			msg = r.err.Error()
+		}
+		if r.Result != batchPublished {
+			failed++
+		}
+		table.Append([]string{filepath.Base(r.Manifest), r.Result, msg})
+	}
+	table.Render()
+
+	if failed > 0 {
+		return errorf(exitCodeOperationFailure, "%d of %d manifests were not published.", failed, len(results))
+	}
+	return nil
+}
+
+// publishManifests publishes the manifests with at most concurrency
+// publishes at a time, and returns their results in the order of manifests.
+// If failFast is set, manifests not started yet after a failure are skipped.
+func publishManifests(manifests []string, concurrency int, failFast bool, publish func(string) error) []batchResult {
+	results := make([]batchResult, len(manifests))
+	var (
+		mu     sync.Mutex
+		failed bool
+		wg     sync.WaitGroup
+		jobs   = make(chan int)
+	)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				path := manifests[j]
+				mu.Lock()
+				skip := failFast && failed
+				mu.Unlock()
+				if skip {
+					results[j] = batchResult{Manifest: path, Result: batchSkipped}
+					continue
+				}
+
+				lg := log.WithField("manifest", path)
+				lg.Info("Publishing manifest.")
+				if err := publish(path); err != nil {
+					lg.Errorf("Failed to publish manifest: %v", err)
+					results[j] = batchResult{Manifest: path, Result: batchFailed, err: err}
+					mu.Lock()
+					failed = true
+					mu.Unlock()
+					continue
+				}
+				results[j] = batchResult{Manifest: path, Result: batchPublished}
+			}
+		}()
+	}
+	for i := range manifests {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
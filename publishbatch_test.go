@@ -0,0 +1,31 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestPublishManifests(t *testing.T) {
+	manifests := []string{"a.xml", "b.xml", "c.xml"}
+	publish := func(path string) error {
+		if path == "b.xml" {
+			return errors.New("MediaLink is required")
+		}
+		return nil
+	}
+	results := func(failFast bool) []string {
+		var r []string
+		for _, res := range publishManifests(manifests, 1, failFast, publish) {
+			r = append(r, res.Manifest+" "+res.Result)
+		}
+		return r
+	}
+
+	if expected := []string{"a.xml published", "b.xml failed", "c.xml published"}; !reflect.DeepEqual(results(false), expected) {
+		t.Fatalf("Expected %q, but got %q", expected, results(false))
+	}
+	if expected := []string{"a.xml published", "b.xml failed", "c.xml skipped"}; !reflect.DeepEqual(results(true), expected) {
+		t.Fatalf("Expected %q with --fail-fast, but got %q", expected, results(true))
+	}
+}
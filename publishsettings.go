@@ -0,0 +1,78 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
+
+	"golang.org/x/crypto/pkcs12"
+)
+
+// publishSettings is the subscription ID, management certificate and
+// management URL of a subscription in a .publishsettings file. The SDK only
+// reads them into a management.Client, so they are read here to create an
+// asmClient.
+type publishSettings struct {
+	SubscriptionID string
+	Cert           []byte
+	ManagementURL  string
+}
+
+// readPublishSettings reads the subscription with the given ID from a
+// .publishsettings file. If subscriptionID is empty, the first subscription in
+// the file is read.
+func readPublishSettings(filename, subscriptionID string) (publishSettings, error) {
+	var ps publishSettings
+
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return ps, err
+	}
+
+	var data struct {
+		Profiles []struct {
+			ManagementCertificate string `xml:",attr"`
+			Subscriptions         []struct {
+				ID                    string `xml:"Id,attr"`
+				ServiceManagementURL  string `xml:"ServiceManagementUrl,attr"`
+				ManagementCertificate string `xml:",attr"`
+			} `xml:"Subscription"`
+		} `xml:"PublishProfile"`
+	}
+	if err := xml.Unmarshal(b, &data); err != nil {
+		return ps, err
+	}
+
+	for _, profile := range data.Profiles {
+		for _, sub := range profile.Subscriptions {
+			if subscriptionID != "" && sub.ID != subscriptionID {
+				continue
+			}
+
+			// Schema version 1.0 has the certificate on the profile, 2.0 on
+			// each subscription.
+			base64Cert := sub.ManagementCertificate
+			if base64Cert == "" {
+				base64Cert = profile.ManagementCertificate
+			}
+			pfx, err := base64.StdEncoding.DecodeString(base64Cert)
+			if err != nil {
+				return ps, fmt.Errorf("cannot decode management certificate: %v", err)
+			}
+			pemBlocks, err := pkcs12.ToPEM(pfx, "")
+			if err != nil {
+				return ps, fmt.Errorf("cannot read management certificate: %v", err)
+			}
+			for _, p := range pemBlocks {
+				ps.Cert = append(ps.Cert, pem.EncodeToMemory(p)...)
+			}
+
+			ps.SubscriptionID = sub.ID
+			ps.ManagementURL = sub.ServiceManagementURL
+			return ps, nil
+		}
+	}
+	return ps, fmt.Errorf("could not find subscription %q in publish settings", subscriptionID)
+}
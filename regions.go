@@ -1,6 +1,19 @@
 package main
 
-import "strings"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/management"
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/olekukonko/tablewriter"
+)
 
 var (
 	// Region names differ between Service Management and Resource Manager.
@@ -91,6 +104,100 @@ var (
 	}
 )
 
+// parseRegionList splits a comma-separated list of regions, trimming the
+// whitespace around each region name.
+func parseRegionList(s string) ([]string, error) {
+	regions := strings.Split(s, ",")
+	for i := range regions {
+		regions[i] = strings.TrimSpace(regions[i])
+		if regions[i] == "" {
+			return nil, fmt.Errorf("region list %q contains an empty region name", s)
+		}
+	}
+
+	return regions, nil
+}
+
+// parseRegionFile parses a file of one region per line. Blank lines and
+// comments starting with '#' are ignored.
+func parseRegionFile(b []byte) ([]string, error) {
+	var regions []string
+	for _, line := range strings.Split(string(b), "\n") {
+		if i := strings.Index(line, "#"); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			regions = append(regions, line)
+		}
+	}
+	if len(regions) == 0 {
+		return nil, errors.New("no regions found")
+	}
+	return regions, nil
+}
+
+// regionsFlag returns the regions of the comma-separated list given with
+// --regions, or else read from --region-file, or else of the --ring, or nil if
+// none of them is given.
+func regionsFlag(c *cli.Context, list string) ([]string, error) {
+	file, ring := stringFlag(c, flRegionFile.Name), stringFlag(c, flRing.Name)
+	given := 0
+	for _, v := range []string{list, file, ring} {
+		if v != "" {
+			given++
+		}
+	}
+	if given > 1 {
+		return nil, fmt.Errorf("Only one of --%s, --%s or --%s can be used", flRegions.Name, flRegionFile.Name, flRing.Name)
+	}
+	if ring != "" {
+		return ringRegions(config, ring)
+	}
+	if file != "" {
+		b, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("Error reading region file: %v", err)
+		}
+		regions, err := parseRegionFile(b)
+		if err != nil {
+			return nil, fmt.Errorf("Error parsing region file %s: %v", file, err)
+		}
+		return regions, nil
+	}
+	if list == "" {
+		return nil, nil
+	}
+	return parseRegionList(list)
+}
+
+// ringConfigPrefix prefixes the names of the rollout rings in the config file,
+// e.g. "ring.canary: West Central US, East US 2 EUAP".
+const ringConfigPrefix = "ring."
+
+// ringRegions returns the regions of the rollout ring with the given name in
+// the config file.
+func ringRegions(config map[string]string, ring string) ([]string, error) {
+	list, ok := config[ringConfigPrefix+ring]
+	if !ok {
+		var rings []string
+		for k := range config {
+			if strings.HasPrefix(k, ringConfigPrefix) {
+				rings = append(rings, strings.TrimPrefix(k, ringConfigPrefix))
+			}
+		}
+		if len(rings) == 0 {
+			return nil, fmt.Errorf("Unknown ring %q, no rings are defined in the config file, e.g. as \"%s%s: <regions>\"", ring, ringConfigPrefix, ring)
+		}
+		sort.Strings(rings)
+		return nil, fmt.Errorf("Unknown ring %q, must be one of: %s", ring, strings.Join(rings, ", "))
+	}
+	regions, err := parseRegionList(list)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid ring %q in the config file: %v", ring, err)
+	}
+	return regions, nil
+}
+
 func normalizeRegionList(regions []string) []string {
 	normalizedRegions := make([]string, len(regions))
 	for i := range regions {
@@ -109,3 +216,159 @@ func normalizeRegionName(region string) string {
 	lowered := strings.ToLower(region)
 	return strings.Replace(lowered, " ", "", -1)
 }
+
+// resolveRegions returns the Service Management names of the regions, or an
+// error listing the regions which are not available.
+func resolveRegions(l ListLocationsResponse, regions []string) ([]string, error) {
+	var resolved, unknown []string
+	for _, r := range normalizeRegionList(regions) {
+		name := ""
+		for _, loc := range l.Locations {
+			if normalizeRegionName(loc.Name) == normalizeRegionName(r) {
+				name = loc.Name
+				break
+			}
+		}
+		if name == "" {
+			unknown = append(unknown, r)
+		} else {
+			resolved = append(resolved, name)
+		}
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("Unknown regions %s, see list-regions for the available regions", strings.Join(unknown, ", "))
+	}
+	return resolved, nil
+}
+
+func replicate(ctx context.Context, c *cli.Context) error {
+	ns, name, version, err := checkVersionFlags(c)
+	if err != nil {
+		return err
+	}
+	regions, err := regionsFlag(c, stringFlag(c, flRegions.Name))
+	if err != nil {
+		return err
+	}
+	if len(regions) == 0 {
+		return fmt.Errorf("--%s, --%s or --%s must be provided", flRegions.Name, flRegionFile.Name, flRing.Name)
+	}
+
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	l, err := cl.ListLocations(ctx)
+	if err != nil {
+		return wrapf(err, "Cannot list regions: %v", err)
+	}
+	if regions, err = resolveRegions(l, regions); err != nil {
+		return err
+	}
+
+	log.Infof("Replicating %s.%s version %s to %s.", ns, name, version, strings.Join(regions, ", "))
+	err = runOperation(ctx, cl, "UpdateExtension", func() (management.OperationID, error) {
+		return cl.ReplicateExtension(ctx, ns, name, version, regions)
+	})
+	if err != nil {
+		return err
+	}
+	log.Info("Replication started. See replication-status.")
+	return nil
+}
+
+func listRegions(ctx context.Context, c *cli.Context) error {
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	l, err := cl.ListLocations(ctx)
+	if err != nil {
+		return wrapf(err, "Request failed: %v", err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Display Name", "Name", "Resource Manager Name"})
+	data := [][]string{}
+	for _, l := range l.Locations {
+		data = append(data, []string{l.DisplayName, l.Name, normalizeRegionName(l.Name)})
+	}
+	table.AppendBulk(data)
+	table.Render()
+	return nil
+}
+
+func checkRegions(ctx context.Context, c *cli.Context) error {
+	ns, name, version, err := checkVersionFlags(c)
+	if err != nil {
+		return err
+	}
+	regions, err := checkFlag(c, flExpectedRegions.Name)
+	if err != nil {
+		return err
+	}
+	expected, err := parseRegionList(regions)
+	if err != nil {
+		return err
+	}
+
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	status, err := cl.GetReplicationStatus(ctx, ns, name, version)
+	if err != nil {
+		return wrapf(err, "Cannot get replication status of %s.%s version %s: %v", ns, name, version, err)
+	}
+
+	rows, mismatches := regionCheckRows(normalizeRegionList(expected), status.Statuses)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Region", "Replication Status", "Check"})
+	table.AppendBulk(rows)
+	table.Render()
+
+	if mismatches > 0 {
+		return errorf(exitCodeOperationFailure, "%d regions of %s.%s version %s do not match the expected regions.", mismatches, ns, name, version)
+	}
+	log.Info("Version is replicated to exactly the expected regions.")
+	return nil
+}
+
+// regionCheckRows compares the expected regions of a version with the
+// regions it is replicated to. Expected regions where replication has not
+// completed are missing, and replicated regions which are not expected are
+// extra. It returns a row per region, sorted, and the number of mismatches.
+func regionCheckRows(expected []string, statuses []ReplicationStatus) ([][]string, int) {
+	status := map[string]ReplicationStatus{}
+	for _, s := range statuses {
+		status[normalizeRegionName(s.Location)] = s
+	}
+	isExpected := map[string]bool{}
+	for _, r := range expected {
+		isExpected[normalizeRegionName(r)] = true
+	}
+
+	var rows [][]string
+	mismatches := 0
+	for _, r := range expected {
+		s, ok := status[normalizeRegionName(r)]
+		switch {
+		case !ok:
+			rows = append(rows, []string{r, "", "missing"})
+			mismatches++
+		case s.Status != replicationStatusCompleted:
+			rows = append(rows, []string{s.Location, s.Status, "missing"})
+			mismatches++
+		default:
+			rows = append(rows, []string{s.Location, s.Status, "ok"})
+		}
+	}
+	for _, s := range statuses {
+		if !isExpected[normalizeRegionName(s.Location)] {
+			rows = append(rows, []string{s.Location, s.Status, "extra"})
+			mismatches++
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool { return rows[i][0] < rows[j][0] })
+	return rows, mismatches
+}
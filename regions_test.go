@@ -1,8 +1,12 @@
 package main
 
 import (
+	"flag"
+	"reflect"
 	"strings"
 	"testing"
+
+	"github.com/codegangsta/cli"
 )
 
 func TestNormalizeRegion(t *testing.T) {
@@ -67,3 +71,133 @@ func TestUnrecognizedRegionIsPassed(t *testing.T) {
 		t.Fatalf("Expected the region to by \"Candy Land East\", but got %q", regions[0])
 	}
 }
+
+func TestParseRegionList(t *testing.T) {
+	regions, err := parseRegionList(" South Central US,West US ")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(regions) != 2 {
+		t.Fatalf("There should be exactly two regions.")
+	}
+	if strings.Compare("South Central US", regions[0]) != 0 {
+		t.Fatalf("Expected the region to by \"South Central US\", but got %q", regions[0])
+	}
+	if strings.Compare("West US", regions[1]) != 0 {
+		t.Fatalf("Expected the region to by \"West US\", but got %q", regions[1])
+	}
+}
+
+func TestParseRegionListRejectsEmptyRegion(t *testing.T) {
+	if _, err := parseRegionList("West US,,East US"); err == nil {
+		t.Fatal("Expected an error for an empty region name")
+	}
+
+	if _, err := parseRegionList("West US, "); err == nil {
+		t.Fatal("Expected an error for a blank region name")
+	}
+}
+
+func TestResolveRegions(t *testing.T) {
+	l := ListLocationsResponse{Locations: []Location{{Name: "West US"}, {Name: "West Central US"}}}
+
+	regions, err := resolveRegions(l, []string{"westus", "West Central US"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(regions) != 2 || regions[0] != "West US" || regions[1] != "West Central US" {
+		t.Fatalf("Unexpected regions %q", regions)
+	}
+
+	if _, err := resolveRegions(l, []string{"West US", "Mars North"}); err == nil || !strings.Contains(err.Error(), "Mars North") {
+		t.Fatalf("Expected an error naming the unknown region, but got %v", err)
+	}
+}
+
+func TestRegionCheckRows(t *testing.T) {
+	rows, mismatches := regionCheckRows([]string{"West US", "eastus", "Japan East"}, []ReplicationStatus{
+		{Location: "West US", Status: "Completed"},
+		{Location: "East US", Status: "Replicating"},
+		{Location: "North Europe", Status: "Completed"},
+	})
+	expected := [][]string{
+		{"East US", "Replicating", "missing"},
+		{"Japan East", "", "missing"},
+		{"North Europe", "Completed", "extra"},
+		{"West US", "Completed", "ok"},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Expected rows %q, but got %q", expected, rows)
+	}
+	if mismatches != 3 {
+		t.Fatalf("Expected 3 mismatches, but got %d", mismatches)
+	}
+}
+
+func TestParseRegionFile(t *testing.T) {
+	regions, err := parseRegionFile([]byte(`# Canary regions
+Central US EUAP
+East US 2 EUAP  # paired
+
+West US
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"Central US EUAP", "East US 2 EUAP", "West US"}; !reflect.DeepEqual(regions, expected) {
+		t.Fatalf("Expected %q, but got %q", expected, regions)
+	}
+
+	if _, err := parseRegionFile([]byte("# no regions\n\n")); err == nil {
+		t.Fatal("Expected an error for a file without regions")
+	}
+}
+
+func TestRingRegions(t *testing.T) {
+	cfg, err := parseConfig([]byte(`ring.canary: Central US EUAP, East US 2 EUAP
+ring.pilot: "West Central US,West US"
+namespace: Microsoft.Azure.Extensions
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	regions, err := ringRegions(cfg, "pilot")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"West Central US", "West US"}; !reflect.DeepEqual(regions, expected) {
+		t.Fatalf("Expected %q, but got %q", expected, regions)
+	}
+
+	if _, err := ringRegions(cfg, "broad"); err == nil || !strings.Contains(err.Error(), "must be one of: canary, pilot") {
+		t.Fatalf("Expected an error listing the rings, but got: %v", err)
+	}
+	if _, err := ringRegions(map[string]string{}, "broad"); err == nil || !strings.Contains(err.Error(), `"ring.broad: <regions>"`) {
+		t.Fatalf("Expected an error on how to define the ring, but got: %v", err)
+	}
+}
+
+func TestRegionsFlagRing(t *testing.T) {
+	defer func(c map[string]string) { config = c }(config)
+	config = map[string]string{"ring.canary": "Central US EUAP, East US 2 EUAP"}
+
+	for _, tc := range []struct {
+		regions, ring string
+		expected      []string
+	}{
+		{"", "canary", []string{"Central US EUAP", "East US 2 EUAP"}},
+		{"West US", "", []string{"West US"}},
+		{"West US", "canary", nil},
+	} {
+		set := flag.NewFlagSet("replicate", flag.ContinueOnError)
+		set.String(flRegionFile.Name, "", "")
+		set.String(flRing.Name, tc.ring, "")
+		regions, err := regionsFlag(cli.NewContext(nil, set, nil), tc.regions)
+		if tc.expected == nil && err == nil {
+			t.Fatalf("%q, %q: expected an error for --regions with --ring", tc.regions, tc.ring)
+		} else if tc.expected != nil && (err != nil || !reflect.DeepEqual(regions, tc.expected)) {
+			t.Fatalf("%q, %q: expected %q, but got %q, %v", tc.regions, tc.ring, tc.expected, regions, err)
+		}
+	}
+}
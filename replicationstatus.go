@@ -1,34 +1,374 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 	"github.com/olekukonko/tablewriter"
 )
 
-func replicationStatus(c *cli.Context) {
-	cl := mkClient(checkFlag(c, flMgtURL.Name), checkFlag(c, flSubsID.Name), checkFlag(c, flSubsCert.Name))
-	ns, name, version := checkFlag(c, flNamespace.Name), checkFlag(c, flName.Name), checkFlag(c, flVersion.Name)
-	json := c.Bool(flJSON.Name)
-	log.Debug("Requesting replication status.")
-	rs, err := cl.GetReplicationStatus(ns, name, version)
+// Terminal replication states reported for a location.
+const (
+	replicationStatusCompleted = "Completed"
+	replicationStatusFailed    = "Failed"
+)
+
+func replicationStatus(ctx context.Context, c *cli.Context) error {
+	clients, err := mkClients(ctx, c)
 	if err != nil {
-		log.Fatalf("Cannot fetch replication status: %v", err)
+		return err
+	}
+	if len(clients) > 1 {
+		return replicationStatusOfSubscriptions(ctx, c, clients)
+	}
+	cl := clients[0]
+	if c.Bool(flAll.Name) {
+		return replicationStatusAll(ctx, c, cl)
+	}
+	ns, name, version, err := checkVersionFlags(c)
+	if err != nil {
+		return err
+	}
+	output, err := outputFormat(c)
+	if err != nil {
+		return err
+	}
+	wait := c.Bool(flWait.Name)
+	interval := c.Duration(flPollInterval.Name)
+	if wait && interval <= 0 {
+		return fmt.Errorf("argument %q must be a positive duration", flPollInterval.Name)
 	}
 
 	var f func(_ ReplicationStatusResponse) error
-	if json {
+	switch {
+	case output == "json":
 		f = printAsJSON
-	} else {
+	case output == "csv":
+		f = printAsCSV
+	case c.GlobalBool("quiet"):
+		// The exit code tells whether the replication succeeded.
+		f = func(ReplicationStatusResponse) error { return nil }
+	default:
 		f = printAsTable
 	}
-	if err := f(rs); err != nil {
-		log.Fatal(err)
+
+	stallPolls := c.Int(flStallPolls.Name)
+	var trend replicationTrend
+	for {
+		log.Debug("Requesting replication status.")
+		rs, err := cl.GetReplicationStatus(ctx, ns, name, version)
+		if err != nil {
+			return wrapf(err, "Cannot fetch replication status: %v", err)
+		}
+
+		summary := summarizeReplication(rs)
+		done := summary.done()
+		if wait {
+			trend.add(summary.completed)
+			log.Info(trend)
+			if n := trend.stalled(); stallPolls > 0 && n > 0 && n%stallPolls == 0 && !done {
+				log.Warnf("Replication made no progress for %d polls, it may be stuck.", n)
+			}
+		}
+		// Only the final result is printed as JSON or CSV to keep the output
+		// parseable.
+		if output == "table" || !wait || done {
+			if err := f(rs); err != nil {
+				return err
+			}
+		}
+
+		if !wait || done {
+			if summary.failed > 0 {
+				return errorf(exitCodeOperationFailure, "Replication failed in %d of %d locations.", summary.failed, summary.total)
+			}
+			if done {
+				log.Info("Replication completed in all locations.")
+			}
+			return nil
+		}
+
+		log.Debugf("Replication in progress, checking again in %v.", interval)
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return errors.New("Interrupted while waiting for replication to complete.")
+		}
+	}
+}
+
+// waitForReplication polls the replication status of a version with the poll
+// intervals of the client until every location reaches a terminal state or
+// ctx is done, logging the progress of each poll.
+func waitForReplication(ctx context.Context, cl ExtensionsClient, ns, name, version string) error {
+	var trend replicationTrend
+	interval := cl.pollMinInterval
+	for {
+		rs, err := cl.GetReplicationStatus(ctx, ns, name, version)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		} else if err != nil {
+			return wrapf(err, "Cannot fetch replication status: %v", err)
+		}
+
+		summary := summarizeReplication(rs)
+		trend.add(summary.completed)
+		log.Infof("Replication: %d of %d locations finished, %s", summary.completed+summary.failed, summary.total, trend)
+		if summary.done() {
+			if summary.failed > 0 {
+				return errorf(exitCodeOperationFailure, "Replication failed in %d of %d locations.", summary.failed, summary.total)
+			}
+			log.Info("Replication completed in all locations.")
+			return nil
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		interval = nextPollInterval(interval, cl.pollMaxInterval)
+	}
+}
+
+// versionReplicationStatus is the replication status of a published
+// extension version.
+type versionReplicationStatus struct {
+	Namespace string
+	Name      string
+	Version   string
+	Statuses  []ReplicationStatus
+	err       error
+}
+
+// replicationStatusAll prints the replication status of every published
+// version, optionally filtered by --namespace and --name.
+func replicationStatusAll(ctx context.Context, c *cli.Context, cl ExtensionsClient) error {
+	output, err := outputFormat(c)
+	if err != nil {
+		return err
+	}
+	concurrency := c.Int(flConcurrency.Name)
+	if concurrency <= 0 {
+		return fmt.Errorf("argument %q must be a positive number", flConcurrency.Name)
+	}
+
+	v, err := cl.ListVersions(ctx)
+	if err != nil {
+		return wrapf(err, "Request failed: %v", err)
+	}
+	exts := filterVersions(v.Extensions, stringFlag(c, flNamespace.Name), stringFlag(c, flName.Name))
+	log.Debugf("Requesting replication status of %d versions.", len(exts))
+
+	results, err := fetchReplicationStatuses(ctx, cl, exts, concurrency)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, r := range results {
+		if r.err != nil {
+			return wrapf(r.err, "Cannot fetch replication status of %s.%s %s: %v", r.Namespace, r.Name, r.Version, r.err)
+		}
+		failed += summarizeReplication(ReplicationStatusResponse{Statuses: r.Statuses}).failed
+	}
+
+	switch output {
+	case "json":
+		b, err := json.MarshalIndent(results, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format as json: %+v", err)
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", string(b))
+	case "csv":
+		if err := writeCSV(os.Stdout, allReplicationStatusHeader(results), allReplicationStatusRows(results)); err != nil {
+			return err
+		}
+	default:
+		if !c.GlobalBool("quiet") {
+			printAllAsTable(results)
+		}
+	}
+
+	if failed > 0 {
+		return errorf(exitCodeOperationFailure, "Replication failed in %d locations.", failed)
+	}
+	return nil
+}
+
+// fetchReplicationStatuses fetches the replication status of the extension
+// versions using at most concurrency parallel requests. The results are
+// sorted by namespace, name and version regardless of completion order.
+func fetchReplicationStatuses(ctx context.Context, cl ExtensionsClient, exts []PublishedExtension, concurrency int) ([]versionReplicationStatus, error) {
+	results := make([]versionReplicationStatus, len(exts))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				e := exts[j]
+				rs, err := cl.GetReplicationStatus(ctx, e.Ns, e.Name, e.Version)
+				results[j] = versionReplicationStatus{Namespace: e.Ns, Name: e.Name, Version: e.Version, Statuses: rs.Statuses, err: err}
+			}
+		}()
+	}
+	for i := range exts {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	var err error
+	sort.SliceStable(results, func(i, j int) bool {
+		a, b := results[i], results[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		cmp, cerr := compareVersions(a.Version, b.Version)
+		if cerr != nil {
+			err = cerr
+		}
+		return cmp < 0
+	})
+	return results, err
+}
+
+// allReplicationStatusHeader is the header of the columns of
+// allReplicationStatusRows.
+func allReplicationStatusHeader(results []versionReplicationStatus) []string {
+	header := []string{"Extension", "Version", "Location", "Status"}
+	if anyReplicationDetails(results) {
+		header = append(header, replicationDetailsHeader...)
+	}
+	return header
+}
+
+func allReplicationStatusRows(results []versionReplicationStatus) [][]string {
+	details := anyReplicationDetails(results)
+	data := [][]string{}
+	for _, r := range results {
+		for _, s := range r.Statuses {
+			row := []string{r.Namespace + "." + r.Name, r.Version, s.Location, s.Status}
+			if details {
+				row = append(row, s.progress(), s.reason())
+			}
+			data = append(data, row)
+		}
 	}
+	return data
+}
+
+// anyReplicationDetails reports whether any location of the versions has
+// replication details.
+func anyReplicationDetails(results []versionReplicationStatus) bool {
+	for _, r := range results {
+		if hasReplicationDetails(r.Statuses) {
+			return true
+		}
+	}
+	return false
+}
+
+func printAllAsTable(results []versionReplicationStatus) {
+	data := allReplicationStatusRows(results)
+	// Only the first row of each version is labeled, grouping its locations.
+	for i := len(data) - 1; i > 0; i-- {
+		if data[i][0] == data[i-1][0] && data[i][1] == data[i-1][1] {
+			data[i][0], data[i][1] = "", ""
+		}
+	}
+
+	header := allReplicationStatusHeader(results)
+	colorStatuses(header, data)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+	table.AppendBulk(data)
+	table.Render()
+}
+
+// replicationSummary counts the locations in each replication state.
+type replicationSummary struct {
+	total, completed, failed, inProgress int
+}
+
+func summarizeReplication(r ReplicationStatusResponse) replicationSummary {
+	s := replicationSummary{total: len(r.Statuses)}
+	for _, st := range r.Statuses {
+		switch st.Status {
+		case replicationStatusCompleted:
+			s.completed++
+		case replicationStatusFailed:
+			s.failed++
+		default:
+			s.inProgress++
+		}
+	}
+	return s
+}
+
+// done reports whether every location has reached a terminal replication
+// state.
+func (s replicationSummary) done() bool {
+	return s.total > 0 && s.inProgress == 0
+}
+
+func (s replicationSummary) String() string {
+	return fmt.Sprintf("%d/%d regions completed, %d failed, %d in progress", s.completed, s.total, s.failed, s.inProgress)
+}
+
+// maxTrendPolls is the number of polls shown in a replication trend.
+const maxTrendPolls = 10
+
+// replicationTrend is the number of completed regions at each poll of the
+// replication status.
+type replicationTrend struct {
+	completed []int
+}
+
+func (t *replicationTrend) add(completed int) {
+	t.completed = append(t.completed, completed)
+}
+
+// stalled returns the number of polls since the number of completed regions
+// last changed.
+func (t replicationTrend) stalled() int {
+	n := 0
+	for i := len(t.completed) - 1; i > 0 && t.completed[i] == t.completed[i-1]; i-- {
+		n++
+	}
+	return n
+}
+
+func (t replicationTrend) String() string {
+	shown := t.completed
+	prefix := ""
+	if len(shown) > maxTrendPolls {
+		shown = shown[len(shown)-maxTrendPolls:]
+		prefix = "... → "
+	}
+	counts := make([]string, len(shown))
+	for i, n := range shown {
+		counts[i] = strconv.Itoa(n)
+	}
+	s := "completed: " + prefix + strings.Join(counts, " → ")
+	if n := t.stalled(); n > 0 {
+		s += fmt.Sprintf(" (no progress for %d polls)", n)
+	}
+	return s
 }
 
 func printAsJSON(r ReplicationStatusResponse) error {
@@ -36,18 +376,60 @@ func printAsJSON(r ReplicationStatusResponse) error {
 	if err != nil {
 		return fmt.Errorf("failed to format as json: %+v", err)
 	}
-	fmt.Fprintf(os.Stdout, "%s", string(b))
+	fmt.Fprintf(os.Stdout, "%s\n", string(b))
 	return nil
 }
 
-func printAsTable(r ReplicationStatusResponse) error {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetHeader([]string{"Location", "Status"})
+// replicationDetailsHeader is the header of the columns of the replication
+// details, which are only shown when any location has details, to keep
+// tables compact otherwise.
+var replicationDetailsHeader = []string{"Progress", "Reason"}
+
+// hasReplicationDetails reports whether any location has a progress or an
+// error.
+func hasReplicationDetails(statuses []ReplicationStatus) bool {
+	for _, s := range statuses {
+		if s.hasDetails() {
+			return true
+		}
+	}
+	return false
+}
+
+// replicationStatusHeader is the header of the columns of
+// replicationStatusRows.
+func replicationStatusHeader(r ReplicationStatusResponse) []string {
+	header := []string{"Location", "Status"}
+	if hasReplicationDetails(r.Statuses) {
+		header = append(header, replicationDetailsHeader...)
+	}
+	return header
+}
+
+func replicationStatusRows(r ReplicationStatusResponse) [][]string {
+	details := hasReplicationDetails(r.Statuses)
 	data := [][]string{}
 	for _, s := range r.Statuses {
-		data = append(data, []string{s.Location, s.Status})
+		row := []string{s.Location, s.Status}
+		if details {
+			row = append(row, s.progress(), s.reason())
+		}
+		data = append(data, row)
 	}
-	table.AppendBulk(data)
+	return data
+}
+
+func printAsTable(r ReplicationStatusResponse) error {
+	header, rows := replicationStatusHeader(r), replicationStatusRows(r)
+	colorStatuses(header, rows)
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader(header)
+	table.AppendBulk(rows)
 	table.Render()
+	fmt.Println(summarizeReplication(r))
 	return nil
 }
+
+func printAsCSV(r ReplicationStatusResponse) error {
+	return writeCSV(os.Stdout, replicationStatusHeader(r), replicationStatusRows(r))
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"path"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReplicationSummaryDone(t *testing.T) {
+	tests := []struct {
+		statuses []ReplicationStatus
+		done     bool
+	}{
+		{nil, false},
+		{[]ReplicationStatus{{Location: "West US", Status: "Completed"}, {Location: "East US", Status: "InProgress"}}, false},
+		{[]ReplicationStatus{{Location: "West US", Status: "Completed"}, {Location: "East US", Status: "Completed"}}, true},
+		{[]ReplicationStatus{{Location: "West US", Status: "Completed"}, {Location: "East US", Status: "Failed"}}, true},
+	}
+
+	for i, tt := range tests {
+		if done := summarizeReplication(ReplicationStatusResponse{Statuses: tt.statuses}).done(); done != tt.done {
+			t.Errorf("case %d: expected done=%v, but got done=%v", i, tt.done, done)
+		}
+	}
+}
+
+func TestReplicationSummary(t *testing.T) {
+	s := summarizeReplication(ReplicationStatusResponse{Statuses: []ReplicationStatus{
+		{Location: "West US", Status: "Completed"},
+		{Location: "East US", Status: "Completed"},
+		{Location: "North Europe", Status: "Failed"},
+		{Location: "Japan East", Status: "InProgress"},
+	}})
+
+	if expected := "2/4 regions completed, 1 failed, 1 in progress"; s.String() != expected {
+		t.Fatalf("Expected summary %q, but got %q", expected, s.String())
+	}
+	if s.done() {
+		t.Fatal("Replication should not be done while a location is in progress")
+	}
+}
+
+func TestFetchReplicationStatusesIsOrdered(t *testing.T) {
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		// Respond to earlier versions last, so that completion order differs
+		// from the expected output order.
+		if strings.Contains(r.URL.Path, "/1.0/") {
+			time.Sleep(20 * time.Millisecond)
+		}
+		fmt.Fprintf(w, `<ReplicationStatusList><ReplicationStatus><Location>West US</Location><Status>%s</Status></ReplicationStatus></ReplicationStatusList>`, path.Base(path.Dir(r.URL.Path)))
+	})
+	defer done()
+
+	exts := []PublishedExtension{
+		{Ns: "Microsoft.Azure.Extensions", Name: "CustomScript", Version: "10.0"},
+		{Ns: "Microsoft.Azure.Extensions", Name: "CustomScript", Version: "2.0"},
+		{Ns: "Microsoft.Azure.Extensions", Name: "CustomScript", Version: "1.0"},
+		{Ns: "Microsoft.Azure.Extensions", Name: "DockerExtension", Version: "1.0"},
+	}
+	results, err := fetchReplicationStatuses(context.Background(), cl, exts, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Versions are compared numerically, so 10.0 is after 2.0.
+	expected := []string{"CustomScript 1.0", "CustomScript 2.0", "CustomScript 10.0", "DockerExtension 1.0"}
+	if len(results) != len(expected) {
+		t.Fatalf("Expected %d results, but got %d", len(expected), len(results))
+	}
+	for i, r := range results {
+		if r.err != nil {
+			t.Fatal(r.err)
+		}
+		if got := r.Name + " " + r.Version; got != expected[i] {
+			t.Fatalf("Expected result %d to be %q, but got %q", i, expected[i], got)
+		}
+		if len(r.Statuses) != 1 || r.Statuses[0].Status != r.Version {
+			t.Fatalf("Unexpected statuses for %s: %+v", expected[i], r.Statuses)
+		}
+	}
+}
+
+func TestReplicationTrend(t *testing.T) {
+	var trend replicationTrend
+	for _, n := range []int{2, 4, 4, 4} {
+		trend.add(n)
+	}
+	if trend.stalled() != 2 {
+		t.Fatalf("Expected no progress for 2 polls, but got %d", trend.stalled())
+	}
+	if s := trend.String(); s != "completed: 2 → 4 → 4 → 4 (no progress for 2 polls)" {
+		t.Fatalf("Unexpected trend %q", s)
+	}
+
+	trend.add(5)
+	for i := 0; i < maxTrendPolls; i++ {
+		trend.add(6 + i)
+	}
+	if s := trend.String(); s != "completed: ... → 6 → 7 → 8 → 9 → 10 → 11 → 12 → 13 → 14 → 15" {
+		t.Fatalf("Unexpected trend %q", s)
+	}
+}
+
+func TestWaitForReplication(t *testing.T) {
+	polls := 0
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		polls++
+		status := "InProgress"
+		if polls == 3 {
+			status = "Completed"
+		}
+		fmt.Fprintf(w, `<ReplicationStatusList><ReplicationStatus><Location>West US</Location><Status>Completed</Status></ReplicationStatus><ReplicationStatus><Location>East US</Location><Status>%s</Status></ReplicationStatus></ReplicationStatusList>`, status)
+	})
+	defer done()
+	cl.pollMinInterval, cl.pollMaxInterval = time.Millisecond, time.Millisecond
+
+	if err := waitForReplication(context.Background(), cl, "Microsoft.Azure.Extensions", "CustomScript", "2.0.2"); err != nil {
+		t.Fatal(err)
+	}
+	if polls != 3 {
+		t.Fatalf("Expected 3 polls, but got %d", polls)
+	}
+
+	// Replication in progress is polled until ctx is done.
+	cl.pollMinInterval, cl.pollMaxInterval = time.Hour, time.Hour
+	polls = 0
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := waitForReplication(ctx, cl, "Microsoft.Azure.Extensions", "CustomScript", "2.0.2"); err != context.DeadlineExceeded {
+		t.Fatalf("Expected %v, but got %v", context.DeadlineExceeded, err)
+	}
+}
+
+func TestReplicationStatusDetails(t *testing.T) {
+	var r ReplicationStatusResponse
+	if err := xml.Unmarshal([]byte(`<ReplicationStatusList xmlns="http://schemas.microsoft.com/windowsazure">
+<ReplicationStatus><Location>West US</Location><Status>Completed</Status></ReplicationStatus>
+<ReplicationStatus><Location>East US</Location><Status>Replicating</Status><Progress>40</Progress></ReplicationStatus>
+<ReplicationStatus><Location>Japan East</Location><Status>Failed</Status><Error><Code>BlobNotFound</Code><Message>The package blob does not exist.</Message></Error></ReplicationStatus>
+</ReplicationStatusList>`), &r); err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := []string{"Location", "Status", "Progress", "Reason"}; !reflect.DeepEqual(replicationStatusHeader(r), expected) {
+		t.Fatalf("Expected header %q, but got %q", expected, replicationStatusHeader(r))
+	}
+	expected := [][]string{
+		{"West US", "Completed", "", ""},
+		{"East US", "Replicating", "40%", ""},
+		{"Japan East", "Failed", "", "BlobNotFound: The package blob does not exist."},
+	}
+	if rows := replicationStatusRows(r); !reflect.DeepEqual(rows, expected) {
+		t.Fatalf("Expected rows %q, but got %q", expected, rows)
+	}
+
+	// Detail columns are only shown when any location has details.
+	r.Statuses = r.Statuses[:1]
+	if expected := []string{"Location", "Status"}; !reflect.DeepEqual(replicationStatusHeader(r), expected) {
+		t.Fatalf("Expected header %q, but got %q", expected, replicationStatusHeader(r))
+	}
+	if rows := replicationStatusRows(r); !reflect.DeepEqual(rows, [][]string{{"West US", "Completed"}}) {
+		t.Fatalf("Expected rows without details, but got %q", rows)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+// rollback makes the previous public version of an extension the newest one,
+// by unpublishing the newest public version, which stays published
+// internally.
+func rollback(ctx context.Context, c *cli.Context) error {
+	ns, name, err := checkExtensionFlags(c)
+	if err != nil {
+		return err
+	}
+
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	l, err := cl.ListVersions(ctx)
+	if err != nil {
+		return wrapf(err, "Request failed: %v", err)
+	}
+	latest, previous, err := rollbackPlan(filterVersions(l.Extensions, ns, name))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Rollback of %s.%s:\n", ns, name)
+	fmt.Printf("  %s will be unpublished (made internal)\n", latest.Version)
+	fmt.Printf("  %s will be the newest public version\n", previous.Version)
+
+	b, err := newVisibilityManifest(latest.Ns, latest.Name, latest.Version, true, c.Bool(flIsXMLExtension.Name))
+	if err != nil {
+		return err
+	}
+	if c.GlobalBool(flDryRun.Name) {
+		printDryRun("PUT", cl.RequestURL(updateExtensionPath), b)
+		return nil
+	}
+	if !c.Bool(flConfirm.Name) {
+		return fmt.Errorf("Rolling back changes the version of %s.%s used by new VMs, pass --%s to proceed.", ns, name, flConfirm.Name)
+	}
+	if err := updateExtensionAndWait(ctx, cl, b); err != nil {
+		return err
+	}
+	log.Infof("Rolled back %s.%s to %s.", ns, name, previous.Version)
+	return nil
+}
+
+// rollbackPlan returns the newest public version of the extensions, to
+// unpublish, and the public version before it, which becomes the newest.
+func rollbackPlan(extensions []PublishedExtension) (latest, previous PublishedExtension, err error) {
+	var public []PublishedExtension
+	for _, e := range extensions {
+		if !e.IsInternal {
+			public = append(public, e)
+		}
+	}
+	if len(public) < 2 {
+		return latest, previous, fmt.Errorf("Cannot roll back, %d public version(s) found and at least 2 are needed.", len(public))
+	}
+	sort.SliceStable(public, func(i, j int) bool {
+		cmp, cerr := compareVersions(public[i].Version, public[j].Version)
+		if cerr != nil {
+			err = cerr
+		}
+		return cmp < 0
+	})
+	return public[len(public)-1], public[len(public)-2], err
+}
@@ -0,0 +1,24 @@
+package main
+
+import "testing"
+
+func TestRollbackPlan(t *testing.T) {
+	latest, previous, err := rollbackPlan([]PublishedExtension{
+		{Version: "1.9.0"},
+		{Version: "1.11.0"},
+		{Version: "1.12.0", IsInternal: true},
+		{Version: "1.10.0"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Version != "1.11.0" || previous.Version != "1.10.0" {
+		t.Fatalf("Expected to roll back 1.11.0 to 1.10.0, but got %s to %s", latest.Version, previous.Version)
+	}
+}
+
+func TestRollbackPlanNeedsTwoPublicVersions(t *testing.T) {
+	if _, _, err := rollbackPlan([]PublishedExtension{{Version: "1.0.0"}, {Version: "1.1.0", IsInternal: true}}); err == nil {
+		t.Fatal("Expected an error with a single public version")
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+func validateSchema(ctx context.Context, c *cli.Context) error {
+	schemaFile, err := checkFlag(c, flSchema.Name)
+	if err != nil {
+		return err
+	}
+	settingsFile, err := checkFlag(c, flSettings.Name)
+	if err != nil {
+		return err
+	}
+	var schema, settings interface{}
+	if err := readJSONFile(schemaFile, &schema); err != nil {
+		return err
+	}
+	if err := readJSONFile(settingsFile, &settings); err != nil {
+		return err
+	}
+
+	s, ok := schema.(map[string]interface{})
+	if !ok {
+		return fmt.Errorf("Schema %s must be a JSON object", schemaFile)
+	}
+	if err := checkJSONSchema(s, "$"); err != nil {
+		return fmt.Errorf("Schema %s cannot be checked: %v", schemaFile, err)
+	}
+	if problems := validateJSONSchema(s, settings, "$"); len(problems) > 0 {
+		return validationError(problems)
+	}
+	log.Infof("Settings %s are valid.", settingsFile)
+	return nil
+}
+
+func readJSONFile(path string, v interface{}) error {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("Error reading %s: %v", path, err)
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("Error parsing %s: %v", path, err)
+	}
+	return nil
+}
+
+// jsonSchemaKeywords are the keywords of the subset of JSON Schema used to
+// describe handler settings, which validateJSONSchema supports.
+var jsonSchemaKeywords = map[string]bool{
+	"type": true, "enum": true, "properties": true, "required": true, "additionalProperties": true, "items": true,
+	"minimum": true, "maximum": true, "minLength": true, "maxLength": true, "pattern": true,
+}
+
+// jsonSchemaAnnotations are keywords which do not affect validation.
+var jsonSchemaAnnotations = map[string]bool{
+	"$schema": true, "$id": true, "id": true, "$comment": true, "title": true, "description": true, "default": true, "examples": true,
+}
+
+// checkJSONSchema returns an error for the first keyword of the schema at path
+// which validateJSONSchema does not support, so that settings are not
+// reported valid against constraints which were not checked.
+func checkJSONSchema(schema map[string]interface{}, path string) error {
+	keywords := make([]string, 0, len(schema))
+	for k := range schema {
+		keywords = append(keywords, k)
+	}
+	sort.Strings(keywords)
+	for _, k := range keywords {
+		if !jsonSchemaKeywords[k] && !jsonSchemaAnnotations[k] {
+			return fmt.Errorf("%s: keyword %q is not supported", path, k)
+		}
+	}
+
+	if additional, ok := schema["additionalProperties"]; ok {
+		if _, ok := additional.(bool); !ok {
+			return fmt.Errorf("%s: only a boolean additionalProperties is supported", path)
+		}
+	}
+	if items, ok := schema["items"]; ok {
+		s, ok := items.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: items must be a schema object", path)
+		}
+		if err := checkJSONSchema(s, path+".items"); err != nil {
+			return err
+		}
+	}
+	if properties, ok := schema["properties"]; ok {
+		m, ok := properties.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("%s: properties must be an object", path)
+		}
+		names := make([]string, 0, len(m))
+		for name := range m {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			s, ok := m[name].(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("%s.properties.%s: must be a schema object", path, name)
+			}
+			if err := checkJSONSchema(s, path+".properties."+name); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// validateJSONSchema validates the value at path against the schema, and
+// returns the problems found prefixed with the JSON path of the offending
+// value. The schema must have been checked with checkJSONSchema.
+func validateJSONSchema(schema map[string]interface{}, value interface{}, path string) []string {
+	var problems []string
+	problem := func(format string, a ...interface{}) {
+		problems = append(problems, fmt.Sprintf("%s: %s", path, fmt.Sprintf(format, a...)))
+	}
+
+	if t, ok := schema["type"]; ok && !matchesJSONType(t, value) {
+		problem("expected type %v, but got %s", t, jsonType(value))
+		return problems
+	}
+
+	if enum, ok := schema["enum"].([]interface{}); ok {
+		found := false
+		for _, e := range enum {
+			if reflect.DeepEqual(e, value) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problem("value %v is not one of %v", value, enum)
+		}
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if required, ok := schema["required"].([]interface{}); ok {
+			for _, r := range required {
+				if name, ok := r.(string); ok {
+					if _, ok := v[name]; !ok {
+						problem("required property %q is missing", name)
+					}
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if p, ok := properties[name].(map[string]interface{}); ok {
+				problems = append(problems, validateJSONSchema(p, v[name], path+"."+name)...)
+			} else if additional, ok := schema["additionalProperties"].(bool); ok && !additional {
+				problem("property %q is not allowed", name)
+			}
+		}
+	case []interface{}:
+		if items, ok := schema["items"].(map[string]interface{}); ok {
+			for i, item := range v {
+				problems = append(problems, validateJSONSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case string:
+		n := utf8.RuneCountInString(v)
+		if min, ok := schema["minLength"].(float64); ok && float64(n) < min {
+			problem("length %d is less than minLength %v", n, min)
+		}
+		if max, ok := schema["maxLength"].(float64); ok && float64(n) > max {
+			problem("length %d is greater than maxLength %v", n, max)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re, err := regexp.Compile(pattern); err != nil {
+				problem("schema pattern %q is invalid: %v", pattern, err)
+			} else if !re.MatchString(v) {
+				problem("value %q does not match pattern %q", v, pattern)
+			}
+		}
+	case float64:
+		if min, ok := schema["minimum"].(float64); ok && v < min {
+			problem("value %v is less than minimum %v", v, min)
+		}
+		if max, ok := schema["maximum"].(float64); ok && v > max {
+			problem("value %v is greater than maximum %v", v, max)
+		}
+	}
+	return problems
+}
+
+// matchesJSONType reports whether the value has the type, or one of the
+// types, of a schema "type" keyword.
+func matchesJSONType(t interface{}, value interface{}) bool {
+	switch t := t.(type) {
+	case string:
+		if t == "integer" {
+			f, ok := value.(float64)
+			return ok && f == math.Trunc(f)
+		}
+		return t == jsonType(value) || (t == "number" && jsonType(value) == "integer")
+	case []interface{}:
+		for _, tt := range t {
+			if matchesJSONType(tt, value) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonType returns the JSON Schema type name of a decoded JSON value.
+func jsonType(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return strings.ToLower(reflect.TypeOf(value).String())
+}
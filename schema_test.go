@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+const testSchema = `{
+  "type": "object",
+  "required": ["commandToExecute"],
+  "additionalProperties": false,
+  "properties": {
+    "commandToExecute": {"type": "string", "minLength": 1},
+    "fileUris": {"type": "array", "items": {"type": "string", "pattern": "^https://"}},
+    "timestamp": {"type": "integer", "minimum": 0},
+    "skipDos2Unix": {"type": "boolean"}
+  }
+}`
+
+func validateTestSettings(t *testing.T, settings string) []string {
+	var schema map[string]interface{}
+	var v interface{}
+	if err := json.Unmarshal([]byte(testSchema), &schema); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal([]byte(settings), &v); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkJSONSchema(schema, "$"); err != nil {
+		t.Fatal(err)
+	}
+	return validateJSONSchema(schema, v, "$")
+}
+
+func TestValidateJSONSchema(t *testing.T) {
+	if problems := validateTestSettings(t, `{"commandToExecute": "ls", "fileUris": ["https://a/b.sh"], "timestamp": 1}`); len(problems) != 0 {
+		t.Fatalf("Expected no problems, but got %q", problems)
+	}
+}
+
+func TestValidateJSONSchemaReportsPaths(t *testing.T) {
+	problems := validateTestSettings(t, `{"fileUris": ["https://a/b.sh", "http://a/c.sh"], "timestamp": 1.5, "skipDos2unix": true}`)
+	expected := []string{
+		`$: required property "commandToExecute" is missing`,
+		`$.fileUris[1]: value "http://a/c.sh" does not match pattern "^https://"`,
+		`$: property "skipDos2unix" is not allowed`,
+		`$.timestamp: expected type integer, but got number`,
+	}
+	if !reflect.DeepEqual(problems, expected) {
+		t.Fatalf("Expected %q, but got %q", expected, problems)
+	}
+}
+
+func TestCheckJSONSchemaRejectsUnsupportedKeywords(t *testing.T) {
+	for _, tc := range []struct {
+		schema, err string
+	}{
+		{`{"oneOf": [{"type": "string"}]}`, `$: keyword "oneOf" is not supported`},
+		{`{"properties": {"a": {"$ref": "#/definitions/a"}}}`, `$.properties.a: keyword "$ref" is not supported`},
+		{`{"items": {"type": "string", "format": "uri"}}`, `$.items: keyword "format" is not supported`},
+		{`{"additionalProperties": {"type": "string"}}`, `$: only a boolean additionalProperties is supported`},
+		{`{"items": [{"type": "string"}]}`, `$: items must be a schema object`},
+	} {
+		var schema map[string]interface{}
+		if err := json.Unmarshal([]byte(tc.schema), &schema); err != nil {
+			t.Fatal(err)
+		}
+		if err := checkJSONSchema(schema, "$"); err == nil || err.Error() != tc.err {
+			t.Errorf("%s: expected error %q, but got: %v", tc.schema, tc.err, err)
+		}
+	}
+	var schema map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"$schema": "http://json-schema.org/draft-04/schema#", "title": "settings"}`), &schema); err != nil {
+		t.Fatal(err)
+	}
+	if err := checkJSONSchema(schema, "$"); err != nil {
+		t.Fatalf("Expected annotations to be ignored, but got: %v", err)
+	}
+}
+
+func TestValidateJSONSchemaCountsCharacters(t *testing.T) {
+	schema := map[string]interface{}{"type": "string", "maxLength": float64(3)}
+	if problems := validateJSONSchema(schema, "été", "$"); len(problems) != 0 {
+		t.Fatalf("Expected no problems, but got %q", problems)
+	}
+	if problems := validateJSONSchema(schema, "étés", "$"); len(problems) != 1 {
+		t.Fatalf("Expected a maxLength problem, but got %q", problems)
+	}
+}
@@ -1,78 +1,604 @@
 package main
 
 import (
+	"context"
 	"encoding/xml"
+	"errors"
 	"fmt"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/management"
+	"github.com/Azure/go-autorest/autorest/adal"
+	"github.com/Azure/go-autorest/autorest/azure"
 	log "github.com/Sirupsen/logrus"
 )
 
 const (
-	operationStatusPollingInterval = time.Second * 10
-	apiVersion                     = "2015-04-01"
+	// defaultPollMinInterval and defaultPollMaxInterval bound the interval
+	// between operation status checks, which doubles after each check.
+	defaultPollMinInterval = time.Second * 5
+	defaultPollMaxInterval = time.Second * 30
+
+	// apiVersion is the default version of the Service Management API,
+	// sent in the x-ms-version header of every request.
+	apiVersion = "2015-04-01"
 )
 
+// ErrExtensionNotFound is returned when the requested extension version is
+// not published from the publisher subscription.
+var ErrExtensionNotFound = errors.New("extension version not found")
+
+// APIError is an error response of the Azure Service Management API.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+
+	// Code and Message describe the error, e.g. "ConflictError". Code is
+	// empty if the response had no ASM error body.
+	Code    string
+	Message string
+
+	// RequestID is the x-ms-request-id of the failed request, which Azure
+	// support needs to investigate it.
+	RequestID string
+
+	// Hint suggests how to fix common causes of the error, if known.
+	Hint string
+}
+
+func (e APIError) Error() string {
+	msg := e.Message
+	if e.Code != "" {
+		msg = fmt.Sprintf("%s: %s", e.Code, e.Message)
+	}
+	if e.RequestID != "" {
+		msg = fmt.Sprintf("%s (x-ms-request-id=%s)", msg, e.RequestID)
+	}
+	if e.Hint != "" {
+		msg = fmt.Sprintf("%s. %s", strings.TrimSuffix(msg, "."), e.Hint)
+	}
+	return msg
+}
+
 // ExtensionsClient builds a new Azure Service Management Client with Extension
 // Publishing operations.
 type ExtensionsClient struct {
-	client management.Client
+	client           asmClient
+	operationTimeout time.Duration
+	pollMinInterval  time.Duration
+	pollMaxInterval  time.Duration
+	showProgress     bool
+	cache            *clientCache
+
+	// detach makes commands print the ID of the operations they start
+	// instead of waiting for them (--wait=false).
+	detach bool
+
+	allowedNamespaces []string
+}
+
+// clientCache holds responses which do not change for the duration of the
+// process.
+type clientCache struct {
+	mu        sync.Mutex
+	locations *ListLocationsResponse
+}
+
+// ClientConfig configures how an ExtensionsClient connects to the Azure Service
+// Management API.
+type ClientConfig struct {
+	// ManagementURL is the base URL of the Azure Service Management API.
+	ManagementURL string
+
+	// ActiveDirectoryURL is the Azure AD endpoint issuing tokens for service
+	// principals. If empty, the endpoint of the public Azure cloud is used.
+	ActiveDirectoryURL string
+
+	// ProxyURL is the proxy requests are sent through. If nil, the proxy is
+	// taken from the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment
+	// variables.
+	ProxyURL *url.URL
+
+	// OperationTimeout bounds how long WaitForOperation polls. Zero polls
+	// indefinitely.
+	OperationTimeout time.Duration
+
+	// HTTPTimeout bounds each HTTP request, including reading its response,
+	// so that a hung request fails instead of blocking the command. Retried
+	// requests, e.g. polls of an operation, get a timeout of their own. Zero
+	// does not time out requests.
+	HTTPTimeout time.Duration
+
+	// PollMinInterval and PollMaxInterval bound the interval between
+	// operation status checks of WaitForOperation, which starts at the
+	// minimum and doubles up to the maximum. Zero uses 5s and 30s.
+	PollMinInterval time.Duration
+	PollMaxInterval time.Duration
+
+	// Trace writes every request and response to stderr, with credentials
+	// redacted.
+	Trace bool
+
+	// ShowProgress draws a spinner on stderr while WaitForOperation polls.
+	ShowProgress bool
+
+	// InsecureSkipVerify disables the verification of the TLS certificate of
+	// the management endpoint. Only for debugging against test endpoints.
+	InsecureSkipVerify bool
+
+	// CertExpiryWindow is how long before the management certificate
+	// expires a warning is logged.
+	CertExpiryWindow time.Duration
+
+	// StrictCertExpiry makes an expired or expiring management certificate
+	// an error instead of a warning.
+	StrictCertExpiry bool
+
+	// APIVersion is the version of the Service Management API requested in
+	// the x-ms-version header. If empty, apiVersion is used.
+	APIVersion string
+
+	// UserAgentSuffix is appended to the User-Agent of requests, e.g. to
+	// identify the pipeline using the CLI.
+	UserAgentSuffix string
+
+	// RecordFixtures is the directory the responses from Azure are saved to
+	// as test fixtures. If empty, responses are not recorded.
+	RecordFixtures string
+
+	// AllowedNamespaces are the prefixes of the namespaces manifests can be
+	// published or updated under, ignoring case. If empty, any namespace is
+	// allowed.
+	AllowedNamespaces []string
 }
 
 // NewClient constructs an ExtensionsClient.
-func NewClient(mgtURL string, subscriptionID string, cert []byte) (ExtensionsClient, error) {
+func NewClient(subscriptionID string, cert []byte, config ClientConfig) (ExtensionsClient, error) {
+	cfg := management.DefaultConfig()
+	cfg.APIVersion = apiVersion
+	cfg.ManagementURL = config.ManagementURL
+	cl, err := newASMClient(subscriptionID, cert, cfg, config.ProxyURL)
+	if err != nil {
+		return ExtensionsClient{}, err
+	}
+	if msg := certExpiry(cl.certThumbprint, cl.certNotAfter, time.Now(), config.CertExpiryWindow); msg != "" {
+		if config.StrictCertExpiry {
+			return ExtensionsClient{}, errorf(exitCodeAuthFailure, "%s", msg)
+		}
+		log.Warn(msg)
+	}
+	return newExtensionsClient(cl, config), nil
+}
+
+// userAgent returns the User-Agent identifying the CLI in requests, with the
+// suffix appended if not empty.
+func userAgent(suffix string) string {
+	ua := "azure-extensions-cli/" + buildInfo(GitSummary)
+	if suffix != "" {
+		ua += " " + suffix
+	}
+	return ua
+}
+
+// newExtensionsClient returns an ExtensionsClient sending requests with cl,
+// configured with the client-side settings of config.
+func newExtensionsClient(cl asmClient, config ClientConfig) ExtensionsClient {
+	cl.config.UserAgent = userAgent(config.UserAgentSuffix)
+	if config.APIVersion != "" {
+		cl.config.APIVersion = config.APIVersion
+	}
+	if config.InsecureSkipVerify {
+		log.Warn("INSECURE: TLS certificates of Azure endpoints are not verified (AZURE_EXTENSIONS_CLI_INSECURE_SKIP_VERIFY). Never use this outside of test environments.")
+		if tr := httpTransport(cl.httpClient); tr != nil {
+			tr.TLSClientConfig.InsecureSkipVerify = true
+		}
+	}
+	cl.httpClient.Timeout = config.HTTPTimeout
+	if config.RecordFixtures != "" {
+		cl.httpClient.Transport = newRecordingTransport(cl.httpClient.Transport, config.RecordFixtures)
+	}
+	if config.Trace {
+		cl.httpClient.Transport = tracingTransport{cl.httpClient.Transport, stderr}
+	}
+	ec := ExtensionsClient{
+		client:            cl,
+		operationTimeout:  config.OperationTimeout,
+		pollMinInterval:   config.PollMinInterval,
+		pollMaxInterval:   config.PollMaxInterval,
+		showProgress:      config.ShowProgress,
+		cache:             &clientCache{},
+		allowedNamespaces: config.AllowedNamespaces,
+	}
+	if ec.pollMinInterval <= 0 {
+		ec.pollMinInterval = defaultPollMinInterval
+	}
+	if ec.pollMaxInterval <= 0 {
+		ec.pollMaxInterval = defaultPollMaxInterval
+	}
+	if ec.pollMaxInterval < ec.pollMinInterval {
+		ec.pollMaxInterval = ec.pollMinInterval
+	}
+	return ec
+}
+
+// NewClientFromCerts constructs an ExtensionsClient authenticating with the
+// first of the management certificates accepted by Azure, trying them in
+// order. This allows rolling over certificates while both the old and new
+// certificates are valid. A single certificate is used without checking it.
+// The certificates are checked with requests bounded by ctx.
+func NewClientFromCerts(ctx context.Context, subscriptionID string, certs [][]byte, config ClientConfig) (ExtensionsClient, error) {
+	if len(certs) == 1 {
+		return NewClient(subscriptionID, certs[0], config)
+	}
+
+	err := errors.New("no certificates given")
+	for i, cert := range certs {
+		var cl ExtensionsClient
+		cl, err = NewClient(subscriptionID, cert, config)
+		if err != nil {
+			log.Debugf("Cannot use management certificate %d: %v", i+1, err)
+			continue
+		}
+		if _, err = cl.ListLocations(ctx); isAuthError(err) {
+			log.Debugf("Management certificate %d was rejected: %v", i+1, err)
+			continue
+		} else if err != nil {
+			return cl, err
+		}
+		log.Debugf("Using management certificate %d.", i+1)
+		return cl, nil
+	}
+	return ExtensionsClient{}, err
+}
+
+// NewClientFromServicePrincipal constructs an ExtensionsClient authenticating
+// as an Azure AD service principal instead of with a management certificate.
+// Requests still go to the classic Service Management API, which has the only
+// API to publish extensions, so the token is issued for the management URL
+// and not for Azure Resource Manager.
+func NewClientFromServicePrincipal(tenantID, clientID, clientSecret, subscriptionID string, config ClientConfig) (ExtensionsClient, error) {
+	adURL := config.ActiveDirectoryURL
+	if adURL == "" {
+		adURL = azure.PublicCloud.ActiveDirectoryEndpoint
+	}
+	oauthConfig, err := adal.NewOAuthConfig(adURL, tenantID)
+	if err != nil {
+		return ExtensionsClient{}, err
+	}
+	// Tokens for the Service Management API are issued for its base URL.
+	resource := strings.TrimSuffix(config.ManagementURL, "/") + "/"
+	token, err := adal.NewServicePrincipalToken(*oauthConfig, clientID, clientSecret, resource)
+	if err != nil {
+		return ExtensionsClient{}, err
+	}
+
 	cfg := management.DefaultConfig()
 	cfg.APIVersion = apiVersion
-	cfg.ManagementURL = mgtURL
-	cl, err := management.NewClientFromConfig(subscriptionID, cert, cfg)
-	return ExtensionsClient{cl}, err
+	cfg.ManagementURL = config.ManagementURL
+	cl, err := newASMClientWithToken(subscriptionID, token, cfg, config.ProxyURL)
+	if err != nil {
+		return ExtensionsClient{}, err
+	}
+	return newExtensionsClient(cl, config), nil
+}
+
+// NewClientFromPublishSettings constructs an ExtensionsClient from the
+// subscription ID, management certificate and management URL stored in a
+// .publishsettings file. If subscriptionID is empty, the first subscription in
+// the file is used.
+func NewClientFromPublishSettings(publishSettingsFile string, subscriptionID string, config ClientConfig) (ExtensionsClient, error) {
+	ps, err := readPublishSettings(publishSettingsFile, subscriptionID)
+	if err != nil {
+		return ExtensionsClient{}, err
+	}
+	config.ManagementURL = ps.ManagementURL
+	return NewClient(ps.SubscriptionID, ps.Cert, config)
 }
 
 // ListVersionsResponse is response returned from Publisher Extensions endpoint.
 type ListVersionsResponse struct {
-	XMLName    xml.Name `xml:"ExtensionImages"`
-	Extensions []struct {
-		Ns                   string `xml:"ProviderNameSpace"`
-		Name                 string `xml:"Type"`
-		Version              string `xml:"Version"`
-		ReplicationCompleted bool   `xml:"ReplicationCompleted"`
-		Regions              string `xml:"Regions"`
-		IsInternal           bool   `xml:"IsInternalExtension"`
-	} `xml:"ExtensionImage"`
+	XMLName    xml.Name             `xml:"ExtensionImages"`
+	Extensions []PublishedExtension `xml:"ExtensionImage"`
+}
+
+// PublishedExtension is an extension version published from the publisher
+// subscription.
+type PublishedExtension struct {
+	Ns                   string `xml:"ProviderNameSpace"`
+	Name                 string `xml:"Type"`
+	Version              string `xml:"Version"`
+	Label                string `xml:"Label"`
+	Description          string `xml:"Description"`
+	MediaLink            string `xml:"MediaLink"`
+	ReplicationCompleted bool   `xml:"ReplicationCompleted"`
+	Regions              string `xml:"Regions"`
+	IsInternal           bool   `xml:"IsInternalExtension"`
+
+	// PublishedDate is when the version was published. Older versions may
+	// not have it.
+	PublishedDate string `xml:"PublishedDate"`
 }
 
 // ListVersions returns all the published extensions and their versions from the
 // publisher subscription.
-func (c ExtensionsClient) ListVersions() (ListVersionsResponse, error) {
+func (c ExtensionsClient) ListVersions(ctx context.Context) (ListVersionsResponse, error) {
 	var l ListVersionsResponse
+	err := c.getAllPages(ctx, listVersionsPath, func(page []byte) error {
+		var p ListVersionsResponse
+		if err := xml.Unmarshal(page, &p); err != nil {
+			return err
+		}
+		l.Extensions = append(l.Extensions, p.Extensions...)
+		return nil
+	})
+	return l, err
+}
+
+const listVersionsPath = "services/publisherextensions"
+
+// getAllPages gets the resource at path and calls f with each page of the
+// response, following the continuation token of each page to the next one.
+func (c ExtensionsClient) getAllPages(ctx context.Context, path string, f func(page []byte) error) error {
+	p := path
+	for {
+		response, err := c.client.SendAzureGetRequest(ctx, p)
+		if err != nil {
+			return err
+		}
+		if err := f(response); err != nil {
+			return err
+		}
+
+		var t struct {
+			ContinuationToken string `xml:"ContinuationToken"`
+		}
+		if err := xml.Unmarshal(response, &t); err != nil {
+			return err
+		}
+		if t.ContinuationToken == "" {
+			return nil
+		}
+		log.Debugf("Requesting the next page of %s.", path)
+		sep := "?"
+		if strings.Contains(path, "?") {
+			sep = "&"
+		}
+		p = fmt.Sprintf("%s%sContinuationToken=%s", path, sep, url.QueryEscape(t.ContinuationToken))
+	}
+}
+
+// SubscriptionOperation is an operation of the activity log of a
+// subscription.
+type SubscriptionOperation struct {
+	ID       string `xml:"OperationId"`
+	ObjectID string `xml:"OperationObjectId"`
+	Name     string `xml:"OperationName"`
+	Status   struct {
+		Status         string `xml:"Status"`
+		HTTPStatusCode string `xml:"HttpStatusCode"`
+	} `xml:"OperationStatus"`
+	StartedTime   string `xml:"OperationStartedTime"`
+	CompletedTime string `xml:"OperationCompletedTime"`
+}
+
+// ListOperationsResponse is the response of the List Subscription Operations
+// API.
+type ListOperationsResponse struct {
+	XMLName    xml.Name                `xml:"SubscriptionOperationCollection"`
+	Operations []SubscriptionOperation `xml:"SubscriptionOperations>SubscriptionOperation"`
+}
 
-	response, err := c.client.SendAzureGetRequest("services/publisherextensions")
+// ListOperations returns the operations of the subscription started between
+// start and end, of all types, not only the ones on extensions.
+func (c ExtensionsClient) ListOperations(ctx context.Context, start, end time.Time) (ListOperationsResponse, error) {
+	var l ListOperationsResponse
+	path := fmt.Sprintf("operations?StartTime=%s&EndTime=%s", url.QueryEscape(start.UTC().Format(time.RFC3339)), url.QueryEscape(end.UTC().Format(time.RFC3339)))
+	err := c.getAllPages(ctx, path, func(page []byte) error {
+		var p ListOperationsResponse
+		if err := xml.Unmarshal(page, &p); err != nil {
+			return err
+		}
+		l.Operations = append(l.Operations, p.Operations...)
+		return nil
+	})
+	return l, err
+}
+
+// GetExtension returns the published extension with the specified namespace,
+// name and version. If there is no such version, ErrExtensionNotFound is
+// returned.
+func (c ExtensionsClient) GetExtension(ctx context.Context, namespace, name, version string) (PublishedExtension, error) {
+	l, err := c.ListVersions(ctx)
+	if err != nil {
+		return PublishedExtension{}, err
+	}
+
+	for _, e := range l.Extensions {
+		if e.Ns == namespace && e.Name == name && e.Version == version {
+			return e, nil
+		}
+	}
+	return PublishedExtension{}, ErrExtensionNotFound
+}
+
+// GetExtensionManifest returns the manifest of the published extension with
+// the specified namespace, name and version, as an ExtensionImage XML
+// document. If there is no such version, ErrExtensionNotFound is returned.
+func (c ExtensionsClient) GetExtensionManifest(ctx context.Context, namespace, name, version string) ([]byte, error) {
+	var manifest []byte
+	err := c.getAllPages(ctx, listVersionsPath, func(page []byte) error {
+		var l struct {
+			Extensions []struct {
+				Ns       string `xml:"ProviderNameSpace"`
+				Name     string `xml:"Type"`
+				Version  string `xml:"Version"`
+				InnerXML []byte `xml:",innerxml"`
+			} `xml:"ExtensionImage"`
+		}
+		if err := xml.Unmarshal(page, &l); err != nil {
+			return err
+		}
+		for _, e := range l.Extensions {
+			if e.Ns == namespace && e.Name == name && e.Version == version {
+				manifest = []byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">` + string(e.InnerXML) + `</ExtensionImage>`)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if manifest == nil {
+		return nil, ErrExtensionNotFound
+	}
+	return manifest, nil
+}
+
+// ReplicateExtension adds the regions to the regions the published extension
+// version is replicated to, keeping the regions it is already replicated to.
+// The regions must be Service Management location names. A version which is
+// already replicated to all regions is left unchanged, and an error returned,
+// since listing regions would take it out of every other region.
+func (c ExtensionsClient) ReplicateExtension(ctx context.Context, namespace, name, version string, regions []string) (management.OperationID, error) {
+	published, err := c.GetExtensionManifest(ctx, namespace, name, version)
+	if err != nil {
+		return "", err
+	}
+	var manifest extensionImage
+	if err := xml.Unmarshal(published, &manifest); err != nil {
+		return "", fmt.Errorf("Error parsing published manifest: %v", err)
+	}
+	// An empty <Regions/> element means all regions, unlike a missing one,
+	// which both unmarshal to "" in extensionImage.
+	var element struct {
+		Regions *string `xml:"Regions"`
+	}
+	if err := xml.Unmarshal(published, &element); err != nil {
+		return "", fmt.Errorf("Error parsing published manifest: %v", err)
+	}
+	if element.Regions != nil && strings.TrimSpace(*element.Regions) == "" {
+		return "", fmt.Errorf("%s.%s %s is already replicated to all regions", namespace, name, version)
+	}
+	manifest.NS = "http://schemas.microsoft.com/windowsazure"
+
+	all := []string{}
+	if manifest.Regions != "" {
+		all = strings.Split(manifest.Regions, ";")
+	}
+	for _, r := range regions {
+		found := false
+		for _, a := range all {
+			found = found || strings.EqualFold(a, r)
+		}
+		if !found {
+			all = append(all, r)
+		}
+	}
+	manifest.Regions = strings.Join(all, ";")
+
+	b, err := xml.Marshal(manifest)
+	if err != nil {
+		return "", err
+	}
+	return c.UpdateExtension(ctx, b)
+}
+
+// ListLocationsResponse is the response contents of the List Locations
+// endpoint.
+type ListLocationsResponse struct {
+	XMLName   xml.Name   `xml:"Locations"`
+	Locations []Location `xml:"Location"`
+}
+
+// Location is an Azure region available to the subscription.
+type Location struct {
+	Name        string `xml:"Name"`
+	DisplayName string `xml:"DisplayName"`
+}
+
+// ListLocations returns the locations available to the subscription. The
+// result is cached for the lifetime of the client.
+func (c ExtensionsClient) ListLocations(ctx context.Context) (ListLocationsResponse, error) {
+	c.cache.mu.Lock()
+	defer c.cache.mu.Unlock()
+	if c.cache.locations != nil {
+		return *c.cache.locations, nil
+	}
+
+	var l ListLocationsResponse
+	response, err := c.client.SendAzureGetRequest(ctx, "locations")
 	if err != nil {
 		return l, err
 	}
 
-	err = xml.Unmarshal(response, &l)
-	return l, err
+	if err := xml.Unmarshal(response, &l); err != nil {
+		return l, err
+	}
+	c.cache.locations = &l
+	return l, nil
 }
 
 // ReplicationStatusResponse is the response contents of the Get Replication
 // Status endpoint.
 type ReplicationStatusResponse struct {
-	XMLName  xml.Name `xml:"ReplicationStatusList"`
-	Statuses []struct {
-		Location string `xml:"Location"`
-		Status   string `xml:"Status"`
-	} `xml:"ReplicationStatus"`
+	XMLName  xml.Name            `xml:"ReplicationStatusList"`
+	Statuses []ReplicationStatus `xml:"ReplicationStatus"`
+}
+
+// ReplicationStatus is the replication status of an extension in a location.
+type ReplicationStatus struct {
+	Location string `xml:"Location"`
+	Status   string `xml:"Status"`
+
+	// Progress, in percent, and Error are only returned for some locations,
+	// e.g. while replicating and once replication failed.
+	Progress string            `xml:"Progress,omitempty" json:",omitempty"`
+	Error    *ReplicationError `xml:"Error,omitempty" json:",omitempty"`
+}
+
+// ReplicationError is the reason replication failed in a location.
+type ReplicationError struct {
+	Code    string `xml:"Code"`
+	Message string `xml:"Message"`
+}
+
+// hasDetails reports whether the status has a progress or an error.
+func (s ReplicationStatus) hasDetails() bool {
+	return s.Progress != "" || s.Error != nil
+}
+
+// progress returns the progress of the replication as a percentage, if any.
+func (s ReplicationStatus) progress() string {
+	if s.Progress == "" || strings.HasSuffix(s.Progress, "%") {
+		return s.Progress
+	}
+	return s.Progress + "%"
+}
+
+// reason returns why the replication failed, if known.
+func (s ReplicationStatus) reason() string {
+	if s.Error == nil {
+		return ""
+	}
+	if s.Error.Code == "" {
+		return s.Error.Message
+	}
+	if s.Error.Message == "" {
+		return s.Error.Code
+	}
+	return s.Error.Code + ": " + s.Error.Message
 }
 
 // GetReplicationStatus retrieves the replication status of the specified
 // extension handler.
-func (c ExtensionsClient) GetReplicationStatus(publisherNamespace, extension,
+func (c ExtensionsClient) GetReplicationStatus(ctx context.Context, publisherNamespace, extension,
 	version string) (ReplicationStatusResponse, error) {
 	var l ReplicationStatusResponse
 
-	response, err := c.client.SendAzureGetRequest(fmt.Sprintf("services/extensions/%s/%s/%s/replicationstatus",
+	response, err := c.client.SendAzureGetRequest(ctx, fmt.Sprintf("services/extensions/%s/%s/%s/replicationstatus",
 		publisherNamespace, extension, version))
 	if err != nil {
 		return l, err
@@ -82,54 +608,160 @@ func (c ExtensionsClient) GetReplicationStatus(publisherNamespace, extension,
 	return l, err
 }
 
+const (
+	createExtensionPath = "services/extensions"
+	updateExtensionPath = "services/extensions?action=update"
+)
+
+func deleteExtensionPath(namespace, name, version string) string {
+	return fmt.Sprintf("services/extensions/%s/%s/%s", namespace, name, version)
+}
+
 // CreateExtension sends the given extension handler definition XML to create a
 // brand new extension (not a version). Returned operation ID should be polled for result.
-func (c ExtensionsClient) CreateExtension(data []byte) (management.OperationID, error) {
-	return c.client.SendAzurePostRequest("services/extensions", data)
+func (c ExtensionsClient) CreateExtension(ctx context.Context, data []byte) (management.OperationID, error) {
+	if err := c.checkNamespace(data); err != nil {
+		return "", err
+	}
+	return c.client.SendAzurePostRequest(ctx, createExtensionPath, data)
 }
 
 // UpdateExtension sends the given extension handler definition XML to issue and update
 // request. Returned operation ID should be polled for result.
-func (c ExtensionsClient) UpdateExtension(data []byte) (management.OperationID, error) {
-	return c.client.SendAzurePutRequest("services/extensions?action=update", "text/xml", data)
+func (c ExtensionsClient) UpdateExtension(ctx context.Context, data []byte) (management.OperationID, error) {
+	if err := c.checkNamespace(data); err != nil {
+		return "", err
+	}
+	return c.client.SendAzurePutRequest(ctx, updateExtensionPath, "text/xml", data)
+}
+
+// checkNamespace returns an error if the namespace of the manifest does not
+// start with one of the allowed namespace prefixes of the client.
+func (c ExtensionsClient) checkNamespace(manifest []byte) error {
+	if len(c.allowedNamespaces) == 0 {
+		return nil
+	}
+	var m struct {
+		Namespace string `xml:"ProviderNameSpace"`
+	}
+	if err := xml.Unmarshal(manifest, &m); err != nil {
+		return fmt.Errorf("Error parsing manifest: %v", err)
+	}
+	for _, prefix := range c.allowedNamespaces {
+		if strings.HasPrefix(strings.ToLower(m.Namespace), strings.ToLower(prefix)) {
+			return nil
+		}
+	}
+	return fmt.Errorf("Namespace %q is not allowed, it must start with one of: %s", m.Namespace, strings.Join(c.allowedNamespaces, ", "))
 }
 
 // DeleteExtension deletes the extension version. It should be marked as internal first.
 // Returned operation ID should be polled for result.
-func (c ExtensionsClient) DeleteExtension(namespace, name, version string) (management.OperationID, error) {
-	return c.client.SendAzureDeleteRequest(fmt.Sprintf("services/extensions/%s/%s/%s", namespace, name, version))
+func (c ExtensionsClient) DeleteExtension(ctx context.Context, namespace, name, version string) (management.OperationID, error) {
+	return c.client.SendAzureDeleteRequest(ctx, deleteExtensionPath(namespace, name, version))
+}
+
+// SubscriptionID returns the ID of the subscription of the client.
+func (c ExtensionsClient) SubscriptionID() string {
+	return c.client.subscriptionID
+}
+
+// ManagementURL returns the base URL of the Service Management API the client
+// sends requests to.
+func (c ExtensionsClient) ManagementURL() string {
+	return c.client.config.ManagementURL
+}
+
+// RequestURL returns the absolute URL of a request to the given path of the
+// subscription.
+func (c ExtensionsClient) RequestURL(path string) string {
+	return c.client.requestURL(path)
 }
 
-// WaitForOperation polls indefinitely until the specified Azure Service
-// Management REST API operation ID reaches a terminal state. If operation
-// fails, it wraps the error and returns it.
-func (c ExtensionsClient) WaitForOperation(opID management.OperationID) error {
+// GetOperationStatus returns the status of an Azure Service Management REST
+// API operation.
+func (c ExtensionsClient) GetOperationStatus(ctx context.Context, opID management.OperationID) (management.GetOperationStatusResponse, error) {
+	return c.client.GetOperationStatus(ctx, opID)
+}
+
+// WaitForOperation polls until the specified Azure Service Management REST
+// API operation ID reaches a terminal state, ctx is done, or the operation
+// timeout of the client elapses. A zero timeout polls indefinitely. If operation fails, it
+// wraps the error and returns it.
+func (c ExtensionsClient) WaitForOperation(ctx context.Context, opID management.OperationID) error {
 	lg := log.WithField("x-ms-operation-id", opID)
 	lg.Debug("Waiting for operation to complete.")
-	for {
-		op, err := c.client.GetOperationStatus(opID)
-		if err != nil {
-			log.Errorf("Error fetching operation status: %v", err)
-			continue // don't return because of GetOperationStatus flakiness.
+	if c.showProgress {
+		stop := startSpinner(stderr, "Waiting for operation to complete")
+		defer stop()
+	}
+	// The timeout also bounds the status checks, so that waiting does not
+	// overrun it.
+	pollCtx := ctx
+	if c.operationTimeout > 0 {
+		var cancel context.CancelFunc
+		pollCtx, cancel = context.WithTimeout(ctx, c.operationTimeout)
+		defer cancel()
+	}
+	stopped := func() error {
+		if ctx.Err() != nil {
+			return ctx.Err()
 		}
+		return fmt.Errorf("Timed out after %v waiting for Azure Operation (x-ms-request-id=%s) to complete", c.operationTimeout, opID)
+	}
 
-		switch op.Status {
-		case management.OperationStatusSucceeded:
-			lg.Debug("Operation successful.")
-			return nil
-		case management.OperationStatusFailed:
-			lg.Debug("Operation failed.")
-			if op.Error != nil {
-				return op.Error
+	interval := c.pollMinInterval
+	for polls := 0; ; {
+		op, err := c.client.GetOperationStatus(pollCtx, opID)
+		if pollCtx.Err() != nil {
+			return stopped()
+		} else if code := exitCode(err); code == exitCodeAuthFailure || code == exitCodeNotFound {
+			// Retrying cannot help, e.g. the operation ID is wrong.
+			return err
+		} else if err != nil {
+			// Don't return because of GetOperationStatus flakiness.
+			lg.Errorf("Error fetching operation status: %v", err)
+		} else if done, err := operationResult(opID, op); done {
+			if polls == 0 {
+				lg.Debugf("Operation had already finished: %s.", op.Status)
 			}
-			return fmt.Errorf("Azure Operation (x-ms-request-id=%s) has failed", opID)
-		case management.OperationStatusInProgress:
-			lg.Debug("Operation in progress...")
-			time.Sleep(operationStatusPollingInterval)
-			continue
-		default:
-			lg.Errorf("Encoutered unhandled operation status: %v", op.Status)
-			return fmt.Errorf("Unhandled operation status returned from API: %s", op.Status)
+			return err
+		} else {
+			lg.Debugf("Operation in progress, checking again in %v...", interval)
+		}
+		polls++
+
+		select {
+		case <-time.After(interval):
+		case <-pollCtx.Done():
+			return stopped()
+		}
+		interval = nextPollInterval(interval, c.pollMaxInterval)
+	}
+}
+
+// operationResult reports whether the operation has finished and, if it
+// failed, its error. An operation may have finished before it is first polled,
+// e.g. when waiting for it is resumed.
+func operationResult(opID management.OperationID, op management.GetOperationStatusResponse) (done bool, err error) {
+	switch op.Status {
+	case management.OperationStatusSucceeded:
+		return true, nil
+	case management.OperationStatusFailed:
+		if op.Error != nil {
+			return true, op.Error
 		}
+		return true, fmt.Errorf("Azure Operation (x-ms-request-id=%s) has failed", opID)
+	case management.OperationStatusInProgress:
+		return false, nil
+	}
+	return true, fmt.Errorf("Unhandled operation status returned from API: %s", op.Status)
+}
+
+// nextPollInterval doubles the interval between status checks, up to max.
+func nextPollInterval(interval, max time.Duration) time.Duration {
+	if interval *= 2; interval > max {
+		return max
 	}
+	return interval
 }
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+)
+
+const spinnerInterval = time.Millisecond * 100
+
+var spinnerFrames = []string{"|", "/", "-", "\\"}
+
+// isTerminal reports whether f is an interactive terminal.
+func isTerminal(f *os.File) bool {
+	fi, err := f.Stat()
+	return err == nil && fi.Mode()&os.ModeCharDevice != 0
+}
+
+// startSpinner draws a spinner and the elapsed time after the message on w
+// until the returned function is called, which erases it.
+func startSpinner(w io.Writer, msg string) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		start := time.Now()
+		t := time.NewTicker(spinnerInterval)
+		defer t.Stop()
+		for i := 0; ; i++ {
+			fmt.Fprintf(w, "\r%s %s (%v)", spinnerFrames[i%len(spinnerFrames)], msg, time.Since(start).Truncate(time.Second))
+			select {
+			case <-t.C:
+			case <-done:
+				fmt.Fprint(w, "\r\033[K")
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSpinnerErasesLineWhenStopped(t *testing.T) {
+	var b bytes.Buffer
+	stop := startSpinner(&b, "Waiting for operation")
+	stop()
+
+	out := b.String()
+	if !strings.Contains(out, "Waiting for operation") {
+		t.Fatalf("Expected the message to be drawn, but got %q", out)
+	}
+	if !strings.HasSuffix(out, "\r\033[K") {
+		t.Fatalf("Expected the line to be erased, but got %q", out)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/olekukonko/tablewriter"
+)
+
+// Statuses of the steps of a stepReport.
+const (
+	stepSucceeded = "succeeded"
+	stepFailed    = "failed"
+	stepSkipped   = "skipped"
+	stepStarted   = "started"
+)
+
+// step is a step of a multi-step command, e.g. publishing a version and then
+// waiting for its replication.
+type step struct {
+	Name     string
+	Status   string
+	Duration string
+}
+
+// stepReport records the steps of a command, to print them as a summary once
+// the command finished, successfully or not. A nil report records nothing,
+// so that commands run their steps the same way with or without --summary.
+type stepReport struct {
+	steps []step
+}
+
+// run runs a step and records its duration and whether it failed.
+func (r *stepReport) run(name string, f func() error) error {
+	start := time.Now()
+	err := f()
+	if r != nil {
+		status := stepSucceeded
+		if err != nil {
+			status = stepFailed
+		}
+		r.steps = append(r.steps, step{name, status, time.Since(start).Round(time.Millisecond).String()})
+	}
+	return err
+}
+
+// skip records a step which was not needed.
+func (r *stepReport) skip(name string) {
+	if r != nil {
+		r.steps = append(r.steps, step{name, stepSkipped, "0s"})
+	}
+}
+
+// mark replaces the status of the last step, e.g. for an operation which was
+// only started.
+func (r *stepReport) mark(status string) {
+	if r != nil && len(r.steps) > 0 {
+		r.steps[len(r.steps)-1].Status = status
+	}
+}
+
+// stepsHeader is the header of the columns of the rows of a stepReport.
+var stepsHeader = []string{"Step", "Status", "Duration"}
+
+func (r *stepReport) rows() [][]string {
+	data := [][]string{}
+	for _, s := range r.steps {
+		data = append(data, []string{s.Name, s.Status, s.Duration})
+	}
+	return data
+}
+
+// print prints the summary of the steps in the output format.
+func (r *stepReport) print(output string) error {
+	switch output {
+	case "json":
+		b, err := json.MarshalIndent(r.steps, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format as json: %+v", err)
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", string(b))
+	case "csv":
+		return writeCSV(os.Stdout, stepsHeader, r.rows())
+	default:
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetHeader(stepsHeader)
+		table.AppendBulk(r.rows())
+		table.Render()
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestStepReport(t *testing.T) {
+	r := &stepReport{}
+	if err := r.run("validate", func() error { return nil }); err != nil {
+		t.Fatal(err)
+	}
+	failure := errors.New("failure")
+	if err := r.run("publish", func() error { return failure }); err != failure {
+		t.Fatalf("Expected the error of the step, but got %v", err)
+	}
+	r.mark(stepStarted)
+	r.skip("replicate")
+
+	expected := [][]string{{"validate", stepSucceeded}, {"publish", stepStarted}, {"replicate", stepSkipped}}
+	var got [][]string
+	for _, row := range r.rows() {
+		got = append(got, row[:2])
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, got)
+	}
+
+	// Steps run the same without a report.
+	var none *stepReport
+	ran := false
+	none.run("validate", func() error { ran = true; return nil })
+	none.skip("publish")
+	none.mark(stepStarted)
+	if !ran {
+		t.Fatal("Expected the step to run without a report")
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+	"github.com/olekukonko/tablewriter"
+)
+
+// splitSubscriptions splits a comma-separated list of subscription IDs or
+// certificate files, trimming the whitespace around each item.
+func splitSubscriptions(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// mkClients creates the clients of the comma-separated subscriptions given
+// with --subscription-id. With several subscriptions, --subscription-cert is
+// either a single certificate uploaded to all of them, or one certificate per
+// subscription in the same order.
+func mkClients(ctx context.Context, c *cli.Context) ([]ExtensionsClient, error) {
+	ids := splitSubscriptions(stringFlag(c, flSubsID.Name))
+	if len(ids) <= 1 {
+		cl, err := mkClient(ctx, c)
+		return []ExtensionsClient{cl}, err
+	}
+	if stringFlag(c, flPublishSettings.Name) != "" {
+		return nil, fmt.Errorf("--%s cannot be used with several subscriptions", flPublishSettings.Name)
+	}
+	certFiles := splitSubscriptions(stringFlag(c, flSubsCert.Name))
+	if len(certFiles) > 1 && len(certFiles) != len(ids) {
+		return nil, fmt.Errorf("--%s has %d certificates for %d subscriptions, give one certificate per subscription or a single one for all of them", flSubsCert.Name, len(certFiles), len(ids))
+	}
+
+	clients := make([]ExtensionsClient, len(ids))
+	for i, id := range ids {
+		sub := subscription{id: id}
+		if len(certFiles) == len(ids) {
+			sub.certFiles = certFiles[i]
+		}
+		cl, err := newClientFromFlags(ctx, c, sub)
+		if err != nil {
+			return nil, err
+		}
+		clients[i] = cl
+	}
+	log.Debugf("Created clients of %d subscriptions.", len(clients))
+	return clients, nil
+}
+
+// forEachSubscription calls f with the index and client of each subscription,
+// with at most concurrency calls at a time, and returns the first error in the
+// order of the clients.
+func forEachSubscription(clients []ExtensionsClient, concurrency int, f func(i int, cl ExtensionsClient) error) error {
+	errs := make([]error, len(clients))
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				if err := f(j, clients[j]); err != nil {
+					errs[j] = wrapf(err, "Subscription %s: %v", clients[j].SubscriptionID(), err)
+				}
+			}
+		}()
+	}
+	for i := range clients {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subscriptionVersion is a published version of a subscription.
+type subscriptionVersion struct {
+	Subscription string
+	PublishedExtension
+}
+
+// listVersionsOfSubscriptions prints the published versions of several
+// subscriptions in one table.
+func listVersionsOfSubscriptions(ctx context.Context, c *cli.Context, clients []ExtensionsClient, output string) error {
+	concurrency := c.Int(flConcurrency.Name)
+	if concurrency <= 0 {
+		return fmt.Errorf("argument %q must be a positive number", flConcurrency.Name)
+	}
+
+	versions := make([]ListVersionsResponse, len(clients))
+	err := forEachSubscription(clients, concurrency, func(i int, cl ExtensionsClient) error {
+		v, err := cl.ListVersions(ctx)
+		if err != nil {
+			return err
+		}
+		v.Extensions = filterVersions(v.Extensions, stringFlag(c, flNamespace.Name), stringFlag(c, flName.Name))
+		versions[i] = v
+		return nil
+	})
+	if err != nil {
+		return wrapf(err, "Request failed: %v", err)
+	}
+
+	header := append([]string{"Subscription"}, listVersionsHeader...)
+	var (
+		rows [][]string
+		all  = []subscriptionVersion{}
+	)
+	for i, v := range versions {
+		for _, row := range listVersionsRows(v) {
+			rows = append(rows, append([]string{clients[i].SubscriptionID()}, row...))
+		}
+		for _, e := range v.Extensions {
+			all = append(all, subscriptionVersion{clients[i].SubscriptionID(), e})
+		}
+	}
+
+	switch output {
+	case "json":
+		b, err := json.MarshalIndent(all, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format as json: %+v", err)
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", string(b))
+	case "csv":
+		return writeCSV(os.Stdout, header, rows)
+	default:
+		table := tablewriter.NewWriter(os.Stdout)
+		table.SetColWidth(4000)
+		table.SetHeader(header)
+		table.AppendBulk(rows)
+		table.Render()
+	}
+	return nil
+}
+
+// subscriptionReplicationStatus is the replication status of a version in a
+// subscription.
+type subscriptionReplicationStatus struct {
+	Subscription string
+	versionReplicationStatus
+}
+
+// replicationStatusOfSubscriptions prints the replication status of the
+// version, or of all versions with --all, in several subscriptions in one
+// table.
+func replicationStatusOfSubscriptions(ctx context.Context, c *cli.Context, clients []ExtensionsClient) error {
+	output, err := outputFormat(c)
+	if err != nil {
+		return err
+	}
+	if c.Bool(flWait.Name) {
+		return fmt.Errorf("--%s cannot be used with several subscriptions", flWait.Name)
+	}
+	concurrency := c.Int(flConcurrency.Name)
+	if concurrency <= 0 {
+		return fmt.Errorf("argument %q must be a positive number", flConcurrency.Name)
+	}
+	var ns, name, version string
+	if !c.Bool(flAll.Name) {
+		if ns, name, version, err = checkVersionFlags(c); err != nil {
+			return err
+		}
+	}
+
+	results := make([][]versionReplicationStatus, len(clients))
+	err = forEachSubscription(clients, concurrency, func(i int, cl ExtensionsClient) error {
+		if !c.Bool(flAll.Name) {
+			rs, err := cl.GetReplicationStatus(ctx, ns, name, version)
+			results[i] = []versionReplicationStatus{{Namespace: ns, Name: name, Version: version, Statuses: rs.Statuses}}
+			return err
+		}
+		v, err := cl.ListVersions(ctx)
+		if err != nil {
+			return err
+		}
+		exts := filterVersions(v.Extensions, stringFlag(c, flNamespace.Name), stringFlag(c, flName.Name))
+		results[i], err = fetchReplicationStatuses(ctx, cl, exts, concurrency)
+		if err != nil {
+			return err
+		}
+		for _, r := range results[i] {
+			if r.err != nil {
+				return fmt.Errorf("Cannot fetch replication status of %s.%s %s: %v", r.Namespace, r.Name, r.Version, r.err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return wrapf(err, "Cannot fetch replication status: %v", err)
+	}
+
+	// The rows of all subscriptions are built at once, so that they all have
+	// the detail columns if any location has details.
+	var (
+		flat   []versionReplicationStatus
+		subs   []string
+		all    = []subscriptionReplicationStatus{}
+		failed int
+	)
+	for i, rs := range results {
+		for _, r := range rs {
+			flat = append(flat, r)
+			for range r.Statuses {
+				subs = append(subs, clients[i].SubscriptionID())
+			}
+			all = append(all, subscriptionReplicationStatus{clients[i].SubscriptionID(), r})
+			failed += summarizeReplication(ReplicationStatusResponse{Statuses: r.Statuses}).failed
+		}
+	}
+	header := append([]string{"Subscription"}, allReplicationStatusHeader(flat)...)
+	var rows [][]string
+	for i, row := range allReplicationStatusRows(flat) {
+		rows = append(rows, append([]string{subs[i]}, row...))
+	}
+
+	switch output {
+	case "json":
+		b, err := json.MarshalIndent(all, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to format as json: %+v", err)
+		}
+		fmt.Fprintf(os.Stdout, "%s\n", string(b))
+	case "csv":
+		if err := writeCSV(os.Stdout, header, rows); err != nil {
+			return err
+		}
+	default:
+		if !c.GlobalBool("quiet") {
+			colorStatuses(header, rows)
+			table := tablewriter.NewWriter(os.Stdout)
+			table.SetHeader(header)
+			table.AppendBulk(rows)
+			table.Render()
+		}
+	}
+
+	if failed > 0 {
+		return errorf(exitCodeOperationFailure, "Replication failed in %d locations.", failed)
+	}
+	return nil
+}
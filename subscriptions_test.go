@@ -0,0 +1,52 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/codegangsta/cli"
+)
+
+func TestMkClientsRequiresOneCertPerSubscription(t *testing.T) {
+	set := flag.NewFlagSet("list-versions", flag.ContinueOnError)
+	set.String(flSubsID.Name, "sub-1, sub-2,sub-3", "")
+	set.String(flSubsCert.Name, "a.pem,b.pem", "")
+	set.String(flPublishSettings.Name, "", "")
+	c := cli.NewContext(nil, set, cli.NewContext(nil, flag.NewFlagSet("global", flag.ContinueOnError), nil))
+
+	if _, err := mkClients(context.Background(), c); err == nil || !strings.Contains(err.Error(), "2 certificates for 3 subscriptions") {
+		t.Fatalf("Expected an error for mismatched certificates, but got: %v", err)
+	}
+}
+
+func TestForEachSubscription(t *testing.T) {
+	var requests int32
+	ok, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`<ExtensionImages><ExtensionImage><Type>CustomScript</Type></ExtensionImage></ExtensionImages>`))
+	})
+	defer done()
+	failing, done2 := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusForbidden)
+	})
+	defer done2()
+
+	clients := []ExtensionsClient{ok, failing, ok}
+	versions := make([]int, len(clients))
+	err := forEachSubscription(clients, 2, func(i int, cl ExtensionsClient) error {
+		v, err := cl.ListVersions(context.Background())
+		versions[i] = len(v.Extensions)
+		return err
+	})
+	if exitCode(err) != exitCodeAuthFailure || !strings.HasPrefix(err.Error(), "Subscription subscription-id: ") {
+		t.Fatalf("Expected the authentication error of the subscription, but got: %v", err)
+	}
+	if requests != 3 || versions[0] != 1 || versions[2] != 1 {
+		t.Fatalf("Expected all subscriptions to be listed, but got %d requests and versions %v", requests, versions)
+	}
+}
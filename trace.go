@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"strings"
+)
+
+// redactedHeaders are the request headers holding credentials, which are not
+// traced.
+var redactedHeaders = []string{"Authorization"}
+
+// isTokenRequest reports whether req requests an Azure AD token, whose
+// request body holds the client secret and response body the token.
+func isTokenRequest(req *http.Request) bool {
+	return strings.HasSuffix(req.URL.Path, "/oauth2/token")
+}
+
+// tracingTransport is an http.RoundTripper writing the requests it sends and
+// the responses it receives to w.
+type tracingTransport struct {
+	transport http.RoundTripper
+	w         io.Writer
+}
+
+func (t tracingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	traced := cloneRequest(req)
+	for _, h := range redactedHeaders {
+		if traced.Header.Get(h) != "" {
+			traced.Header.Set(h, "REDACTED")
+		}
+	}
+	body := !isTokenRequest(req)
+	b, err := httputil.DumpRequestOut(traced, body)
+	if err != nil {
+		return nil, err
+	}
+	// The clone shares the body of the request, which DumpRequestOut
+	// consumed and replaced on the clone only.
+	req.Body = traced.Body
+	fmt.Fprintf(t.w, "--> %s\n\n", b)
+
+	resp, err := t.transport.RoundTrip(req)
+	if err != nil {
+		fmt.Fprintf(t.w, "<-- %v\n\n", err)
+		return nil, err
+	}
+	b, err = httputil.DumpResponse(resp, body)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Fprintf(t.w, "<-- %s\n\n", b)
+	return resp, nil
+}
+
+// cloneRequest returns a copy of req with its own URL and headers, which
+// transports must not modify on the request they are given.
+func cloneRequest(req *http.Request) *http.Request {
+	r := new(http.Request)
+	*r = *req
+	u := *req.URL
+	r.URL = &u
+	r.Header = make(http.Header, len(req.Header))
+	for k, v := range req.Header {
+		r.Header[k] = append([]string(nil), v...)
+	}
+	return r
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracingTransport(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) != "<ExtensionImage/>" {
+			t.Errorf("Expected the request body to be sent, but got %q", b)
+		}
+		w.Write([]byte("<Response/>"))
+	}))
+	defer srv.Close()
+
+	var trace bytes.Buffer
+	cl := http.Client{Transport: tracingTransport{http.DefaultTransport, &trace}}
+	req, _ := http.NewRequest("PUT", srv.URL, strings.NewReader("<ExtensionImage/>"))
+	req.Header.Set("Authorization", "Bearer secret")
+	resp, err := cl.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(b) != "<Response/>" {
+		t.Fatalf("Expected the response body to be preserved, but got %q", b)
+	}
+
+	out := trace.String()
+	for _, s := range []string{"PUT / HTTP/1.1", "<ExtensionImage/>", "<Response/>", "Authorization: REDACTED"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Expected the trace to contain %q, but got %q", s, out)
+		}
+	}
+	if strings.Contains(out, "secret") {
+		t.Errorf("Expected the credentials to be redacted, but got %q", out)
+	}
+	if h := req.Header.Get("Authorization"); h != "Bearer secret" {
+		t.Errorf("Expected the request to be left as is, but its Authorization header is %q", h)
+	}
+}
@@ -2,28 +2,64 @@ package main
 
 import (
 	"bytes"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io/ioutil"
 	"text/template"
 
+	"github.com/Azure/azure-sdk-for-go/management"
 	log "github.com/Sirupsen/logrus"
 	"github.com/codegangsta/cli"
 )
 
-func unpublishVersion(c *cli.Context) {
+func unpublishVersion(ctx context.Context, c *cli.Context) error {
+	ns, name, version, err := checkVersionFlags(c)
+	if err != nil {
+		return err
+	}
+	b, err := newVisibilityManifest(ns, name, version, true, c.Bool(flIsXMLExtension.Name))
+	if err != nil {
+		return err
+	}
+
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	if c.GlobalBool(flDryRun.Name) {
+		printDryRun("PUT", cl.RequestURL(updateExtensionPath), b)
+		return nil
+	}
+	if err := checkConfirmNamespace(c, ns, name, version); err != nil {
+		return err
+	}
+	cl.detach = !c.BoolT(flWaitOperation.Name)
+	if err := dumpManifest(c, b); err != nil {
+		return err
+	}
+	return updateExtensionAndWait(ctx, cl, b)
+}
+
+// newVisibilityManifest builds a manifest which only changes whether the
+// specified extension version is internal.
+func newVisibilityManifest(namespace, name, version string, isInternal, isXMLExtension bool) ([]byte, error) {
 	p := struct {
 		Namespace, Name, Version string
+		IsInternal               bool
 	}{
-		Namespace: checkFlag(c, flNamespace.Name),
-		Name:      checkFlag(c, flName.Name),
-		Version:   checkFlag(c, flVersion.Name)}
+		Namespace:  namespace,
+		Name:       name,
+		Version:    version,
+		IsInternal: isInternal}
 
-	isXMLExtension := c.Bool(flIsXMLExtension.Name)
 	buf := bytes.NewBufferString(`<?xml version="1.0" encoding="utf-8" ?>
 <ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure"  xmlns:i="http://www.w3.org/2001/XMLSchema-instance">
   <!-- WARNING: Ordering of fields matter in this file. -->
-  <ProviderNameSpace>{{.Namespace}}</ProviderNameSpace>
-  <Type>{{.Name}}</Type>
-  <Version>{{.Version}}</Version>
-  <IsInternalExtension>true</IsInternalExtension>
+  <ProviderNameSpace>{{xml .Namespace}}</ProviderNameSpace>
+  <Type>{{xml .Name}}</Type>
+  <Version>{{xml .Version}}</Version>
+  <IsInternalExtension>{{.IsInternal}}</IsInternalExtension>
 `)
 
 	// All extension should be a JSON extension.  The biggest offenders are
@@ -33,25 +69,47 @@ func unpublishVersion(c *cli.Context) {
 	}
 
 	buf.WriteString("</ExtensionImage>")
-	tpl, err := template.New("unregisterManifest").Parse(buf.String())
+	// text/template does not escape XML, unlike the manifests marshaled
+	// with encoding/xml, so values are escaped explicitly.
+	tpl, err := template.New("visibilityManifest").Funcs(template.FuncMap{"xml": escapeXML}).Parse(buf.String())
 	if err != nil {
-		log.Fatalf("template parse error: %v", err)
+		return nil, fmt.Errorf("template parse error: %v", err)
 	}
 
 	var b bytes.Buffer
 	if err = tpl.Execute(&b, p); err != nil {
-		log.Fatalf("template execute error: %v", err)
+		return nil, fmt.Errorf("template execute error: %v", err)
 	}
+	return b.Bytes(), nil
+}
 
-	cl := mkClient(checkFlag(c, flMgtURL.Name), checkFlag(c, flSubsID.Name), checkFlag(c, flSubsCert.Name))
-	op, err := cl.UpdateExtension(b.Bytes())
-	if err != nil {
-		log.Fatalf("UpdateExtension failed: %v", err)
+// dumpManifest writes the manifest about to be submitted to the file given
+// with --dump-manifest, if any, to keep a record of what was sent.
+func dumpManifest(c *cli.Context, manifest []byte) error {
+	path := stringFlag(c, flDumpManifest.Name)
+	if path == "" {
+		return nil
+	}
+	if err := ioutil.WriteFile(path, manifest, 0644); err != nil {
+		return fmt.Errorf("Cannot write manifest to --%s: %v", flDumpManifest.Name, err)
 	}
-	lg := log.WithField("x-ms-operation-id", op)
-	lg.Info("UpdateExtension operation started.")
-	if err := cl.WaitForOperation(op); err != nil {
-		lg.Fatalf("UpdateExtension failed: %v", err)
+	log.Debugf("Wrote manifest to %s.", path)
+	return nil
+}
+
+// escapeXML returns s escaped as XML character data.
+func escapeXML(s string) (string, error) {
+	var b bytes.Buffer
+	if err := xml.EscapeText(&b, []byte(s)); err != nil {
+		return "", err
 	}
-	lg.Info("UpdateExtension operation finished.")
+	return b.String(), nil
+}
+
+// updateExtensionAndWait submits the manifest with UpdateExtension and waits
+// for the operation to finish.
+func updateExtensionAndWait(ctx context.Context, cl ExtensionsClient, manifest []byte) error {
+	return runOperation(ctx, cl, "UpdateExtension", func() (management.OperationID, error) {
+		return cl.UpdateExtension(ctx, manifest)
+	})
 }
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/codegangsta/cli"
+)
+
+func TestDumpManifest(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dump")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "manifest.xml")
+	manifest, err := newVisibilityManifest("Microsoft.Azure.Extensions", "CustomScript", "2.0.1", true, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	set := flag.NewFlagSet("unpublish-version", flag.ContinueOnError)
+	set.String(flDumpManifest.Name, "", "")
+	c := cli.NewContext(nil, set, nil)
+	if err := dumpManifest(c, manifest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("Expected no manifest to be written without --%s, but got: %v", flDumpManifest.Name, err)
+	}
+
+	set.Set(flDumpManifest.Name, path)
+	if err := dumpManifest(c, manifest); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(b, manifest) {
+		t.Fatalf("Expected the submitted manifest, but got:\n%s", b)
+	}
+
+	set.Set(flDumpManifest.Name, filepath.Join(dir, "missing", "manifest.xml"))
+	if err := dumpManifest(c, manifest); err == nil {
+		t.Fatal("Expected an error writing to a missing directory")
+	}
+}
+
+func TestNewVisibilityManifestEscapesValues(t *testing.T) {
+	b, err := newVisibilityManifest("Contoso&Co", "<Script>", `2.0.1"`, false, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m extensionImage
+	if err := xml.Unmarshal(b, &m); err != nil {
+		t.Fatalf("Manifest is not well-formed XML: %v\n%s", err, b)
+	}
+	if m.ProviderNameSpace != "Contoso&Co" || m.Type != "<Script>" || m.Version != `2.0.1"` {
+		t.Fatalf("Expected the values to round-trip, but got %+v", m)
+	}
+	if !bytes.Contains(b, []byte("<!-- WARNING: Ordering of fields matter in this file. -->")) {
+		t.Fatalf("Expected the comment to be kept, but got:\n%s", b)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+func updateMediaLink(ctx context.Context, c *cli.Context) error {
+	ns, name, version, err := checkVersionFlags(c)
+	if err != nil {
+		return err
+	}
+	blobURL, err := blobURLFlag(c, func(fl string) string { return stringFlag(c, fl) })
+	if err != nil {
+		return err
+	}
+	if blobURL == "" {
+		if blobURL, err = checkFlag(c, flBlobURL.Name); err != nil {
+			return err
+		}
+	}
+	if u, err := url.Parse(blobURL); err != nil || u.Host == "" || u.Scheme != "https" {
+		return fmt.Errorf("Invalid blob URL %q, expected an https URL", strings.SplitN(blobURL, "?", 2)[0])
+	}
+
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	published, err := cl.GetExtensionManifest(ctx, ns, name, version)
+	if err != nil {
+		return wrapf(err, "Cannot get published version %s.%s %s: %v", ns, name, version, err)
+	}
+
+	b, err := newMetadataManifest(published, metadata{MediaLink: &blobURL})
+	if err != nil {
+		return err
+	}
+
+	if c.GlobalBool(flDryRun.Name) {
+		printDryRun("PUT", cl.RequestURL(updateExtensionPath), b)
+		return nil
+	}
+	log.Warnf("Changing the package of %s.%s %s may replicate it again to all its regions.", ns, name, version)
+	if !c.Bool(flConfirm.Name) {
+		return fmt.Errorf("Pass --%s to change the package of a published version.", flConfirm.Name)
+	}
+	if err := dumpManifest(c, b); err != nil {
+		return err
+	}
+	return updateExtensionAndWait(ctx, cl, b)
+}
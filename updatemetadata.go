@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+
+	"github.com/codegangsta/cli"
+)
+
+func updateMetadata(ctx context.Context, c *cli.Context) error {
+	ns, name, version, err := checkVersionFlags(c)
+	if err != nil {
+		return err
+	}
+	if !c.IsSet(flLabel.Name) && !c.IsSet(flDescription.Name) && !c.IsSet(flHomepageURL.Name) {
+		return fmt.Errorf("At least one of --%s, --%s or --%s must be provided", flLabel.Name, flDescription.Name, flHomepageURL.Name)
+	}
+	if problems := validateMetadata(c.String(flLabel.Name), c.String(flDescription.Name)); len(problems) > 0 {
+		return problems
+	}
+
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	published, err := cl.GetExtensionManifest(ctx, ns, name, version)
+	if err != nil {
+		return wrapf(err, "Cannot get published version %s.%s %s: %v", ns, name, version, err)
+	}
+
+	b, err := newMetadataManifest(published, metadata{
+		Label:       optionalFlag(c, flLabel.Name),
+		Description: optionalFlag(c, flDescription.Name),
+		HomepageURI: optionalFlag(c, flHomepageURL.Name),
+	})
+	if err != nil {
+		return err
+	}
+
+	if c.GlobalBool(flDryRun.Name) {
+		printDryRun("PUT", cl.RequestURL(updateExtensionPath), b)
+		return nil
+	}
+	if err := dumpManifest(c, b); err != nil {
+		return err
+	}
+	return updateExtensionAndWait(ctx, cl, b)
+}
+
+// metadata holds the fields of a manifest to update. Nil fields are left
+// unchanged.
+type metadata struct {
+	Label, Description, HomepageURI, MediaLink *string
+}
+
+// newMetadataManifest applies the metadata to a published manifest, keeping
+// all other fields as published.
+func newMetadataManifest(published []byte, m metadata) ([]byte, error) {
+	var manifest extensionImage
+	if err := xml.Unmarshal(published, &manifest); err != nil {
+		return nil, fmt.Errorf("Error parsing published manifest: %v", err)
+	}
+	manifest.NS = "http://schemas.microsoft.com/windowsazure"
+
+	if m.Label != nil {
+		manifest.Label = *m.Label
+	}
+	if m.Description != nil {
+		manifest.Description = *m.Description
+	}
+	if m.HomepageURI != nil {
+		manifest.HomepageURI = *m.HomepageURI
+	}
+	if m.MediaLink != nil {
+		manifest.MediaLink = *m.MediaLink
+	}
+
+	b, err := xml.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("xml marshall error: %v", err)
+	}
+	return b, nil
+}
+
+// optionalFlag returns the value of the flag, or nil if it was not given on
+// the command line. The config file is ignored, so that only the fields given
+// are updated.
+func optionalFlag(c *cli.Context, fl string) *string {
+	if !c.IsSet(fl) {
+		return nil
+	}
+	v := c.String(fl)
+	return &v
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/xml"
+	"testing"
+)
+
+func TestNewMetadataManifestPreservesOtherFields(t *testing.T) {
+	published := []byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">
+  <ProviderNameSpace>Microsoft.Azure.Extensions</ProviderNameSpace>
+  <Type>CustomScript</Type>
+  <Version>2.0.1</Version>
+  <Label>Old label</Label>
+  <MediaLink>https://example.blob.core.windows.net/packages/1.zip</MediaLink>
+  <Description>Old description</Description>
+  <IsInternalExtension>false</IsInternalExtension>
+  <CompanyName>Microsoft</CompanyName>
+  <Regions>West US;East US</Regions>
+</ExtensionImage>`)
+	label := "New label"
+
+	b, err := newMetadataManifest(published, metadata{Label: &label})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m extensionImage
+	if err := xml.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Label != label {
+		t.Errorf("Expected label %q, but got %q", label, m.Label)
+	}
+	if m.Description != "Old description" || m.CompanyName != "Microsoft" || m.Regions != "West US;East US" ||
+		m.MediaLink != "https://example.blob.core.windows.net/packages/1.zip" {
+		t.Errorf("Expected other fields to be preserved, but got %+v", m)
+	}
+}
+
+func TestNewMetadataManifestReplacesMediaLink(t *testing.T) {
+	published := []byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">
+  <ProviderNameSpace>Microsoft.Azure.Extensions</ProviderNameSpace>
+  <Type>CustomScript</Type>
+  <Version>2.0.1</Version>
+  <Label>Custom Script</Label>
+  <MediaLink>https://example.blob.core.windows.net/packages/1.zip</MediaLink>
+  <IsInternalExtension>false</IsInternalExtension>
+</ExtensionImage>`)
+	blobURL := "https://example.blob.core.windows.net/packages/2.zip"
+
+	b, err := newMetadataManifest(published, metadata{MediaLink: &blobURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m extensionImage
+	if err := xml.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.MediaLink != blobURL {
+		t.Errorf("Expected MediaLink %q, but got %q", blobURL, m.MediaLink)
+	}
+	if m.Label != "Custom Script" || m.Version != "2.0.1" || m.IsInternalExtension {
+		t.Errorf("Expected other fields to be preserved, but got %+v", m)
+	}
+}
+
+func TestNewMetadataManifestKeepsSASQuery(t *testing.T) {
+	published := []byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">
+  <ProviderNameSpace>Microsoft.Azure.Extensions</ProviderNameSpace>
+  <Type>CustomScript</Type>
+  <Version>2.0.1</Version>
+  <MediaLink>https://example.blob.core.windows.net/packages/1.zip</MediaLink>
+</ExtensionImage>`)
+	blobURL := "https://example.blob.core.windows.net/packages/2.zip?sv=2019-12-12&sr=b&sig=abc%2Bdef%3D&sp=r"
+
+	b, err := newMetadataManifest(published, metadata{MediaLink: &blobURL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := validateManifest(b); err != nil {
+		t.Fatal(err)
+	}
+	var m extensionImage
+	if err := xml.Unmarshal(b, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.MediaLink != blobURL {
+		t.Errorf("Expected MediaLink %q, but got %q", blobURL, m.MediaLink)
+	}
+}
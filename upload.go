@@ -0,0 +1,356 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/management/storageservice"
+	"github.com/Azure/azure-sdk-for-go/storage"
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+const (
+	containerName = "extension-packages"
+
+	// uploadBlockSize is the default size of the blocks extension packages
+	// are uploaded in, and maxUploadBlockSize the largest block accepted by
+	// the storage API version used.
+	uploadBlockSize    = 4 * 1024 * 1024
+	maxUploadBlockSize = 100 * 1024 * 1024
+)
+
+func uploadPackage(ctx context.Context, c *cli.Context) error {
+	packagePath, err := checkFlag(c, flPackage.Name)
+	if err != nil {
+		return err
+	}
+	storageRealm, err := checkFlag(c, flStorageRealm.Name)
+	if err != nil {
+		return err
+	}
+	storageAccount, err := checkFlag(c, flStorageAccount.Name)
+	if err != nil {
+		return err
+	}
+	blockSize := c.Int(flBlockSize.Name) * 1024 * 1024
+	if blockSize < 1 || blockSize > maxUploadBlockSize {
+		return fmt.Errorf("--%s must be between 1 and %d MiB", flBlockSize.Name, maxUploadBlockSize/1024/1024)
+	}
+
+	key := stringFlag(c, flStorageKey.Name)
+	if key == "" {
+		cl, err := mkClient(ctx, c)
+		if err != nil {
+			return err
+		}
+		if key, err = storageAccountKey(ctx, cl, storageAccount); err != nil {
+			return err
+		}
+	}
+
+	containerName, err := checkFlag(c, flContainer.Name)
+	if err != nil {
+		return err
+	}
+	container, err := packageContainer(storageRealm, storageAccount, key, containerName)
+	if err != nil {
+		return err
+	}
+
+	blob := container.GetBlobReference(filepath.Base(packagePath))
+	if !c.Bool(flForce.Name) {
+		exists, err := blob.Exists()
+		if err != nil {
+			return fmt.Errorf("Error checking if blob exists: %v", err)
+		}
+		if exists {
+			return fmt.Errorf("Blob %s already exists, pass --%s to overwrite it.", blob.GetURL(), flForce.Name)
+		}
+	}
+
+	sum, err := putBlockBlob(blob, packagePath, blockSize, uploadStatePath(packagePath))
+	if err != nil {
+		return err
+	}
+	log.WithFields(log.Fields{
+		"md5":    sum.MD5,
+		"sha256": sum.SHA256,
+	}).Infof("Extension package uploaded to: %s", blob.GetURL())
+	if c.Bool(flVerifyChecksum.Name) {
+		if err := verifyBlobChecksum(blob, sum); err != nil {
+			return err
+		}
+		log.Info("Uploaded blob matches the package checksum.")
+	}
+	fmt.Println(blob.GetURL())
+	return nil
+}
+
+func uploadBlob(ctx context.Context, cl ExtensionsClient, storageRealm, storageAccount, packagePath string) (string, error) {
+	key, err := storageAccountKey(ctx, cl, storageAccount)
+	if err != nil {
+		return "", err
+	}
+
+	container, err := packageContainer(storageRealm, storageAccount, key, containerName)
+	if err != nil {
+		return "", err
+	}
+
+	blobName := fmt.Sprintf("%d.zip", time.Now().Unix())
+	blob := container.GetBlobReference(blobName)
+	// Blob names are unique, so there is no upload to resume.
+	sum, err := putBlockBlob(blob, packagePath, uploadBlockSize, "")
+	if err != nil {
+		return "", err
+	}
+	log.WithFields(log.Fields{
+		"md5":    sum.MD5,
+		"sha256": sum.SHA256,
+	}).Debug("Extension package uploaded.")
+	return blob.GetURL(), nil
+}
+
+// storageAccountKey fetches the primary key of a storage account in the
+// publisher subscription.
+func storageAccountKey(ctx context.Context, cl ExtensionsClient, storageAccount string) (string, error) {
+	var keys storageservice.GetStorageServiceKeysResponse
+	b, err := cl.client.SendAzureGetRequest(ctx, fmt.Sprintf("services/storageservices/%s/keys", storageAccount))
+	if err == nil {
+		err = xml.Unmarshal(b, &keys)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Could not fetch keys for storage account. Make sure it is in publisher subscription. Error: %v", err)
+	}
+	log.Debug("Retrieved storage account keys.")
+	return keys.PrimaryKey, nil
+}
+
+// packageContainer returns the blob container extension packages are uploaded
+// to, creating it with public blob access if it does not exist.
+func packageContainer(storageRealm, storageAccount, key, name string) (*storage.Container, error) {
+	sc, err := storage.NewClient(storageAccount, key, storageRealm, storage.DefaultAPIVersion, true)
+	if err != nil {
+		return nil, fmt.Errorf("Could not create storage client: %v", err)
+	}
+
+	bs := sc.GetBlobService()
+	container := bs.GetContainerReference(name)
+	opts := storage.CreateContainerOptions{
+		Access: storage.ContainerAccessTypeBlob,
+	}
+
+	if _, err := container.CreateIfNotExists(&opts); err != nil {
+		return nil, fmt.Errorf("Error creating blob container: %v", err)
+	}
+	return container, nil
+}
+
+// packageChecksum is the checksum of an extension package. MD5 is base64
+// encoded, like the Content-MD5 of blobs, and SHA256 is hex encoded.
+type packageChecksum struct {
+	MD5, SHA256 string
+}
+
+// uploadState is the progress of an upload, saved while uploading so that an
+// interrupted upload of the package to the same blob resumes from the blocks
+// already uploaded. Azure keeps uncommitted blocks for a week.
+type uploadState struct {
+	BlobURL   string
+	Size      int64
+	ModTime   time.Time
+	BlockSize int
+
+	// Blocks are the base64 MD5 of the uploaded blocks, by block ID.
+	Blocks map[string]string
+}
+
+// uploadStatePath returns the path of the upload state of a package.
+func uploadStatePath(packagePath string) string {
+	return packagePath + ".upload-state.json"
+}
+
+// readUploadState reads the upload state saved at path, returning an empty
+// state if there is none.
+func readUploadState(path string) (uploadState, error) {
+	var s uploadState
+	b, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+	return s, json.Unmarshal(b, &s)
+}
+
+func (s uploadState) save(path string) error {
+	b, err := json.Marshal(s)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, b, 0600)
+}
+
+// resumes reports whether the state is of an upload of the same package to
+// the same blob in blocks of the same size.
+func (s uploadState) resumes(prev uploadState) bool {
+	return prev.BlobURL == s.BlobURL && prev.Size == s.Size && prev.ModTime.Equal(s.ModTime) && prev.BlockSize == s.BlockSize
+}
+
+// putBlockBlob uploads the package in blocks of blockSize, logging the
+// progress after each block, and commits them as the contents of the blob.
+// Each block is sent with its MD5, so that Azure rejects corrupted blocks, and
+// the checksum of the package is stored in the Content-MD5 and the sha256
+// metadata of the blob, which is checked once committed.
+//
+// If statePath is not empty, the progress is saved there after each block,
+// and an interrupted upload is resumed by skipping the blocks Azure still
+// holds uncommitted with the same MD5.
+func putBlockBlob(blob *storage.Blob, packagePath string, blockSize int, statePath string) (packageChecksum, error) {
+	var sum packageChecksum
+	pkg, err := os.OpenFile(packagePath, os.O_RDONLY, 0777)
+	if err != nil {
+		return sum, fmt.Errorf("Could not reach package file: %v", err)
+	}
+	defer pkg.Close()
+
+	fi, err := pkg.Stat()
+	if err != nil {
+		return sum, fmt.Errorf("Could not reach package file: %v", err)
+	}
+
+	state := uploadState{BlobURL: blob.GetURL(), Size: fi.Size(), ModTime: fi.ModTime(), BlockSize: blockSize, Blocks: map[string]string{}}
+	if statePath != "" {
+		if state.Blocks, err = resumableBlocks(blob, state, statePath); err != nil {
+			return sum, err
+		}
+		if len(state.Blocks) > 0 {
+			log.Infof("Resuming upload, %d blocks were already uploaded.", len(state.Blocks))
+		}
+	}
+
+	var (
+		blocks    []storage.Block
+		uploaded  int64
+		buf       = make([]byte, blockSize)
+		md5Sum    = md5.New()
+		sha256Sum = sha256.New()
+	)
+	for i := 0; ; i++ {
+		n, err := io.ReadFull(pkg, buf)
+		if n > 0 {
+			id := base64.StdEncoding.EncodeToString([]byte(fmt.Sprintf("%08d", i)))
+			blockMD5 := md5.Sum(buf[:n])
+			b64MD5 := base64.StdEncoding.EncodeToString(blockMD5[:])
+			if state.Blocks[id] != b64MD5 {
+				opts := storage.PutBlockOptions{ContentMD5: b64MD5}
+				if err := blob.PutBlock(id, buf[:n], &opts); err != nil {
+					return sum, fmt.Errorf("Error uploading blob: %v", err)
+				}
+				if statePath != "" {
+					state.Blocks[id] = b64MD5
+					if err := state.save(statePath); err != nil {
+						return sum, fmt.Errorf("Error saving upload state: %v", err)
+					}
+				}
+			}
+			blocks = append(blocks, storage.Block{ID: id, Status: storage.BlockStatusUncommitted})
+			md5Sum.Write(buf[:n])
+			sha256Sum.Write(buf[:n])
+
+			uploaded += int64(n)
+			log.Infof("Uploaded %d of %d bytes (%d%%).", uploaded, fi.Size(), uploaded*100/fi.Size())
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		} else if err != nil {
+			return sum, fmt.Errorf("Error reading package file: %v", err)
+		}
+	}
+
+	sum.MD5 = base64.StdEncoding.EncodeToString(md5Sum.Sum(nil))
+	sum.SHA256 = hex.EncodeToString(sha256Sum.Sum(nil))
+	blob.Properties.ContentMD5 = sum.MD5
+	blob.Metadata = storage.BlobMetadata{"sha256": sum.SHA256}
+	if err := blob.PutBlockList(blocks, nil); err != nil {
+		return sum, fmt.Errorf("Error committing blob: %v", err)
+	}
+	if statePath != "" {
+		if err := os.Remove(statePath); err != nil && !os.IsNotExist(err) {
+			log.Warnf("Cannot remove upload state: %v", err)
+		}
+	}
+
+	if err := blob.GetProperties(nil); err != nil {
+		return sum, fmt.Errorf("Error checking committed blob: %v", err)
+	}
+	if blob.Properties.ContentLength != fi.Size() || blob.Properties.ContentMD5 != sum.MD5 {
+		return sum, fmt.Errorf("Committed blob %s has %d bytes with Content-MD5 %q, expected %d bytes with %q",
+			blob.GetURL(), blob.Properties.ContentLength, blob.Properties.ContentMD5, fi.Size(), sum.MD5)
+	}
+	return sum, nil
+}
+
+// resumableBlocks returns the blocks of the saved upload state which can be
+// skipped when uploading with the given state: those Azure still holds
+// uncommitted for the same package and blob.
+func resumableBlocks(blob *storage.Blob, state uploadState, statePath string) (map[string]string, error) {
+	blocks := map[string]string{}
+	prev, err := readUploadState(statePath)
+	if err != nil {
+		log.Warnf("Ignoring unreadable upload state %s: %v", statePath, err)
+		return blocks, nil
+	}
+	if len(prev.Blocks) == 0 || !state.resumes(prev) {
+		return blocks, nil
+	}
+
+	list, err := blob.GetBlockList(storage.BlockListTypeUncommitted, nil)
+	if err != nil {
+		log.Debugf("Cannot list uncommitted blocks, uploading all blocks: %v", err)
+		return blocks, nil
+	}
+	for _, b := range list.UncommittedBlocks {
+		if sum, ok := prev.Blocks[b.Name]; ok {
+			blocks[b.Name] = sum
+		}
+	}
+	return blocks, nil
+}
+
+// verifyBlobChecksum downloads the blob and checks that its contents and
+// Content-MD5 match the checksum of the package.
+func verifyBlobChecksum(blob *storage.Blob, sum packageChecksum) error {
+	r, err := blob.Get(nil)
+	if err != nil {
+		return fmt.Errorf("Error downloading blob: %v", err)
+	}
+	defer r.Close()
+
+	md5Sum, sha256Sum := md5.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5Sum, sha256Sum), r); err != nil {
+		return fmt.Errorf("Error downloading blob: %v", err)
+	}
+	if blob.Properties.ContentMD5 != sum.MD5 {
+		return fmt.Errorf("Content-MD5 of blob %s is %q, expected %q", blob.GetURL(), blob.Properties.ContentMD5, sum.MD5)
+	}
+	if got := base64.StdEncoding.EncodeToString(md5Sum.Sum(nil)); got != sum.MD5 {
+		return fmt.Errorf("MD5 of blob %s is %q, expected %q", blob.GetURL(), got, sum.MD5)
+	}
+	if got := hex.EncodeToString(sha256Sum.Sum(nil)); got != sum.SHA256 {
+		return fmt.Errorf("SHA256 of blob %s is %q, expected %q", blob.GetURL(), got, sum.SHA256)
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/storage"
+)
+
+// fakeBlobStore is a blob service storing a single block blob, which fails
+// the block uploads after failAfter blocks if it is not 0.
+type fakeBlobStore struct {
+	mu          sync.Mutex
+	uncommitted map[string][]byte
+	content     []byte
+	contentMD5  string
+	puts        int
+	failAfter   int
+}
+
+var blockIDRegexp = regexp.MustCompile(`<Uncommitted>([^<]+)</Uncommitted>`)
+
+func (s *fakeBlobStore) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	q := r.URL.Query()
+	switch {
+	case r.Method == "PUT" && q.Get("comp") == "block":
+		if s.failAfter > 0 && s.puts >= s.failAfter {
+			// Server errors would be retried by the storage client.
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		s.uncommitted[q.Get("blockid")] = b
+		s.puts++
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "GET" && q.Get("comp") == "blocklist":
+		var buf bytes.Buffer
+		buf.WriteString(`<BlockList><UncommittedBlocks>`)
+		for id, b := range s.uncommitted {
+			buf.WriteString(`<Block><Name>` + id + `</Name><Size>` + strconv.Itoa(len(b)) + `</Size></Block>`)
+		}
+		buf.WriteString(`</UncommittedBlocks></BlockList>`)
+		w.Write(buf.Bytes())
+	case r.Method == "PUT" && q.Get("comp") == "blocklist":
+		b, _ := ioutil.ReadAll(r.Body)
+		s.content = nil
+		for _, m := range blockIDRegexp.FindAllStringSubmatch(string(b), -1) {
+			s.content = append(s.content, s.uncommitted[m[1]]...)
+		}
+		s.uncommitted = map[string][]byte{}
+		s.contentMD5 = r.Header.Get("x-ms-blob-content-md5")
+		w.WriteHeader(http.StatusCreated)
+	case r.Method == "HEAD":
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.content)))
+		w.Header().Set("Content-MD5", s.contentMD5)
+		w.WriteHeader(http.StatusOK)
+	default:
+		http.Error(w, "unexpected request "+r.Method+" "+r.URL.String(), http.StatusBadRequest)
+	}
+}
+
+// hostTransport sends all requests to the host of a test server.
+type hostTransport struct {
+	u *url.URL
+}
+
+func (t hostTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = cloneRequest(req)
+	req.URL.Scheme, req.URL.Host = t.u.Scheme, t.u.Host
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func TestPutBlockBlobResumes(t *testing.T) {
+	store := &fakeBlobStore{uncommitted: map[string][]byte{}, failAfter: 2}
+	srv := httptest.NewServer(store)
+	defer srv.Close()
+	u, _ := url.Parse(srv.URL)
+
+	sc, err := storage.NewClient("account", base64.StdEncoding.EncodeToString([]byte("key")), storage.DefaultBaseURL, storage.DefaultAPIVersion, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sc.HTTPClient = &http.Client{Transport: hostTransport{u}}
+	bs := sc.GetBlobService()
+	blob := bs.GetContainerReference(containerName).GetBlobReference("package.zip")
+
+	dir, err := ioutil.TempDir("", "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pkg := make([]byte, 5*1024+100)
+	rand.Read(pkg)
+	packagePath := filepath.Join(dir, "package.zip")
+	if err := ioutil.WriteFile(packagePath, pkg, 0600); err != nil {
+		t.Fatal(err)
+	}
+	statePath := uploadStatePath(packagePath)
+
+	if _, err := putBlockBlob(blob, packagePath, 1024, statePath); err == nil {
+		t.Fatal("Expected the upload to fail after 2 blocks")
+	}
+	state, err := readUploadState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(state.Blocks) != 2 {
+		t.Fatalf("Expected 2 blocks in the upload state, but got %d", len(state.Blocks))
+	}
+
+	store.failAfter = 0
+	if _, err := putBlockBlob(blob, packagePath, 1024, statePath); err != nil {
+		t.Fatal(err)
+	}
+	if store.puts != 6 {
+		t.Fatalf("Expected 6 blocks to be uploaded in total, but got %d", store.puts)
+	}
+	if !bytes.Equal(store.content, pkg) {
+		t.Fatal("Committed blob does not match the package")
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Fatalf("Expected the upload state to be removed, but got: %v", err)
+	}
+}
+
+func TestStorageAccountKey(t *testing.T) {
+	cl, done := testClient(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/subscription-id/services/storageservices/publisher/keys" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		w.Write([]byte(`<StorageService xmlns="http://schemas.microsoft.com/windowsazure"><Url>https://management.core.windows.net/subscription-id/services/storageservices/publisher</Url>` +
+			`<StorageServiceKeys><Primary>primary-key</Primary><Secondary>secondary-key</Secondary></StorageServiceKeys></StorageService>`))
+	})
+	defer done()
+
+	key, err := storageAccountKey(context.Background(), cl, "publisher")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "primary-key" {
+		t.Fatalf("Expected \"primary-key\", but got %q", key)
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	log "github.com/Sirupsen/logrus"
+	"github.com/codegangsta/cli"
+)
+
+var (
+	namespaceRegexp = regexp.MustCompile(`^[A-Za-z0-9]+(\.[A-Za-z0-9]+)*$`)
+	typeRegexp      = regexp.MustCompile(`^[A-Za-z0-9]+([._-][A-Za-z0-9]+)*$`)
+	versionRegexp   = regexp.MustCompile(`^[0-9]+(\.[0-9]+){1,3}$`)
+
+	// apiVersionRegexp matches the dated versions of the Service Management
+	// API, some of which have a suffix, e.g. 2014-05-01-preview.
+	apiVersionRegexp = regexp.MustCompile(`^[0-9]{4}-[0-9]{2}-[0-9]{2}(-[a-z]+)?$`)
+
+	subscriptionIDRegexp = regexp.MustCompile(`^[0-9A-Fa-f]{8}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{4}-[0-9A-Fa-f]{12}$`)
+)
+
+// Maximum lengths of the descriptive fields of a manifest, in characters,
+// accepted by Azure.
+const (
+	maxLabelLength       = 100
+	maxDescriptionLength = 1024
+)
+
+// supportedOSes are the values of SupportedOS recognized by Azure, in their
+// canonical casing.
+var supportedOSes = []string{"Linux", "Windows"}
+
+// normalizeSupportedOS returns the canonical casing of a supported OS.
+func normalizeSupportedOS(s string) (string, error) {
+	for _, v := range supportedOSes {
+		if strings.EqualFold(v, s) {
+			return v, nil
+		}
+	}
+	return "", fmt.Errorf("SupportedOS %q is not supported, must be one of: %s", s, strings.Join(supportedOSes, ", "))
+}
+
+// validateText checks that the value of a descriptive field of a manifest is
+// at most maxLength characters long and only contains characters valid in
+// XML, rejecting control characters.
+func validateText(field, value string, maxLength int) error {
+	if !utf8.ValidString(value) {
+		return fmt.Errorf("%s is not valid UTF-8", field)
+	}
+	if n := utf8.RuneCountInString(value); n > maxLength {
+		return fmt.Errorf("%s is %d characters long, the limit is %d", field, n, maxLength)
+	}
+	for i, r := range value {
+		if !isXMLChar(r) {
+			return fmt.Errorf("%s has invalid character %U at offset %d", field, r, i)
+		}
+	}
+	return nil
+}
+
+// isXMLChar reports whether r is a character allowed in XML 1.0 documents.
+func isXMLChar(r rune) bool {
+	return r == '\t' || r == '\n' || r == '\r' ||
+		(r >= 0x20 && r <= 0xD7FF) ||
+		(r >= 0xE000 && r <= 0xFFFD) ||
+		(r >= 0x10000 && r <= 0x10FFFF)
+}
+
+// validateMetadata checks the label and description of a manifest.
+func validateMetadata(label, description string) validationError {
+	var problems validationError
+	if err := validateText("Label", label, maxLabelLength); err != nil {
+		problems = append(problems, err.Error())
+	}
+	if err := validateText("Description", description, maxDescriptionLength); err != nil {
+		problems = append(problems, err.Error())
+	}
+	return problems
+}
+
+// validationError lists all the problems found in a manifest.
+type validationError []string
+
+func (e validationError) Error() string {
+	return fmt.Sprintf("Manifest is invalid:\n  - %s", strings.Join(e, "\n  - "))
+}
+
+// validateManifest checks that the required fields of an extension manifest
+// are present and well-formed. All problems found are reported at once in a
+// validationError.
+func validateManifest(b []byte) error {
+	var m extensionImage
+	if err := xml.Unmarshal(b, &m); err != nil {
+		return validationError{fmt.Sprintf("cannot parse XML: %v", err)}
+	}
+
+	var problems validationError
+	check := func(field, value string, re *regexp.Regexp, example string) {
+		if value == "" {
+			problems = append(problems, fmt.Sprintf("%s is required", field))
+		} else if !re.MatchString(value) {
+			problems = append(problems, fmt.Sprintf("%s %q is not well-formed, expected a value like %q", field, value, example))
+		}
+	}
+	check("ProviderNameSpace", m.ProviderNameSpace, namespaceRegexp, "Microsoft.Azure.Extensions")
+	check("Type", m.Type, typeRegexp, "CustomScript")
+	check("Version", m.Version, versionRegexp, "1.0.0")
+
+	switch {
+	case m.MediaLink == "":
+		problems = append(problems, "MediaLink is required")
+	case m.MediaLink == blobURLPlaceholder:
+		problems = append(problems, fmt.Sprintf("MediaLink is the %s placeholder, replace it with the URL of the uploaded extension package", blobURLPlaceholder))
+	default:
+		// The MediaLink of internal extensions is often a SAS URL, whose
+		// query is not printed.
+		if u, err := url.Parse(m.MediaLink); err != nil || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("MediaLink %q is not a valid https URL", strings.SplitN(m.MediaLink, "?", 2)[0]))
+		} else if u.Scheme != "https" {
+			problems = append(problems, fmt.Sprintf("MediaLink %q is not an https URL", u.Scheme+"://"+u.Host+u.Path))
+		}
+	}
+
+	problems = append(problems, validateMetadata(m.Label, m.Description)...)
+
+	if m.SampleConfig != "" {
+		if b, err := base64.StdEncoding.DecodeString(m.SampleConfig); err != nil || !json.Valid(b) {
+			problems = append(problems, "SampleConfig is not base64-encoded JSON")
+		}
+	}
+
+	if m.SupportedOS != "" {
+		if _, err := normalizeSupportedOS(m.SupportedOS); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+
+	if len(problems) > 0 {
+		return problems
+	}
+	return nil
+}
+
+func validateManifestFile(ctx context.Context, c *cli.Context) error {
+	manifest, err := checkFlag(c, flManifest.Name)
+	if err != nil {
+		return err
+	}
+	b, err := readManifestFile(manifest)
+	if err != nil {
+		return fmt.Errorf("Error reading manifest: %v", err)
+	}
+	if err := validateManifest(b); err != nil {
+		return err
+	}
+	log.Infof("Manifest %s is valid.", manifest)
+	return nil
+}
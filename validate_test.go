@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+)
+
+func TestValidateManifest(t *testing.T) {
+	err := validateManifest([]byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">
+  <ProviderNameSpace>Microsoft.OSCTExtensions</ProviderNameSpace>
+  <Type>CustomScriptForLinux</Type>
+  <Version>4.3.2.1</Version>
+  <MediaLink>https://localhost/extension.zip</MediaLink>
+</ExtensionImage>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestValidateManifestSASURL(t *testing.T) {
+	for mediaLink, ok := range map[string]bool{
+		"https://example.blob.core.windows.net/extensions/extension.zip?sv=2019-12-12&amp;sr=b&amp;sig=abc%2Bdef%3D&amp;sp=r": true,
+		"https://example.blob.core.windows.net/extensions/extension.zip?sig=abc":                                              true,
+		"http://example.blob.core.windows.net/extensions/extension.zip?sv=2019-12-12&amp;sig=abc":                             false,
+	} {
+		err := validateManifest([]byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">
+  <ProviderNameSpace>Microsoft.OSCTExtensions</ProviderNameSpace>
+  <Type>CustomScriptForLinux</Type>
+  <Version>4.3.2.1</Version>
+  <MediaLink>` + mediaLink + `</MediaLink>
+</ExtensionImage>`))
+		if (err == nil) != ok {
+			t.Errorf("%s: expected ok=%v, but got: %v", mediaLink, ok, err)
+		}
+		if err != nil && strings.Contains(err.Error(), "sig=") {
+			t.Errorf("%s: expected the SAS token not to be printed, but got: %v", mediaLink, err)
+		}
+	}
+}
+
+func TestValidateManifestRequiresHTTPS(t *testing.T) {
+	for _, mediaLink := range []string{
+		"http://example.blob.core.windows.net/extensions/extension.zip",
+		"ftp://example.blob.core.windows.net/extensions/extension.zip",
+		"example.blob.core.windows.net/extensions/extension.zip",
+	} {
+		err := validateManifest([]byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">
+  <ProviderNameSpace>Microsoft.OSCTExtensions</ProviderNameSpace>
+  <Type>CustomScriptForLinux</Type>
+  <Version>4.3.2.1</Version>
+  <MediaLink>` + mediaLink + `</MediaLink>
+</ExtensionImage>`))
+		if err == nil || !strings.Contains(err.Error(), "https URL") {
+			t.Errorf("%s: expected an error about https, but got: %v", mediaLink, err)
+		}
+	}
+}
+
+func TestValidateManifestReportsAllProblems(t *testing.T) {
+	err := validateManifest([]byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">
+  <Type>CustomScriptForLinux</Type>
+  <Version>v1</Version>
+  <MediaLink>%BLOB_URL%</MediaLink>
+</ExtensionImage>`))
+
+	problems, ok := err.(validationError)
+	if !ok {
+		t.Fatalf("Expected a validationError, but got %v", err)
+	}
+	if len(problems) != 3 {
+		t.Fatalf("Expected exactly three problems, but got %q", problems)
+	}
+	if !strings.Contains(problems[0], "ProviderNameSpace") {
+		t.Errorf("Expected a ProviderNameSpace problem, but got %q", problems[0])
+	}
+	if !strings.Contains(problems[1], "Version") {
+		t.Errorf("Expected a Version problem, but got %q", problems[1])
+	}
+	if !strings.Contains(problems[2], blobURLPlaceholder) {
+		t.Errorf("Expected a MediaLink problem, but got %q", problems[2])
+	}
+}
+
+func TestValidateManifestRejectsMalformedXML(t *testing.T) {
+	if err := validateManifest([]byte(`<ExtensionImage>`)); err == nil {
+		t.Fatal("Expected an error for malformed XML")
+	}
+}
+
+func TestNormalizeSupportedOS(t *testing.T) {
+	if os, err := normalizeSupportedOS("linux"); err != nil || os != "Linux" {
+		t.Fatalf("Expected \"Linux\", but got %q (%v)", os, err)
+	}
+	_, err := normalizeSupportedOS("FreeBSD")
+	if err == nil {
+		t.Fatal("Expected an error for an unsupported OS")
+	}
+	if !strings.Contains(err.Error(), "Linux, Windows") {
+		t.Fatalf("Expected the error to list the supported values, but got %q", err)
+	}
+}
+
+func TestValidateManifestRejectsUnsupportedOS(t *testing.T) {
+	err := validateManifest([]byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">
+  <ProviderNameSpace>Microsoft.OSCTExtensions</ProviderNameSpace>
+  <Type>CustomScriptForLinux</Type>
+  <Version>4.3.2.1</Version>
+  <MediaLink>https://localhost/extension.zip</MediaLink>
+  <SupportedOS>supported-os</SupportedOS>
+</ExtensionImage>`))
+	if err == nil || !strings.Contains(err.Error(), "SupportedOS") {
+		t.Fatalf("Expected a SupportedOS problem, but got %v", err)
+	}
+}
+
+func TestValidateText(t *testing.T) {
+	if err := validateText("Label", "Custom Script – Linux\n", maxLabelLength); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value, message string
+	}{
+		{strings.Repeat("é", maxLabelLength+1), "Label is 101 characters long, the limit is 100"},
+		{"Custom\x00Script", "Label has invalid character U+0000 at offset 6"},
+		{"Custom\xffScript", "Label is not valid UTF-8"},
+	}
+	for _, tt := range tests {
+		err := validateText("Label", tt.value, maxLabelLength)
+		if err == nil || err.Error() != tt.message {
+			t.Errorf("Expected error %q for %q, but got %v", tt.message, tt.value, err)
+		}
+	}
+}
+
+func TestValidateManifestChecksDescription(t *testing.T) {
+	err := validateManifest([]byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">
+  <ProviderNameSpace>Microsoft.OSCTExtensions</ProviderNameSpace>
+  <Type>CustomScriptForLinux</Type>
+  <Version>1.0.0</Version>
+  <MediaLink>https://localhost/extension.zip</MediaLink>
+  <Description>` + strings.Repeat("a", maxDescriptionLength+1) + `</Description>
+</ExtensionImage>`))
+	if err == nil || !strings.Contains(err.Error(), "Description is 1025 characters long, the limit is 1024") {
+		t.Fatalf("Expected a Description problem, but got %v", err)
+	}
+}
+
+func TestValidateManifestChecksSampleConfig(t *testing.T) {
+	err := validateManifest([]byte(`<ExtensionImage xmlns="http://schemas.microsoft.com/windowsazure">
+  <ProviderNameSpace>Microsoft.OSCTExtensions</ProviderNameSpace>
+  <Type>CustomScriptForLinux</Type>
+  <Version>1.0.0</Version>
+  <MediaLink>https://localhost/extension.zip</MediaLink>
+  <SampleConfig>` + base64.StdEncoding.EncodeToString([]byte("not json")) + `</SampleConfig>
+</ExtensionImage>`))
+	if err == nil || !strings.Contains(err.Error(), "SampleConfig is not base64-encoded JSON") {
+		t.Fatalf("Expected a SampleConfig problem, but got %v", err)
+	}
+}
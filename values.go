@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/codegangsta/cli"
+)
+
+// valuesKeys maps the keys of a values file, lowercased, to the flags of
+// new-extension-manifest they set. Both the flag names and the names of the
+// manifest fields are accepted.
+var valuesKeys = map[string]string{
+	"namespace":         "namespace",
+	"providernamespace": "namespace",
+	"name":              "name",
+	"type":              "name",
+	"version":           "version",
+	"label":             "label",
+	"description":       "description",
+	"blob-url":          "blob-url",
+	"medialink":         "blob-url",
+	"eula-url":          "eula-url",
+	"eula":              "eula-url",
+	"privacy-url":       "privacy-url",
+	"privacyuri":        "privacy-url",
+	"homepage-url":      "homepage-url",
+	"homepageuri":       "homepage-url",
+	"company":           "company",
+	"companyname":       "company",
+	"supported-os":      "supported-os",
+	"supportedos":       "supported-os",
+	"regions":           "regions",
+}
+
+// manifestValues holds the values of the flags of new-extension-manifest read
+// from a values file, keyed by flag name.
+type manifestValues map[string]string
+
+// readValuesFile reads a JSON, or flat YAML, values file.
+func readValuesFile(path string) (manifestValues, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Error reading values file: %v", err)
+	}
+	v, err := parseValues(b, strings.EqualFold(filepath.Ext(path), ".json"))
+	if err != nil {
+		return nil, fmt.Errorf("Error parsing values file %s: %v", path, err)
+	}
+	return v, nil
+}
+
+// parseValues parses the values of a JSON object, or of a flat YAML document
+// like the config file. Lists, e.g. of regions, are joined with commas.
+func parseValues(b []byte, isJSON bool) (manifestValues, error) {
+	raw := map[string]string{}
+	if isJSON || bytes.HasPrefix(bytes.TrimSpace(b), []byte("{")) {
+		var m map[string]interface{}
+		if err := json.Unmarshal(b, &m); err != nil {
+			return nil, err
+		}
+		for k, v := range m {
+			switch x := v.(type) {
+			case string:
+				raw[k] = x
+			case []interface{}:
+				var items []string
+				for _, item := range x {
+					items = append(items, fmt.Sprint(item))
+				}
+				raw[k] = strings.Join(items, ",")
+			default:
+				return nil, fmt.Errorf("value of %q must be a string or a list", k)
+			}
+		}
+	} else {
+		m, err := parseConfig(b)
+		if err != nil {
+			return nil, err
+		}
+		raw = m
+	}
+
+	values := manifestValues{}
+	var unknown []string
+	for k, v := range raw {
+		fl, ok := valuesKeys[strings.ToLower(k)]
+		if !ok {
+			unknown = append(unknown, k)
+			continue
+		}
+		values[fl] = v
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		return nil, fmt.Errorf("unknown keys: %s", strings.Join(unknown, ", "))
+	}
+	return values, nil
+}
+
+// get returns the value of the flag. Flags given on the command line take
+// precedence over the values file, which takes precedence over the config
+// file, environment variables and defaults.
+func (v manifestValues) get(c *cli.Context, fl string) string {
+	if !c.IsSet(fl) {
+		if s, ok := v[fl]; ok {
+			return s
+		}
+	}
+	return stringFlag(c, fl)
+}
+
+// require is like get, but returns an error if the flag has no value.
+func (v manifestValues) require(c *cli.Context, fl string) (string, error) {
+	if s := v.get(c, fl); s != "" {
+		return s, nil
+	}
+	return checkFlag(c, fl)
+}
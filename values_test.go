@@ -0,0 +1,57 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseValuesJSON(t *testing.T) {
+	v, err := parseValues([]byte(`{
+  "Namespace": "Microsoft.Azure.Extensions",
+  "Name": "CustomScript",
+  "Version": "2.0.1",
+  "Label": "Custom Script",
+  "regions": ["West US", "Japan East"]
+}`), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := manifestValues{
+		"namespace": "Microsoft.Azure.Extensions",
+		"name":      "CustomScript",
+		"version":   "2.0.1",
+		"label":     "Custom Script",
+		"regions":   "West US,Japan East",
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, v)
+	}
+}
+
+func TestParseValuesYAML(t *testing.T) {
+	v, err := parseValues([]byte(`# CustomScript
+ProviderNameSpace: Microsoft.Azure.Extensions
+type: CustomScript
+homepage-url: "https://github.com/Azure/custom-script-extension-linux"
+`), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := manifestValues{
+		"namespace":    "Microsoft.Azure.Extensions",
+		"name":         "CustomScript",
+		"homepage-url": "https://github.com/Azure/custom-script-extension-linux",
+	}
+	if !reflect.DeepEqual(v, expected) {
+		t.Fatalf("Expected %v, but got %v", expected, v)
+	}
+}
+
+func TestParseValuesRejectsUnknownKeys(t *testing.T) {
+	if _, err := parseValues([]byte(`{"namespace": "Microsoft.Azure.Extensions", "nmae": "CustomScript"}`), true); err == nil {
+		t.Fatal("Expected an error for an unknown key")
+	}
+	if _, err := parseValues([]byte(`{"version": 2}`), true); err == nil {
+		t.Fatal("Expected an error for a value which is not a string")
+	}
+}
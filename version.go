@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/codegangsta/cli"
+)
+
+// unknownBuildInfo is printed for build info not provided at compile time,
+// e.g. when built with plain `go build`.
+const unknownBuildInfo = "unknown"
+
+// printBuildInfo prints the version, git commit and build date of the CLI.
+func printBuildInfo(w io.Writer) {
+	fmt.Fprintf(w, "Version:    %s\n", buildInfo(GitSummary))
+	fmt.Fprintf(w, "Git commit: %s\n", buildInfo(GitCommit))
+	fmt.Fprintf(w, "Build date: %s\n", buildInfo(BuildDate))
+}
+
+func buildInfo(s string) string {
+	if s == "" {
+		return unknownBuildInfo
+	}
+	return s
+}
+
+func version(ctx context.Context, c *cli.Context) error {
+	printBuildInfo(os.Stdout)
+	return nil
+}
@@ -1,8 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"reflect"
+	"strings"
+	"time"
 
 	"encoding/json"
 	log "github.com/Sirupsen/logrus"
@@ -10,44 +14,185 @@ import (
 	"github.com/olekukonko/tablewriter"
 )
 
-func listVersions(c *cli.Context) {
-	cl := mkClient(checkFlag(c, flMgtURL.Name), checkFlag(c, flSubsID.Name), checkFlag(c, flSubsCert.Name))
-	v, err := cl.ListVersions()
+func listVersions(ctx context.Context, c *cli.Context) error {
+	output, err := outputFormat(c)
 	if err != nil {
-		log.Fatalf("Request failed: %v", err)
+		return err
+	}
+
+	var fields []string
+	if sel := stringFlag(c, flSelect.Name); sel != "" {
+		if output != "json" {
+			return fmt.Errorf("--%s can only be used with the json output", flSelect.Name)
+		}
+		if fields, err = parseSelect(reflect.TypeOf(PublishedExtension{}), sel); err != nil {
+			return err
+		}
 	}
 
-	json := c.Bool(flJSON.Name)
 	var f func(_ ListVersionsResponse) error
-	if json {
-		f = printListVersionsAsJSON
-	} else {
+	switch output {
+	case "table":
 		f = printListVersionsAsTable
+	case "json":
+		f = func(v ListVersionsResponse) error { return printListVersionsAsJSON(v, fields) }
+	case "csv":
+		f = printListVersionsAsCSV
+	}
+
+	watch, interval := c.Bool(flWatch.Name), c.Duration(flWatchInterval.Name)
+	if watch && output != "table" {
+		return fmt.Errorf("--%s can only be used with the table output", flWatch.Name)
+	}
+	if watch && interval <= 0 {
+		return fmt.Errorf("argument %q must be a positive duration", flWatchInterval.Name)
+	}
+
+	clients, err := mkClients(ctx, c)
+	if err != nil {
+		return err
+	}
+	if len(clients) > 1 {
+		for _, fl := range []string{flWatch.Name, flSelect.Name} {
+			if c.IsSet(fl) {
+				return fmt.Errorf("--%s cannot be used with several subscriptions", fl)
+			}
+		}
+		return listVersionsOfSubscriptions(ctx, c, clients, output)
+	}
+	cl := clients[0]
+	for {
+		v, err := cl.ListVersions(ctx)
+		if err != nil {
+			if watch && ctx.Err() != nil {
+				return nil
+			}
+			return wrapf(err, "Request failed: %v", err)
+		}
+		v.Extensions = filterVersions(v.Extensions, stringFlag(c, flNamespace.Name), stringFlag(c, flName.Name))
+		if !watch {
+			return f(v)
+		}
+
+		if isTerminal(os.Stdout) {
+			// Move the cursor home and clear the screen.
+			fmt.Print("\033[H\033[2J")
+		}
+		fmt.Printf("Every %v, last refreshed %s. Press Ctrl+C to stop.\n\n", interval, time.Now().Format("15:04:05"))
+		if err := f(v); err != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(interval):
+		case <-ctx.Done():
+			return nil
+		}
 	}
-	if err := f(v); err != nil {
-		log.Fatal(err)
+}
+
+// filterVersions returns the extensions matching the namespace and name,
+// ignoring case. Empty namespace or name matches all extensions.
+func filterVersions(extensions []PublishedExtension, namespace, name string) []PublishedExtension {
+	filtered := []PublishedExtension{}
+	for _, e := range extensions {
+		if namespace != "" && !strings.EqualFold(e.Ns, namespace) {
+			continue
+		}
+		if name != "" && !strings.EqualFold(e.Name, name) {
+			continue
+		}
+		filtered = append(filtered, e)
 	}
+	return filtered
 }
 
-func printListVersionsAsJSON(r ListVersionsResponse) error {
-	b, err := json.MarshalIndent(r.Extensions, "", "  ")
+// printListVersionsAsJSON prints the extensions as JSON. If fields are given,
+// only those fields of each extension are printed.
+func printListVersionsAsJSON(r ListVersionsResponse, fields []string) error {
+	var v interface{} = r.Extensions
+	if len(fields) > 0 {
+		v = project(r.Extensions, fields)
+	}
+	b, err := json.MarshalIndent(v, "", "  ")
 	if err != nil {
 		return fmt.Errorf("failed to format as json: %+v", err)
 	}
-	fmt.Fprintf(os.Stdout, "%s", string(b))
+	fmt.Fprintf(os.Stdout, "%s\n", string(b))
 	return nil
 }
 
-func printListVersionsAsTable(v ListVersionsResponse) error {
-	table := tablewriter.NewWriter(os.Stdout)
-	table.SetColWidth(4000)
-	table.SetHeader([]string{"Namespace", "Type", "Version", "Replicated?", "Internal?", "Regions"})
+// listVersionsHeader is the header of the columns of listVersionsRows.
+var listVersionsHeader = []string{"Namespace", "Type", "Version", "Replicated?", "Internal?", "Published", "Regions"}
+
+func listVersionsRows(v ListVersionsResponse) [][]string {
 	data := [][]string{}
 	for _, e := range v.Extensions {
-		data = append(data, []string{e.Ns, e.Name, e.Version, fmt.Sprintf("%v", e.ReplicationCompleted), fmt.Sprintf("%v", e.IsInternal), e.Regions})
+		data = append(data, []string{e.Ns, e.Name, e.Version, fmt.Sprintf("%v", e.ReplicationCompleted), fmt.Sprintf("%v", e.IsInternal), formatPublishedDate(e.PublishedDate), e.Regions})
+	}
+	return data
+}
+
+// formatPublishedDate formats the published date of a version in UTC. Dates
+// that cannot be parsed are returned as is, and a missing date is blank.
+func formatPublishedDate(d string) string {
+	t, err := time.Parse(time.RFC3339, d)
+	if err != nil {
+		return d
 	}
-	table.AppendBulk(data)
+	return t.UTC().Format("2006-01-02 15:04:05")
+}
+
+func printListVersionsAsTable(v ListVersionsResponse) error {
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetColWidth(4000)
+	table.SetHeader(listVersionsHeader)
+	table.AppendBulk(listVersionsRows(v))
 	table.Render()
 
 	return nil
 }
+
+func printListVersionsAsCSV(v ListVersionsResponse) error {
+	return writeCSV(os.Stdout, listVersionsHeader, listVersionsRows(v))
+}
+
+func getVersion(ctx context.Context, c *cli.Context) error {
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	ns, name, version, err := checkVersionFlags(c)
+	if err != nil {
+		return err
+	}
+	e, err := cl.GetExtension(ctx, ns, name, version)
+	if err == ErrExtensionNotFound {
+		return errorf(exitCodeNotFound, "Extension %s.%s version %s is not published.", ns, name, version)
+	} else if err != nil {
+		return wrapf(err, "Request failed: %v", err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetColWidth(4000)
+	table.SetHeader([]string{"Field", "Value"})
+	table.AppendBulk([][]string{
+		{"Namespace", e.Ns},
+		{"Type", e.Name},
+		{"Version", e.Version},
+		{"Label", e.Label},
+		{"Description", e.Description},
+		{"Internal?", fmt.Sprintf("%v", e.IsInternal)},
+		{"Replicated?", fmt.Sprintf("%v", e.ReplicationCompleted)},
+		{"Published", formatPublishedDate(e.PublishedDate)},
+		{"Media Link", e.MediaLink},
+		{"Regions", e.Regions},
+	})
+	annotations, err := versionAnnotations(ns, name, version)
+	if err != nil {
+		log.Warnf("Cannot read metadata: %v", err)
+	}
+	table.AppendBulk(annotationRows(annotations))
+	table.Render()
+	return nil
+}
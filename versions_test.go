@@ -0,0 +1,42 @@
+package main
+
+import "testing"
+
+func TestFilterVersions(t *testing.T) {
+	extensions := []PublishedExtension{
+		{Ns: "Microsoft.Azure.Extensions", Name: "CustomScript", Version: "2.0.1"},
+		{Ns: "Microsoft.Azure.Extensions", Name: "DockerExtension", Version: "1.2.0"},
+		{Ns: "Microsoft.OSTCExtensions", Name: "CustomScriptForLinux", Version: "1.5.2"},
+	}
+
+	tests := []struct {
+		namespace, name string
+		count           int
+	}{
+		{"", "", 3},
+		{"microsoft.azure.extensions", "", 2},
+		{"", "CUSTOMSCRIPT", 1},
+		{"Microsoft.OSTCExtensions", "CustomScript", 0},
+	}
+
+	for _, tt := range tests {
+		filtered := filterVersions(extensions, tt.namespace, tt.name)
+		if len(filtered) != tt.count {
+			t.Errorf("Expected %d extensions for namespace=%q name=%q, but got %d", tt.count, tt.namespace, tt.name, len(filtered))
+		}
+	}
+}
+
+func TestFormatPublishedDate(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"2017-03-01T18:04:12.3Z", "2017-03-01 18:04:12"},
+		{"2017-03-01T10:04:12-08:00", "2017-03-01 18:04:12"},
+		{"", ""},
+		{"03/01/2017", "03/01/2017"},
+	}
+	for _, tt := range tests {
+		if out := formatPublishedDate(tt.in); out != tt.out {
+			t.Errorf("Expected %q for %q, but got %q", tt.out, tt.in, out)
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"os"
+
+	"github.com/codegangsta/cli"
+	"github.com/olekukonko/tablewriter"
+)
+
+// whoami sends a cheap authenticated request, listing the regions of the
+// subscription, to check the credentials before starting a release.
+func whoami(ctx context.Context, c *cli.Context) error {
+	cl, err := mkClient(ctx, c)
+	if err != nil {
+		return err
+	}
+	if _, err := cl.ListLocations(ctx); isAuthError(err) {
+		return errorf(exitCodeAuthFailure, "The credentials were rejected by subscription %s: %v", cl.SubscriptionID(), err)
+	} else if err != nil {
+		return wrapf(err, "Request failed: %v", err)
+	}
+
+	table := tablewriter.NewWriter(os.Stdout)
+	table.SetHeader([]string{"Field", "Value"})
+	table.AppendBulk([][]string{
+		{"Subscription ID", cl.SubscriptionID()},
+		{"Management URL", cl.ManagementURL()},
+		{"Authenticated", "yes"},
+	})
+	table.Render()
+	return nil
+}